@@ -115,6 +115,17 @@ func (b *buf) uint64() uint64 {
 	return b.order.Uint64(a)
 }
 
+func (b *buf) uint24() uint32 {
+	a := b.bytes(3)
+	if a == nil {
+		return 0
+	}
+	if b.order == binary.BigEndian {
+		return uint32(a[0])<<16 | uint32(a[1])<<8 | uint32(a[2])
+	}
+	return uint32(a[2])<<16 | uint32(a[1])<<8 | uint32(a[0])
+}
+
 // Read a varint, which is 7 bits per byte, little endian.
 // the 0x80 bit means read another byte.
 func (b *buf) varint() (c uint64, bits uint) {
@@ -163,6 +174,54 @@ func (b *buf) addr() uint64 {
 	return 0
 }
 
+// String at offset off of a string section such as .debug_str.
+func (b *buf) sectionString(name string, data []byte, off uint64) string {
+	if off > uint64(len(data)) {
+		b.error("offset out of range of " + name + " section")
+		return ""
+	}
+	b1 := makeBuf(b.dwarf, unknownFormat{}, name, Offset(off), data[off:])
+	s := b1.string()
+	if b1.err != nil && b.err == nil {
+		b.data = nil
+		b.err = b1.err
+	}
+	return s
+}
+
+// Entry i of the table of offsets at base in the named section, such
+// as .debug_str_offsets. The offsets are 8 bytes in 64-bit DWARF.
+func (b *buf) indexedOffset(name string, data []byte, base, i uint64) uint64 {
+	size := uint64(4)
+	is64, known := b.format.dwarf64()
+	if !known {
+		b.error("unknown size for " + name + " offsets")
+		return 0
+	} else if is64 {
+		size = 8
+	}
+	if base > uint64(len(data)) || i >= (uint64(len(data))-base)/size {
+		b.error("index " + strconv.FormatUint(i, 10) + " out of range of " + name + " section")
+		return 0
+	}
+	if is64 {
+		return b.order.Uint64(data[base+i*size:])
+	}
+	return uint64(b.order.Uint32(data[base+i*size:]))
+}
+
+// Address i of the table of addresses at base in .debug_addr.
+func (b *buf) indexedAddr(base, i uint64) uint64 {
+	size := uint64(b.format.addrsize())
+	data := b.dwarf.addr
+	if base > uint64(len(data)) || size == 0 || i >= (uint64(len(data))-base)/size {
+		b.error("index " + strconv.FormatUint(i, 10) + " out of range of addr section")
+		return 0
+	}
+	b1 := makeBuf(b.dwarf, b.format, "addr", Offset(base+i*size), data[base+i*size:])
+	return b1.addr()
+}
+
 func (b *buf) unitLength() (length Offset, dwarf64 bool) {
 	length = Offset(b.uint32())
 	if length == 0xffffffff {
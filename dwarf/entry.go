@@ -26,6 +26,7 @@ type afield struct {
 	attr  Attr
 	fmt   format
 	class Class
+	val   int64 // for formImplicitConst
 }
 
 // a map from entry format ids to their descriptions
@@ -67,6 +68,9 @@ func (d *Data) parseAbbrev(off uint64, vers int) (abbrevTable, error) {
 			if tag == 0 && fmt == 0 {
 				break
 			}
+			if format(fmt) == formImplicitConst {
+				b1.int()
+			}
 			n++
 		}
 		if b1.err != nil {
@@ -82,6 +86,9 @@ func (d *Data) parseAbbrev(off uint64, vers int) (abbrevTable, error) {
 			a.field[i].attr = Attr(b.uint())
 			a.field[i].fmt = format(b.uint())
 			a.field[i].class = formToClass(a.field[i].fmt, a.field[i].attr, vers, &b)
+			if a.field[i].fmt == formImplicitConst {
+				a.field[i].val = b.int()
+			}
 		}
 		b.uint()
 		b.uint()
@@ -122,7 +129,7 @@ var attrIsExprloc = map[Attr]bool{
 }
 
 // attrPtrClass indicates the *ptr class of attributes that have
-// encoding formSecOffset in DWARF 4 or formData* in DWARF 2 and 3.
+// encoding formSecOffset in DWARF 4 and 5 or formData* in DWARF 2 and 3.
 var attrPtrClass = map[Attr]Class{
 	AttrLocation:      ClassLocListPtr,
 	AttrStmtList:      ClassLinePtr,
@@ -137,6 +144,11 @@ var attrPtrClass = map[Attr]Class{
 	AttrUseLocation:   ClassLocListPtr,
 	AttrVtableElemLoc: ClassLocListPtr,
 	AttrRanges:        ClassRangeListPtr,
+	// The following are new in DWARF 5.
+	AttrStrOffsetsBase: ClassStrOffsetsPtr,
+	AttrAddrBase:       ClassAddrPtr,
+	AttrRnglistsBase:   ClassRngListsPtr,
+	AttrLoclistsBase:   ClassLocListPtr,
 }
 
 // formToClass returns the DWARF 4 Class for the given form. If the
@@ -148,7 +160,7 @@ func formToClass(form format, attr Attr, vers int, b *buf) Class {
 		b.error("cannot determine class of unknown attribute form")
 		return 0
 
-	case formAddr:
+	case formAddr, formAddrx, formAddrx1, formAddrx2, formAddrx3, formAddrx4:
 		return ClassAddress
 
 	case formDwarfBlock1, formDwarfBlock2, formDwarfBlock4, formDwarfBlock:
@@ -163,6 +175,12 @@ func formToClass(form format, attr Attr, vers int, b *buf) Class {
 		}
 		return ClassBlock
 
+	case formData16:
+		return ClassBlock
+
+	case formImplicitConst:
+		return ClassConstant
+
 	case formData1, formData2, formData4, formData8, formSdata, formUdata:
 		// In DWARF 2 and 3, ClassPtr was encoded as a
 		// constant. Unlike ClassExprLoc/ClassBlock, some
@@ -183,7 +201,7 @@ func formToClass(form format, attr Attr, vers int, b *buf) Class {
 	case formRefSig8:
 		return ClassReferenceSig
 
-	case formString, formStrp:
+	case formString, formStrp, formLineStrp, formStrx, formStrx1, formStrx2, formStrx3, formStrx4:
 		return ClassString
 
 	case formSecOffset:
@@ -198,11 +216,17 @@ func formToClass(form format, attr Attr, vers int, b *buf) Class {
 	case formExprloc:
 		return ClassExprLoc
 
-	case formGnuRefAlt:
+	case formGnuRefAlt, formRefSup4, formRefSup8:
 		return ClassReferenceAlt
 
-	case formGnuStrpAlt:
+	case formGnuStrpAlt, formStrpSup:
 		return ClassStringAlt
+
+	case formLoclistx:
+		return ClassLocList
+
+	case formRnglistx:
+		return ClassRngList
 	}
 }
 
@@ -234,6 +258,11 @@ type Entry struct {
 //    loclistptr        int64          ClassLocListPtr
 //    macptr            int64          ClassMacPtr
 //    rangelistptr      int64          ClassRangeListPtr
+//    addrptr           int64          ClassAddrPtr
+//    loclist           int64          ClassLocList
+//    rnglist           int64          ClassRngList
+//    rnglistsptr       int64          ClassRngListsPtr
+//    stroffsetsptr     int64          ClassStrOffsetsPtr
 //
 // For unrecognized or vendor-defined attributes, Class may be
 // ClassUnknown.
@@ -324,6 +353,27 @@ const (
 	// offset into the DWARF string section of an alternate object
 	// file.
 	ClassStringAlt
+
+	// ClassAddrPtr represents values that are an int64 offset
+	// into the "addr" section.
+	ClassAddrPtr
+
+	// ClassLocList represents values that are an int64 offset
+	// into the "loclists" section.
+	ClassLocList
+
+	// ClassRngList represents values that are an int64 offset
+	// into the "rnglists" section.
+	ClassRngList
+
+	// ClassRngListsPtr represents values that are an int64 offset
+	// into the "rnglists" section. These are used as a base for
+	// ClassRngList values.
+	ClassRngListsPtr
+
+	// ClassStrOffsetsPtr represents values that are an int64
+	// offset into the "str_offsets" section.
+	ClassStrOffsetsPtr
 )
 
 //go:generate stringer -type=Class
@@ -362,14 +412,15 @@ func (e *Entry) AttrField(a Attr) *Field {
 type Offset uint32
 
 // Entry reads a single entry from buf, decoding
-// according to the given abbreviation table.
-func (b *buf) entry(atab abbrevTable, ubase Offset) *Entry {
+// according to the abbreviation table of unit u.
+func (b *buf) entry(u *unit) *Entry {
 	off := b.off
 	id := uint32(b.uint())
 	if id == 0 {
 		return &Entry{}
 	}
-	a, ok := atab[id]
+	ubase := u.base
+	a, ok := u.atable[id]
 	if !ok {
 		b.error("unknown abbreviation table index")
 		return nil
@@ -380,6 +431,17 @@ func (b *buf) entry(atab abbrevTable, ubase Offset) *Entry {
 		Children: a.children,
 		Field:    make([]Field, len(a.field)),
 	}
+
+	// The DWARF 5 forms that index into other sections are resolved
+	// once all the fields are read, as the root entry of a unit may
+	// give the bases of the indexes after the fields that use them.
+	type indexed struct {
+		field int
+		fmt   format
+		index uint64
+	}
+	var delayed []indexed
+
 	for i := range e.Field {
 		e.Field[i].Attr = a.field[i].attr
 		e.Field[i].Class = a.field[i].class
@@ -395,6 +457,16 @@ func (b *buf) entry(atab abbrevTable, ubase Offset) *Entry {
 		// address
 		case formAddr:
 			val = b.addr()
+		case formAddrx:
+			delayed = append(delayed, indexed{i, fmt, b.uint()})
+		case formAddrx1:
+			delayed = append(delayed, indexed{i, fmt, uint64(b.uint8())})
+		case formAddrx2:
+			delayed = append(delayed, indexed{i, fmt, uint64(b.uint16())})
+		case formAddrx3:
+			delayed = append(delayed, indexed{i, fmt, uint64(b.uint24())})
+		case formAddrx4:
+			delayed = append(delayed, indexed{i, fmt, uint64(b.uint32())})
 
 		// block
 		case formDwarfBlock1:
@@ -419,6 +491,11 @@ func (b *buf) entry(atab abbrevTable, ubase Offset) *Entry {
 			val = int64(b.int())
 		case formUdata:
 			val = int64(b.uint())
+		// New in DWARF 5.
+		case formImplicitConst:
+			val = a.field[i].val
+		case formData16:
+			val = b.bytes(16)
 
 		// flag
 		case formFlag:
@@ -460,34 +537,43 @@ func (b *buf) entry(atab abbrevTable, ubase Offset) *Entry {
 		// string
 		case formString:
 			val = b.string()
-		case formStrp:
-			var off uint64 // offset into .debug_str
+		case formStrp, formLineStrp:
+			var off uint64 // offset into .debug_str or .debug_line_str
 			is64, known := b.format.dwarf64()
 			if !known {
-				b.error("unknown size for DW_FORM_strp")
+				b.error("unknown size for form 0x" + strconv.FormatInt(int64(fmt), 16))
 			} else if is64 {
 				off = b.uint64()
 			} else {
 				off = uint64(b.uint32())
 			}
-			if uint64(int(off)) != off {
-				b.error("DW_FORM_strp offset out of range")
-			}
 			if b.err != nil {
 				return nil
 			}
-			b1 := makeBuf(b.dwarf, unknownFormat{}, "str", 0, b.dwarf.str)
-			b1.skip(int(off))
-			val = b1.string()
-			if b1.err != nil {
-				b.err = b1.err
+			if fmt == formStrp {
+				val = b.sectionString("str", b.dwarf.str, off)
+			} else {
+				val = b.sectionString("line_str", b.dwarf.lineStr, off)
+			}
+			if b.err != nil {
 				return nil
 			}
+		// New in DWARF 5.
+		case formStrx:
+			delayed = append(delayed, indexed{i, fmt, b.uint()})
+		case formStrx1:
+			delayed = append(delayed, indexed{i, fmt, uint64(b.uint8())})
+		case formStrx2:
+			delayed = append(delayed, indexed{i, fmt, uint64(b.uint16())})
+		case formStrx3:
+			delayed = append(delayed, indexed{i, fmt, uint64(b.uint24())})
+		case formStrx4:
+			delayed = append(delayed, indexed{i, fmt, uint64(b.uint32())})
 
 		// lineptr, loclistptr, macptr, rangelistptr
 		// New in DWARF 4, but clang can generate them with -gdwarf-2.
 		// Section reference, replacing use of formData4 and formData8.
-		case formSecOffset, formGnuRefAlt, formGnuStrpAlt:
+		case formSecOffset, formGnuRefAlt, formGnuStrpAlt, formStrpSup:
 			is64, known := b.format.dwarf64()
 			if !known {
 				b.error("unknown size for form 0x" + strconv.FormatInt(int64(fmt), 16))
@@ -507,15 +593,102 @@ func (b *buf) entry(atab abbrevTable, ubase Offset) *Entry {
 		case formRefSig8:
 			// 64-bit type signature.
 			val = b.uint64()
+
+		// reference to an entry of a supplementary object file
+		// New in DWARF 5.
+		case formRefSup4:
+			val = int64(b.uint32())
+		case formRefSup8:
+			val = int64(b.uint64())
+
+		// loclist, rnglist
+		// New in DWARF 5.
+		case formLoclistx, formRnglistx:
+			delayed = append(delayed, indexed{i, fmt, b.uint()})
 		}
 		e.Field[i].Val = val
 	}
 	if b.err != nil {
 		return nil
 	}
+
+	if len(delayed) > 0 {
+		bases := *b.dwarf.unitBases(u)
+		bases.set(e)
+		for _, x := range delayed {
+			var val interface{}
+			switch x.fmt {
+			case formAddrx, formAddrx1, formAddrx2, formAddrx3, formAddrx4:
+				val = b.indexedAddr(bases.addr, x.index)
+			case formStrx, formStrx1, formStrx2, formStrx3, formStrx4:
+				off := b.indexedOffset("str_offsets", b.dwarf.strOffsets, bases.strOffsets, x.index)
+				if b.err == nil {
+					val = b.sectionString("str", b.dwarf.str, off)
+				}
+			case formLoclistx:
+				// the offsets of the table are relative to its base
+				val = int64(bases.locLists + b.indexedOffset("loclists", b.dwarf.locLists, bases.locLists, x.index))
+			case formRnglistx:
+				val = int64(bases.rngLists + b.indexedOffset("rnglists", b.dwarf.rngLists, bases.rngLists, x.index))
+			}
+			if b.err != nil {
+				return nil
+			}
+			e.Field[x.field].Val = val
+		}
+	}
 	return e
 }
 
+// unitBases holds the offsets of the contributions of a DWARF 5 unit
+// to the sections its addrx, strx, loclistx and rnglistx forms index.
+type unitBases struct {
+	addr       uint64
+	strOffsets uint64
+	locLists   uint64
+	rngLists   uint64
+}
+
+// set sets the bases given by the attributes of e.
+func (ub *unitBases) set(e *Entry) {
+	for _, f := range e.Field {
+		off, ok := f.Val.(int64)
+		if !ok {
+			continue
+		}
+		switch f.Attr {
+		case AttrAddrBase:
+			ub.addr = uint64(off)
+		case AttrStrOffsetsBase:
+			ub.strOffsets = uint64(off)
+		case AttrLoclistsBase:
+			ub.locLists = uint64(off)
+		case AttrRnglistsBase:
+			ub.rngLists = uint64(off)
+		}
+	}
+}
+
+// unitBases returns the section bases of u, which are given by the
+// attributes of its root entry.
+func (d *Data) unitBases(u *unit) *unitBases {
+	if u.bases == nil {
+		// Set first: reading the root entry may need its own bases,
+		// which it then takes from its fields.
+		u.bases = new(unitBases)
+		b := makeBuf(d, u, "info", u.off, u.data)
+		e := b.entry(u)
+		if e == nil {
+			// Try again next time, such as once the sections
+			// the root entry needs are added.
+			u.bases = nil
+			return new(unitBases)
+		}
+		u.bases.set(e)
+	}
+	return u.bases
+}
+
 // A Reader allows reading Entry structures from a DWARF ``info'' section.
 // The Entry structures are arranged in a tree. The Reader's Next function
 // return successive entries from a pre-order traversal of the tree.
@@ -592,7 +765,7 @@ func (r *Reader) Next() (*Entry, error) {
 		return nil, nil
 	}
 	u := &r.d.unit[r.unit]
-	e := r.b.entry(u.atable, u.base)
+	e := r.b.entry(u)
 	if r.b.err != nil {
 		r.err = r.b.err
 		return nil, r.err
@@ -718,7 +891,10 @@ func (d *Data) Ranges(e *Entry) ([][2]uint64, error) {
 	}
 
 	ranges, rangesOK := e.Val(AttrRanges).(int64)
-	if rangesOK && d.ranges != nil {
+	i := d.offsetToUnit(e.Offset)
+	if rangesOK && i != -1 && (d.unit[i].vers < 5 && d.ranges != nil || d.unit[i].vers >= 5 && d.rngLists != nil) {
+		u := &d.unit[i]
+
 		// The initial base address is the lowpc attribute
 		// of the enclosing compilation unit.
 		// Although DWARF specifies the lowpc attribute,
@@ -728,13 +904,8 @@ func (d *Data) Ranges(e *Entry) ([][2]uint64, error) {
 		if e.Tag == TagCompileUnit {
 			cu = e
 		} else {
-			i := d.offsetToUnit(e.Offset)
-			if i == -1 {
-				return nil, errors.New("no unit for entry")
-			}
-			u := &d.unit[i]
 			b := makeBuf(d, u, "info", u.off, u.data)
-			cu = b.entry(u.atable, u.base)
+			cu = b.entry(u)
 			if b.err != nil {
 				return nil, b.err
 			}
@@ -747,7 +918,10 @@ func (d *Data) Ranges(e *Entry) ([][2]uint64, error) {
 			base = cuLow
 		}
 
-		u := &d.unit[d.offsetToUnit(e.Offset)]
+		if u.vers >= 5 {
+			return d.dwarf5Ranges(u, base, ranges, ret)
+		}
+
 		buf := makeBuf(d, u, "ranges", Offset(ranges), d.ranges[ranges:])
 		for len(buf.data) > 0 {
 			low = buf.addr()
@@ -767,3 +941,53 @@ func (d *Data) Ranges(e *Entry) ([][2]uint64, error) {
 
 	return ret, nil
 }
+
+// dwarf5Ranges appends the ranges of the range list at offset ranges of
+// .debug_rnglists to ret. See DWARF 5 section 2.17.3.
+func (d *Data) dwarf5Ranges(u *unit, base uint64, ranges int64, ret [][2]uint64) ([][2]uint64, error) {
+	if ranges < 0 || ranges > int64(len(d.rngLists)) {
+		return nil, errors.New("AttrRanges value out of range")
+	}
+	addrBase := d.unitBases(u).addr
+	buf := makeBuf(d, u, "rnglists", Offset(ranges), d.rngLists[ranges:])
+	addrx := func() uint64 {
+		return buf.indexedAddr(addrBase, buf.uint())
+	}
+	for len(buf.data) > 0 && buf.err == nil {
+		var low, high uint64
+		switch kind := buf.uint8(); kind {
+		case rleEndOfList:
+			return ret, nil
+		case rleBaseAddressx:
+			base = addrx()
+			continue
+		case rleStartxEndx:
+			low = addrx()
+			high = addrx()
+		case rleStartxLength:
+			low = addrx()
+			high = low + buf.uint()
+		case rleOffsetPair:
+			low = base + buf.uint()
+			high = base + buf.uint()
+		case rleBaseAddress:
+			base = buf.addr()
+			continue
+		case rleStartEnd:
+			low = buf.addr()
+			high = buf.addr()
+		case rleStartLength:
+			low = buf.addr()
+			high = low + buf.uint()
+		default:
+			buf.error("unknown range list entry kind 0x" + strconv.FormatInt(int64(kind), 16))
+		}
+		if buf.err == nil {
+			ret = append(ret, [2]uint64{low, high})
+		}
+	}
+	if buf.err != nil {
+		return nil, buf.err
+	}
+	return ret, nil
+}
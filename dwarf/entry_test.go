@@ -5,9 +5,10 @@
 package dwarf_test
 
 import (
-	. "debug/dwarf"
 	"reflect"
 	"testing"
+
+	. "github.com/lesnuages/debug/dwarf"
 )
 
 func TestSplit(t *testing.T) {
@@ -136,6 +137,111 @@ func TestReaderRanges(t *testing.T) {
 	}
 }
 
+func TestRangesSplitDwarf5(t *testing.T) {
+	// gcc -g -gdwarf-5 -gsplit-dwarf -O2 -freorder-blocks-and-partition -o ranges-split5.elf ranges.c
+	//
+	// The skeleton unit gives its ranges in .debug_rnglists, as
+	// indexes into .debug_addr.
+	want := []wantRange{
+		{0x1140, [][2]uint64{{0x1140, 0x119d}, {0x1040, 0x1050}}},
+		{0x119c, [][2]uint64{{0x1140, 0x119d}, {0x1040, 0x1050}}},
+		{0x1040, [][2]uint64{{0x1140, 0x119d}, {0x1040, 0x1050}}},
+		{0x119d, nil},
+		{0x1050, nil},
+	}
+	testRanges(t, "testdata/ranges-split5.elf", want)
+
+	e, err := elfData(t, "testdata/ranges-split5.elf").Reader().Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Tag != TagSkeletonUnit {
+		t.Fatalf("bad tag: have %s, want %s", e.Tag, TagSkeletonUnit)
+	}
+	if name, _ := e.Val(AttrDwoName).(string); name != "ranges-split5.elf-ranges.dwo" {
+		t.Errorf("bad DWO name %q", name)
+	}
+}
+
+func TestDwarf5Forms(t *testing.T) {
+	// A hand-written DWARF 5 unit whose name and low PC are
+	// indexes into .debug_str_offsets and .debug_addr, given
+	// before the attributes with the bases of those.
+	abbrev := []byte{
+		1, byte(TagCompileUnit), 0, // no children
+		byte(AttrName), 0x25, // DW_FORM_strx1
+		byte(AttrLowpc), 0x29, // DW_FORM_addrx1
+		byte(AttrHighpc), 0x21, 0x10, // DW_FORM_implicit_const 0x10
+		byte(AttrStrOffsetsBase), 0x17, // DW_FORM_sec_offset
+		byte(AttrAddrBase), 0x17, // DW_FORM_sec_offset
+		0, 0,
+		0,
+	}
+	info := []byte{
+		19, 0, 0, 0, // unit length
+		5, 0, // DWARF version 5
+		1,          // DW_UT_compile
+		8,          // address size
+		0, 0, 0, 0, // abbrev offset
+		1,          // abbrev code
+		1,          // name: string 1
+		0,          // low PC: address 0
+		8, 0, 0, 0, // str_offsets base
+		8, 0, 0, 0, // addr base
+	}
+	str := []byte("\x00hello\x00")
+	strOffsets := []byte{
+		12, 0, 0, 0, // length
+		5, 0, // version 5
+		0, 0, // padding
+		0, 0, 0, 0,
+		1, 0, 0, 0,
+	}
+	addr := []byte{
+		12, 0, 0, 0, // length
+		5, 0, // version 5
+		8, // address size
+		0, // segment selector size
+		0, 0x10, 0, 0, 0, 0, 0, 0,
+	}
+
+	d, err := New(abbrev, nil, nil, info, nil, nil, nil, str)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Reader().Next(); err == nil {
+		t.Error("read entry with strx and addrx forms before adding the sections they index")
+	}
+	if err := d.AddSection(".debug_str_offsets", strOffsets); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AddSection(".debug_addr", addr); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := d.Reader().Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Field{
+		{AttrName, "hello", ClassString},
+		{AttrLowpc, uint64(0x1000), ClassAddress},
+		{AttrHighpc, int64(0x10), ClassConstant},
+		{AttrStrOffsetsBase, int64(8), ClassStrOffsetsPtr},
+		{AttrAddrBase, int64(8), ClassAddrPtr},
+	}
+	if !reflect.DeepEqual(e.Field, want) {
+		t.Errorf("got fields %v, want %v", e.Field, want)
+	}
+	ranges, err := d.Ranges(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][2]uint64{{0x1000, 0x1010}}; !reflect.DeepEqual(ranges, want) {
+		t.Errorf("got ranges %x, want %x", ranges, want)
+	}
+}
+
 func Test64Bit(t *testing.T) {
 	// I don't know how to generate a 64-bit DWARF debug
 	// compilation unit except by using XCOFF, so this is
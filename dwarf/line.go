@@ -184,7 +184,7 @@ func (r *LineReader) readHeader() error {
 		return DecodeError{"line", hdrOffset, fmt.Sprintf("line table end %d exceeds section size %d", r.endOffset, buf.off+Offset(len(buf.data)))}
 	}
 	r.version = buf.uint16()
-	if buf.err == nil && (r.version < 2 || r.version > 4) {
+	if buf.err == nil && (r.version < 2 || r.version > 5) {
 		// DWARF goes to all this effort to make new opcodes
 		// backward-compatible, and then adds fields right in
 		// the middle of the header in new versions, so we're
@@ -192,6 +192,14 @@ func (r *LineReader) readHeader() error {
 		// versions.
 		return DecodeError{"line", hdrOffset, fmt.Sprintf("unknown line table version %d", r.version)}
 	}
+	if r.version >= 5 {
+		// [DWARF5 6.2.4]
+		addrsize := int(buf.uint8())
+		if buf.err == nil && addrsize != buf.format.addrsize() {
+			return DecodeError{"line", hdrOffset, fmt.Sprintf("line table address size %d differs from unit address size %d", addrsize, buf.format.addrsize())}
+		}
+		buf.uint8() // segment selector size
+	}
 	var headerLength Offset
 	if dwarf64 {
 		headerLength = Offset(buf.uint64())
@@ -238,6 +246,14 @@ func (r *LineReader) readHeader() error {
 		}
 	}
 
+	if r.version >= 5 {
+		if err := r.readHeaderEntries(dwarf64); err != nil {
+			return err
+		}
+		r.initialFileEntries = len(r.fileEntries)
+		return buf.err
+	}
+
 	// Read include directories table. The caller already set
 	// directories[0] to the compilation directory.
 	for {
@@ -271,6 +287,151 @@ func (r *LineReader) readHeader() error {
 	return buf.err
 }
 
+// lnctFormat is a content type and form pair describing a field of the
+// directory and file name entries of a DWARF 5 line table header.
+type lnctFormat struct {
+	lnct uint64
+	form format
+}
+
+// readHeaderEntries reads the DWARF 5 directory and file name tables of
+// the header, whose entries are described by sequences of lnctFormats.
+// Unlike in earlier versions, directory 0 is the compilation directory
+// and file 0 the primary source file, both listed in the tables.
+func (r *LineReader) readHeaderEntries(dwarf64 bool) error {
+	compDir := r.directories[0]
+	dirFormat := r.readLNCTFormat()
+	n := r.buf.uint()
+	if r.buf.err != nil {
+		return r.buf.err
+	}
+	r.directories = r.directories[:0]
+	for i := uint64(0); i < n; i++ {
+		dir, _, _, err := r.readLNCT(dirFormat, dwarf64)
+		if err != nil {
+			return err
+		}
+		if !pathIsAbs(dir) {
+			// Relative paths are implicitly relative to
+			// the compilation directory.
+			if i == 0 {
+				dir = pathJoin(compDir, dir)
+			} else {
+				dir = pathJoin(r.directories[0], dir)
+			}
+		}
+		r.directories = append(r.directories, dir)
+	}
+
+	fileFormat := r.readLNCTFormat()
+	n = r.buf.uint()
+	if r.buf.err != nil {
+		return r.buf.err
+	}
+	r.fileEntries = r.fileEntries[:0]
+	for i := uint64(0); i < n; i++ {
+		name, mtime, length, err := r.readLNCT(fileFormat, dwarf64)
+		if err != nil {
+			return err
+		}
+		r.fileEntries = append(r.fileEntries, &LineFile{name, mtime, int(length)})
+	}
+	return r.buf.err
+}
+
+// readLNCTFormat reads the count and lnctFormats describing the
+// entries of a DWARF 5 directory or file name table.
+func (r *LineReader) readLNCTFormat() []lnctFormat {
+	c := r.buf.uint8()
+	lnct := make([]lnctFormat, c)
+	for i := range lnct {
+		lnct[i].lnct = r.buf.uint()
+		lnct[i].form = format(r.buf.uint())
+	}
+	return lnct
+}
+
+// readLNCT reads a directory or file name entry described by lnct,
+// returning its path joined with its directory, if any, its modification
+// time and its length.
+func (r *LineReader) readLNCT(lnct []lnctFormat, dwarf64 bool) (path string, mtime uint64, length uint64, err error) {
+	var dir string
+	for _, lf := range lnct {
+		var str string
+		var val uint64
+		switch lf.form {
+		case formString:
+			str = r.buf.string()
+		case formStrp, formLineStrp:
+			var off uint64
+			if dwarf64 {
+				off = r.buf.uint64()
+			} else {
+				off = uint64(r.buf.uint32())
+			}
+			if lf.form == formStrp {
+				str = r.buf.sectionString("str", r.buf.dwarf.str, off)
+			} else {
+				str = r.buf.sectionString("line_str", r.buf.dwarf.lineStr, off)
+			}
+		case formStrx, formUdata:
+			val = r.buf.uint()
+		case formStrx1, formData1:
+			val = uint64(r.buf.uint8())
+		case formStrx2, formData2:
+			val = uint64(r.buf.uint16())
+		case formStrx3:
+			val = uint64(r.buf.uint24())
+		case formStrx4, formData4:
+			val = uint64(r.buf.uint32())
+		case formData8:
+			val = r.buf.uint64()
+		case formData16:
+			r.buf.bytes(16)
+		case formDwarfBlock:
+			r.buf.bytes(int(r.buf.uint()))
+		default:
+			return "", 0, 0, DecodeError{"line", r.buf.off, fmt.Sprintf("unknown line table entry form 0x%x", lf.form)}
+		}
+		if r.buf.err != nil {
+			return "", 0, 0, r.buf.err
+		}
+		switch lf.form {
+		case formStrx, formStrx1, formStrx2, formStrx3, formStrx4:
+			// These index the string offsets of the unit
+			// of the line table.
+			u := r.buf.format.(*unit)
+			off := r.buf.indexedOffset("str_offsets", r.buf.dwarf.strOffsets, r.buf.dwarf.unitBases(u).strOffsets, val)
+			if r.buf.err == nil {
+				str = r.buf.sectionString("str", r.buf.dwarf.str, off)
+			}
+			if r.buf.err != nil {
+				return "", 0, 0, r.buf.err
+			}
+		}
+
+		switch lf.lnct {
+		case lnctPath:
+			path = str
+		case lnctDirectoryIndex:
+			if val >= uint64(len(r.directories)) {
+				return "", 0, 0, DecodeError{"line", r.buf.off, "directory index too large"}
+			}
+			dir = r.directories[val]
+		case lnctTimestamp:
+			mtime = val
+		case lnctSize:
+			length = val
+		case lnctMD5:
+			// Ignored.
+		}
+	}
+	if dir != "" && !pathIsAbs(path) {
+		path = pathJoin(dir, path)
+	}
+	return path, mtime, length, nil
+}
+
 // readFileEntry reads a file entry from either the header or a
 // DW_LNE_define_file extended opcode and adds it to r.fileEntries. A
 // true return value indicates that there are no more entries to read.
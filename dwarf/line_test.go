@@ -5,10 +5,11 @@
 package dwarf_test
 
 import (
-	. "debug/dwarf"
 	"io"
 	"strings"
 	"testing"
+
+	. "github.com/lesnuages/debug/dwarf"
 )
 
 var (
@@ -114,6 +115,40 @@ func TestLineELFClang(t *testing.T) {
 	testLineTable(t, want, elfData(t, "testdata/line-clang.elf"))
 }
 
+func TestLineELFGCCDwarf5(t *testing.T) {
+	// Generated by:
+	//   # gcc --version | head -n1
+	//   gcc (Debian 12.2.0-14+deb12u1) 12.2.0
+	//   # gcc -g -gdwarf-5 -o line-gcc-dwarf5.elf line1.c line2.c
+
+	file1C := &LineFile{Name: "/tmp/dwarf5/line1.c"}
+	file1H := &LineFile{Name: "/tmp/dwarf5/line1.h"}
+	file2C := &LineFile{Name: "/tmp/dwarf5/line2.c"}
+
+	// Line table based on readelf --debug-dump=rawline
+	want := []LineEntry{
+		{Address: 0x1139, File: file1H, Line: 2, Column: 1, IsStmt: true},
+		{Address: 0x113d, File: file1H, Line: 5, Column: 8, IsStmt: true},
+		{Address: 0x1144, File: file1H, Line: 5, Column: 2, IsStmt: true},
+		{Address: 0x1146, File: file1H, Line: 6, Column: 10, IsStmt: true, Discriminator: 3},
+		{Address: 0x1150, File: file1H, Line: 5, Column: 22, IsStmt: true, Discriminator: 3},
+		{Address: 0x1154, File: file1H, Line: 5, Column: 15, IsStmt: true, Discriminator: 1},
+		{Address: 0x115a, File: file1H, Line: 7, Column: 1, IsStmt: true},
+		{Address: 0x115e, File: file1C, Line: 6, Column: 1, IsStmt: true},
+		{Address: 0x1162, File: file1C, Line: 7, Column: 2, IsStmt: true},
+		{Address: 0x116c, File: file1C, Line: 8, Column: 2, IsStmt: true},
+		{Address: 0x117b, File: file1C, Line: 9, Column: 1, IsStmt: true},
+		{Address: 0x117d, EndSequence: true},
+
+		{Address: 0x117d, File: file2C, Line: 4, Column: 1, IsStmt: true},
+		{Address: 0x1181, File: file2C, Line: 5, Column: 2, IsStmt: true},
+		{Address: 0x1190, File: file2C, Line: 6, Column: 1, IsStmt: true},
+		{Address: 0x1193, EndSequence: true},
+	}
+
+	testLineTable(t, want, elfData(t, "testdata/line-gcc-dwarf5.elf"))
+}
+
 func TestLineSeek(t *testing.T) {
 	d := elfData(t, "testdata/line-gcc.elf")
 
@@ -22,6 +22,13 @@ type Data struct {
 	ranges   []byte
 	str      []byte
 
+	// raw data of the sections new in DWARF 5, see AddSection
+	addr       []byte
+	lineStr    []byte
+	strOffsets []byte
+	rngLists   []byte
+	locLists   []byte
+
 	// parsed data
 	abbrevCache map[uint64]abbrevTable
 	order       binary.ByteOrder
@@ -94,3 +101,24 @@ func New(abbrev, aranges, frame, info, line, pubnames, ranges, str []byte) (*Dat
 func (d *Data) AddTypes(name string, types []byte) error {
 	return d.parseTypes(name, types)
 }
+
+// AddSection adds the contents of one of the sections new in DWARF 5 to
+// the DWARF data: .debug_addr, .debug_line_str, .debug_str_offsets,
+// .debug_rnglists or .debug_loclists. The values of attributes with the
+// forms that index into them are only resolved once they are added. Other
+// names are ignored.
+func (d *Data) AddSection(name string, contents []byte) error {
+	switch name {
+	case ".debug_addr":
+		d.addr = contents
+	case ".debug_line_str":
+		d.lineStr = contents
+	case ".debug_str_offsets":
+		d.strOffsets = contents
+	case ".debug_rnglists":
+		d.rngLists = contents
+	case ".debug_loclists":
+		d.locLists = contents
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package dwarf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A Section is a section of an object file that may hold DWARF data.
+type Section struct {
+	// Name is the name of the section in the object file, such as
+	// .debug_info, .zdebug_info or __debug_info.
+	Name string
+
+	// Data returns the contents of the section, with any compression
+	// of the object format itself, such as SHF_COMPRESSED, undone.
+	Data func() ([]byte, error)
+
+	// Relocate, if not nil, applies the relocations of the section to
+	// its decompressed contents.
+	Relocate func(b []byte) error
+}
+
+// SectionSuffix returns the name of the DWARF section of an object file
+// section, such as "info" for .debug_info, .zdebug_info, __debug_info or
+// __zdebug_info, or "" if it is not one.
+func SectionSuffix(name string) string {
+	for _, prefix := range []string{".debug_", ".zdebug_", "__debug_", "__zdebug_"} {
+		if strings.HasPrefix(name, prefix) {
+			return name[len(prefix):]
+		}
+	}
+	return ""
+}
+
+// Decompress returns the contents of a section compressed in the format of
+// .zdebug_ sections, which Mach-O also uses for its DWARF sections: "ZLIB",
+// the big endian size of the uncompressed data, then a zlib stream. Other
+// contents are returned as they are.
+func Decompress(b []byte) ([]byte, error) {
+	if len(b) < 12 || string(b[:4]) != "ZLIB" {
+		return b, nil
+	}
+	dlen := binary.BigEndian.Uint64(b[4:12])
+	r, err := zlib.NewReader(bytes.NewReader(b[12:]))
+	if err != nil {
+		return nil, err
+	}
+	var dbuf bytes.Buffer
+	if dlen < 1<<30 {
+		dbuf.Grow(int(dlen))
+	}
+	if n, err := io.Copy(&dbuf, io.LimitReader(r, int64(dlen))); err != nil {
+		return nil, err
+	} else if uint64(n) != dlen {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err := r.Close(); err != nil {
+		return nil, err
+	}
+	return dbuf.Bytes(), nil
+}
+
+// Load returns the DWARF data held by the sections of an object file. Only
+// the sections the package uses are read; their contents are decompressed
+// if need be, then relocated.
+func Load(sections []Section) (*Data, error) {
+	read := func(s *Section) ([]byte, error) {
+		b, err := s.Data()
+		if err != nil {
+			return nil, err
+		}
+		if b, err = Decompress(b); err != nil {
+			return nil, fmt.Errorf("%s: %v", s.Name, err)
+		}
+		if s.Relocate != nil {
+			if err := s.Relocate(b); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+
+	// There are many other DWARF sections, but these
+	// are the ones the package uses.
+	// Don't bother loading others.
+	var dat = map[string][]byte{"abbrev": nil, "info": nil, "str": nil, "line": nil, "ranges": nil,
+		"addr": nil, "line_str": nil, "str_offsets": nil, "rnglists": nil, "loclists": nil}
+	for i := range sections {
+		suffix := SectionSuffix(sections[i].Name)
+		if _, ok := dat[suffix]; !ok {
+			continue
+		}
+		b, err := read(&sections[i])
+		if err != nil {
+			return nil, err
+		}
+		dat[suffix] = b
+	}
+
+	d, err := New(dat["abbrev"], nil, nil, dat["info"], dat["line"], nil, dat["ranges"], dat["str"])
+	if err != nil {
+		return nil, err
+	}
+
+	// Add the sections new in DWARF 5.
+	for _, suffix := range []string{"addr", "line_str", "str_offsets", "rnglists", "loclists"} {
+		if dat[suffix] == nil {
+			continue
+		}
+		if err := d.AddSection(".debug_"+suffix, dat[suffix]); err != nil {
+			return nil, err
+		}
+	}
+
+	// Look for DWARF4 .debug_types sections.
+	for i := range sections {
+		if SectionSuffix(sections[i].Name) != "types" {
+			continue
+		}
+		b, err := read(&sections[i])
+		if err != nil {
+			return nil, err
+		}
+		if err := d.AddTypes(fmt.Sprintf("types-%d", i), b); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
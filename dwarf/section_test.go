@@ -0,0 +1,53 @@
+package dwarf_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"testing"
+
+	. "github.com/lesnuages/debug/dwarf"
+)
+
+func TestSectionSuffix(t *testing.T) {
+	for name, want := range map[string]string{
+		".debug_info":    "info",
+		".zdebug_abbrev": "abbrev",
+		"__debug_line":   "line",
+		"__zdebug_str":   "str",
+		".text":          "",
+		"__text":         "",
+	} {
+		if got := SectionSuffix(name); got != want {
+			t.Errorf("SectionSuffix(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	want := bytes.Repeat([]byte("dwarf"), 100)
+	var buf bytes.Buffer
+	buf.WriteString("ZLIB")
+	binary.Write(&buf, binary.BigEndian, uint64(len(want)))
+	w := zlib.NewWriter(&buf)
+	w.Write(want)
+	w.Close()
+
+	got, err := Decompress(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("decompressed %q, want %q", got, want)
+	}
+	if got, err := Decompress(want); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("uncompressed contents were changed: %q, %v", got, err)
+	}
+
+	// a size larger than the data is an error
+	b := buf.Bytes()
+	binary.BigEndian.PutUint64(b[4:], uint64(len(want)+1))
+	if _, err := Decompress(b); err == nil {
+		t.Error("truncated section was decompressed")
+	}
+}
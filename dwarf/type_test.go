@@ -5,11 +5,12 @@
 package dwarf_test
 
 import (
-	. "debug/dwarf"
-	"debug/elf"
-	"debug/macho"
-	"debug/pe"
 	"testing"
+
+	. "github.com/lesnuages/debug/dwarf"
+	"github.com/lesnuages/debug/elf"
+	"github.com/lesnuages/debug/macho"
+	"github.com/lesnuages/debug/pe"
 )
 
 var typedefTests = map[string]string{
@@ -19,7 +19,10 @@ type unit struct {
 	atable abbrevTable
 	asize  int
 	vers   int
-	is64   bool // True for 64-bit DWARF format
+	is64   bool  // True for 64-bit DWARF format
+	utype  uint8 // DWARF 5 unit type
+
+	bases *unitBases // DWARF 5 section bases, nil until needed
 }
 
 // Implement the dataFormat interface.
@@ -63,11 +66,17 @@ func (d *Data) parseUnits() ([]unit, error) {
 		n, u.is64 = b.unitLength()
 		dataOff := b.off
 		vers := b.uint16()
-		if vers != 2 && vers != 3 && vers != 4 {
+		if vers < 2 || vers > 5 {
 			b.error("unsupported DWARF version " + strconv.Itoa(int(vers)))
 			break
 		}
 		u.vers = int(vers)
+		if vers >= 5 {
+			// The unit type and address size moved before
+			// the abbreviation offset in DWARF 5.
+			u.utype = b.uint8()
+			u.asize = int(b.uint8())
+		}
 		var abbrevOff uint64
 		if u.is64 {
 			abbrevOff = b.uint64()
@@ -82,9 +91,32 @@ func (d *Data) parseUnits() ([]unit, error) {
 			break
 		}
 		u.atable = atable
-		u.asize = int(b.uint8())
+		if vers < 5 {
+			u.asize = int(b.uint8())
+		}
+
+		var sig uint64
+		var toff Offset
+		switch u.utype {
+		case utSkeleton, utSplitCompile:
+			b.uint64() // unit ID
+		case utType, utSplitType:
+			sig = b.uint64()
+			if u.is64 {
+				toff = Offset(b.uint64())
+			} else {
+				toff = Offset(b.uint32())
+			}
+		}
+
 		u.off = b.off
 		u.data = b.bytes(int(n - (b.off - dataOff)))
+
+		if u.utype == utType || u.utype == utSplitType {
+			// DWARF 5 moved type units to the info section;
+			// let formRefSig8 find them as in .debug_types.
+			d.typeSigs[sig] = &typeUnit{unit: *u, toff: u.base + toff, name: "info"}
+		}
 	}
 	if b.err != nil {
 		return nil, b.err
@@ -0,0 +1,657 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Chained import formats
+const (
+	DYLD_CHAINED_IMPORT          = 1
+	DYLD_CHAINED_IMPORT_ADDEND   = 2
+	DYLD_CHAINED_IMPORT_ADDEND64 = 3
+)
+
+// Chained pointer formats
+const (
+	DYLD_CHAINED_PTR_ARM64E              = 1
+	DYLD_CHAINED_PTR_64                  = 2
+	DYLD_CHAINED_PTR_32                  = 3
+	DYLD_CHAINED_PTR_32_CACHE            = 4
+	DYLD_CHAINED_PTR_32_FIRMWARE         = 5
+	DYLD_CHAINED_PTR_64_OFFSET           = 6
+	DYLD_CHAINED_PTR_ARM64E_KERNEL       = 7
+	DYLD_CHAINED_PTR_64_KERNEL_CACHE     = 8
+	DYLD_CHAINED_PTR_ARM64E_USERLAND     = 9
+	DYLD_CHAINED_PTR_ARM64E_FIRMWARE     = 10
+	DYLD_CHAINED_PTR_X86_64_KERNEL_CACHE = 11
+	DYLD_CHAINED_PTR_ARM64E_USERLAND24   = 12
+)
+
+// Chained page starts
+const (
+	DYLD_CHAINED_PTR_START_NONE  = 0xFFFF // no fixups in the page
+	DYLD_CHAINED_PTR_START_MULTI = 0x8000 // the page has several chains
+	DYLD_CHAINED_PTR_START_LAST  = 0x8000 // last chain of a page with several chains
+)
+
+const (
+	chainedFixupsHeaderSize  = 28
+	chainedStartsSegmentSize = 22 // up to the page starts
+)
+
+// ChainedImport - a symbol bound by chained fixups
+type ChainedImport struct {
+	LibOrdinal int // 1-based index of the dylib among the dylib commands, or a BIND_SPECIAL_DYLIB_* value
+	WeakImport bool
+	Name       string
+	Addend     int64 // DYLD_CHAINED_IMPORT_ADDEND and DYLD_CHAINED_IMPORT_ADDEND64 only
+}
+
+// ChainedStarts - the fixup chains of a segment
+type ChainedStarts struct {
+	SegIndex        int // index of the segment among the segment commands
+	PageSize        uint16
+	PointerFormat   uint16
+	SegmentOffset   uint64 // address of the segment, relative to the mach header
+	MaxValidPointer uint32 // 32-bit formats only
+	PageStarts      []uint16
+}
+
+// ChainedFixup - a pointer slot of a fixup chain, rebased or bound
+type ChainedFixup struct {
+	Address   uint64 // address of the slot
+	Bind      bool
+	Target    uint64 // rebase: address of the target
+	High8     uint8  // rebase: top byte of the pointer, not part of the target
+	Ordinal   uint32 // bind: index into the imports
+	Addend    int64  // bind: added to the address of the import
+	Auth      bool   // arm64e: the pointer is signed
+	Key       uint8  // arm64e: pointer authentication key
+	AddrDiv   bool   // arm64e: the address of the slot is part of the diversity
+	Diversity uint16 // arm64e: extra diversity of the signature
+}
+
+// ChainedFixups - the decoded contents of LC_DYLD_CHAINED_FIXUPS
+type ChainedFixups struct {
+	Version       uint32
+	ImportsFormat uint32
+	SymbolsFormat uint32 // 0, uncompressed
+	Starts        []ChainedStarts
+	Imports       []ChainedImport
+	Fixups        []ChainedFixup // by address
+}
+
+// Rebases returns the fixups that rebase their slot.
+func (cf *ChainedFixups) Rebases() []ChainedFixup {
+	var rebases []ChainedFixup
+	for _, fx := range cf.Fixups {
+		if !fx.Bind {
+			rebases = append(rebases, fx)
+		}
+	}
+	return rebases
+}
+
+// Binds returns the fixups that bind their slot to an import.
+func (cf *ChainedFixups) Binds() []ChainedFixup {
+	var binds []ChainedFixup
+	for _, fx := range cf.Fixups {
+		if fx.Bind {
+			binds = append(binds, fx)
+		}
+	}
+	return binds
+}
+
+// chainedFormat describes how a pointer format packs fixups.
+type chainedFormat struct {
+	stride      uint64 // unit of the next field
+	nextShift   uint   // the next field ends at bit 62 or 61
+	nextBits    uint
+	arm64e      bool
+	ordinalBits uint
+	offsets     bool // rebase targets are offsets from the mach header, rather than addresses
+}
+
+func pointerFormat(format uint16) (chainedFormat, error) {
+	switch format {
+	case DYLD_CHAINED_PTR_64, DYLD_CHAINED_PTR_64_OFFSET:
+		return chainedFormat{stride: 4, nextShift: 51, nextBits: 12, ordinalBits: 24, offsets: format == DYLD_CHAINED_PTR_64_OFFSET}, nil
+	case DYLD_CHAINED_PTR_ARM64E, DYLD_CHAINED_PTR_ARM64E_USERLAND:
+		return chainedFormat{stride: 8, nextShift: 51, nextBits: 11, arm64e: true, ordinalBits: 16, offsets: format == DYLD_CHAINED_PTR_ARM64E_USERLAND}, nil
+	case DYLD_CHAINED_PTR_ARM64E_USERLAND24:
+		return chainedFormat{stride: 8, nextShift: 51, nextBits: 11, arm64e: true, ordinalBits: 24, offsets: true}, nil
+	}
+	return chainedFormat{}, fmt.Errorf("unsupported chained pointer format %d", format)
+}
+
+func bits(v uint64, shift, n uint) uint64 { return v >> shift & (1<<n - 1) }
+
+// decode unpacks the fixup stored in v, for an image based at base.
+func (cfmt chainedFormat) decode(v, base uint64) (fx ChainedFixup, next uint64) {
+	next = bits(v, cfmt.nextShift, cfmt.nextBits) * cfmt.stride
+	if !cfmt.arm64e {
+		fx.Bind = v>>63 != 0
+		if fx.Bind {
+			fx.Ordinal = uint32(bits(v, 0, 24))
+			fx.Addend = int64(bits(v, 24, 8))
+			return
+		}
+		fx.Target = bits(v, 0, 36)
+		fx.High8 = uint8(bits(v, 36, 8))
+		if cfmt.offsets {
+			fx.Target += base
+		}
+		return
+	}
+
+	fx.Auth = v>>63 != 0
+	fx.Bind = v>>62&1 != 0
+	if fx.Bind {
+		fx.Ordinal = uint32(bits(v, 0, cfmt.ordinalBits))
+	}
+	if fx.Auth {
+		fx.Diversity = uint16(bits(v, 32, 16))
+		fx.AddrDiv = v>>48&1 != 0
+		fx.Key = uint8(bits(v, 49, 2))
+		if !fx.Bind {
+			fx.Target = bits(v, 0, 32) + base
+		}
+		return
+	}
+	if fx.Bind {
+		// 19-bit signed addend
+		fx.Addend = int64(bits(v, 32, 19)<<45) >> 45
+		return
+	}
+	fx.Target = bits(v, 0, 43)
+	fx.High8 = uint8(bits(v, 43, 8))
+	if cfmt.offsets {
+		fx.Target += base
+	}
+	return
+}
+
+// encode packs fx, followed by the next fixup next bytes further.
+func (cfmt chainedFormat) encode(fx ChainedFixup, next, base uint64) (uint64, error) {
+	if next%cfmt.stride != 0 || next/cfmt.stride >= 1<<cfmt.nextBits {
+		return 0, fmt.Errorf("fixup at 0x%x cannot chain to a fixup 0x%x bytes further", fx.Address, next)
+	}
+	v := next / cfmt.stride << cfmt.nextShift
+	field := func(x uint64, shift, n uint, what string) error {
+		if x >= 1<<n {
+			return fmt.Errorf("%s 0x%x of fixup at 0x%x does not fit in %d bits", what, x, fx.Address, n)
+		}
+		v |= x << shift
+		return nil
+	}
+	target := fx.Target
+	if !fx.Bind && (cfmt.offsets || fx.Auth) {
+		if target < base {
+			return 0, fmt.Errorf("target 0x%x of fixup at 0x%x is below the mach header", target, fx.Address)
+		}
+		target -= base
+	}
+
+	if !cfmt.arm64e {
+		if fx.Auth {
+			return 0, fmt.Errorf("fixup at 0x%x is signed in a format without pointer authentication", fx.Address)
+		}
+		if fx.Bind {
+			v |= 1 << 63
+			if fx.Addend < 0 {
+				return 0, fmt.Errorf("addend %d of fixup at 0x%x is negative", fx.Addend, fx.Address)
+			}
+			if err := field(uint64(fx.Ordinal), 0, 24, "ordinal"); err != nil {
+				return 0, err
+			}
+			return v, field(uint64(fx.Addend), 24, 8, "addend")
+		}
+		if err := field(target, 0, 36, "target"); err != nil {
+			return 0, err
+		}
+		return v | uint64(fx.High8)<<36, nil
+	}
+
+	if fx.Bind {
+		v |= 1 << 62
+		if err := field(uint64(fx.Ordinal), 0, cfmt.ordinalBits, "ordinal"); err != nil {
+			return 0, err
+		}
+	}
+	if fx.Auth {
+		v |= 1 << 63
+		if fx.Key > 3 {
+			return 0, fmt.Errorf("key %d of fixup at 0x%x is invalid", fx.Key, fx.Address)
+		}
+		v |= uint64(fx.Diversity)<<32 | uint64(fx.Key)<<49
+		if fx.AddrDiv {
+			v |= 1 << 48
+		}
+		if fx.Bind {
+			return v, nil
+		}
+		return v, field(target, 0, 32, "target")
+	}
+	if fx.Bind {
+		if fx.Addend < -1<<18 || fx.Addend >= 1<<18 {
+			return 0, fmt.Errorf("addend %d of fixup at 0x%x does not fit in 19 bits", fx.Addend, fx.Address)
+		}
+		return v | uint64(fx.Addend)&(1<<19-1)<<32, nil
+	}
+	if err := field(target, 0, 43, "target"); err != nil {
+		return 0, err
+	}
+	return v | uint64(fx.High8)<<43, nil
+}
+
+// segmentByIndex returns the i-th segment command.
+func (f *File) segmentByIndex(i int) *Segment {
+	for _, l := range f.Loads {
+		if seg, ok := l.(*Segment); ok {
+			if i == 0 {
+				return seg
+			}
+			i--
+		}
+	}
+	return nil
+}
+
+// chainedFixups returns the LC_DYLD_CHAINED_FIXUPS command.
+func (f *File) chainedFixups() *LinkEditData {
+	for _, l := range f.Loads {
+		if led, ok := l.(*LinkEditData); ok && led.Cmd == LoadCmdDyldChainedFixup {
+			return led
+		}
+	}
+	return nil
+}
+
+// imageBase returns the address of the mach header, which chained fixups
+// offsets are relative to.
+func (f *File) imageBase() uint64 {
+	if text := f.Segment("__TEXT"); text != nil {
+		return text.Addr - text.Offset
+	}
+	return 0
+}
+
+// ChainedFixups decodes LC_DYLD_CHAINED_FIXUPS and walks the fixup chains
+// of the segments.
+func (f *File) ChainedFixups() (*ChainedFixups, error) {
+	led := f.chainedFixups()
+	if led == nil {
+		return nil, errors.New("file has no chained fixups")
+	}
+	dat := led.RawDat
+	le := binary.LittleEndian
+	if len(dat) < chainedFixupsHeaderSize {
+		return nil, errors.New("chained fixups header is truncated")
+	}
+	cf := &ChainedFixups{
+		Version:       le.Uint32(dat[0:]),
+		ImportsFormat: le.Uint32(dat[20:]),
+		SymbolsFormat: le.Uint32(dat[24:]),
+	}
+	startsOffset := uint64(le.Uint32(dat[4:]))
+	importsOffset := uint64(le.Uint32(dat[8:]))
+	symbolsOffset := uint64(le.Uint32(dat[12:]))
+	importsCount := uint64(le.Uint32(dat[16:]))
+	if cf.SymbolsFormat != 0 {
+		return nil, fmt.Errorf("unsupported chained fixups symbols format %d", cf.SymbolsFormat)
+	}
+
+	// imports
+	importSize := map[uint32]uint64{DYLD_CHAINED_IMPORT: 4, DYLD_CHAINED_IMPORT_ADDEND: 8, DYLD_CHAINED_IMPORT_ADDEND64: 16}[cf.ImportsFormat]
+	if importSize == 0 {
+		return nil, fmt.Errorf("unknown chained imports format %d", cf.ImportsFormat)
+	}
+	if importsOffset+importsCount*importSize > uint64(len(dat)) || symbolsOffset > uint64(len(dat)) {
+		return nil, errors.New("chained imports are truncated")
+	}
+	for i := uint64(0); i < importsCount; i++ {
+		b := dat[importsOffset+i*importSize:]
+		var imp ChainedImport
+		var nameOffset uint64
+		switch cf.ImportsFormat {
+		case DYLD_CHAINED_IMPORT, DYLD_CHAINED_IMPORT_ADDEND:
+			v := le.Uint32(b)
+			imp.LibOrdinal = int(uint8(v))
+			if imp.LibOrdinal > 0xf0 {
+				imp.LibOrdinal = int(int8(v))
+			}
+			imp.WeakImport = v>>8&1 != 0
+			nameOffset = uint64(v >> 9)
+			if cf.ImportsFormat == DYLD_CHAINED_IMPORT_ADDEND {
+				imp.Addend = int64(int32(le.Uint32(b[4:])))
+			}
+		case DYLD_CHAINED_IMPORT_ADDEND64:
+			v := le.Uint64(b)
+			imp.LibOrdinal = int(uint16(v))
+			if imp.LibOrdinal > 0xfff0 {
+				imp.LibOrdinal = int(int16(v))
+			}
+			imp.WeakImport = v>>16&1 != 0
+			nameOffset = v >> 32
+			imp.Addend = int64(le.Uint64(b[8:]))
+		}
+		if symbolsOffset+nameOffset >= uint64(len(dat)) {
+			return nil, fmt.Errorf("name of import %d is outside of the chained fixups", i)
+		}
+		imp.Name = cstring(dat[symbolsOffset+nameOffset:])
+		cf.Imports = append(cf.Imports, imp)
+	}
+
+	// starts
+	if startsOffset+4 > uint64(len(dat)) {
+		return nil, errors.New("chained starts are truncated")
+	}
+	segCount := uint64(le.Uint32(dat[startsOffset:]))
+	if startsOffset+4+segCount*4 > uint64(len(dat)) {
+		return nil, errors.New("chained starts are truncated")
+	}
+	base := f.imageBase()
+	for i := uint64(0); i < segCount; i++ {
+		off := uint64(le.Uint32(dat[startsOffset+4+i*4:]))
+		if off == 0 {
+			continue
+		}
+		off += startsOffset
+		if off+chainedStartsSegmentSize > uint64(len(dat)) {
+			return nil, fmt.Errorf("chained starts of segment %d are truncated", i)
+		}
+		b := dat[off:]
+		st := ChainedStarts{
+			SegIndex:        int(i),
+			PageSize:        le.Uint16(b[4:]),
+			PointerFormat:   le.Uint16(b[6:]),
+			SegmentOffset:   le.Uint64(b[8:]),
+			MaxValidPointer: le.Uint32(b[16:]),
+		}
+		pageCount := uint64(le.Uint16(b[20:]))
+		if chainedStartsSegmentSize+pageCount*2 > uint64(len(b)) {
+			return nil, fmt.Errorf("chained page starts of segment %d are truncated", i)
+		}
+		for p := uint64(0); p < pageCount; p++ {
+			st.PageStarts = append(st.PageStarts, le.Uint16(b[chainedStartsSegmentSize+p*2:]))
+		}
+		cf.Starts = append(cf.Starts, st)
+
+		fixups, err := f.walkChains(&st, base, uint32(len(cf.Imports)))
+		if err != nil {
+			return nil, err
+		}
+		cf.Fixups = append(cf.Fixups, fixups...)
+	}
+	sort.SliceStable(cf.Fixups, func(i, j int) bool { return cf.Fixups[i].Address < cf.Fixups[j].Address })
+	return cf, nil
+}
+
+// walkChains follows the fixup chains of the pages of a segment.
+func (f *File) walkChains(st *ChainedStarts, base uint64, nimports uint32) ([]ChainedFixup, error) {
+	if len(st.PageStarts) == 0 {
+		return nil, nil
+	}
+	cfmt, err := pointerFormat(st.PointerFormat)
+	if err != nil {
+		return nil, err
+	}
+	seg := f.segmentByIndex(st.SegIndex)
+	if seg == nil {
+		return nil, fmt.Errorf("chained fixups refer to missing segment %d", st.SegIndex)
+	}
+	dat, err := seg.Data()
+	if err != nil {
+		return nil, fmt.Errorf("fail to read segment %s: %v", seg.Name, err)
+	}
+	var fixups []ChainedFixup
+	for p, start := range st.PageStarts {
+		if start == DYLD_CHAINED_PTR_START_NONE {
+			continue
+		}
+		if start&DYLD_CHAINED_PTR_START_MULTI != 0 {
+			return nil, fmt.Errorf("page %d of segment %s has several chains, which only 32-bit formats use", p, seg.Name)
+		}
+		for off := uint64(p)*uint64(st.PageSize) + uint64(start); ; {
+			if off+8 > uint64(len(dat)) {
+				return nil, fmt.Errorf("fixup chain of segment %s runs past its data at 0x%x", seg.Name, off)
+			}
+			fx, next := cfmt.decode(f.ByteOrder.Uint64(dat[off:]), base)
+			fx.Address = seg.Addr + off
+			if fx.Bind && fx.Ordinal >= nimports {
+				return nil, fmt.Errorf("fixup at 0x%x binds to missing import %d", fx.Address, fx.Ordinal)
+			}
+			fixups = append(fixups, fx)
+			if next == 0 {
+				break
+			}
+			off += next
+		}
+	}
+	return fixups, nil
+}
+
+// SetChainedFixups rewrites LC_DYLD_CHAINED_FIXUPS from cf and chains the
+// fixups through the pointer slots of the sections. The segments, page sizes
+// and pointer formats of cf.Starts are kept, the page starts are recomputed
+// from cf.Fixups, and every fixup must lie in a section of one of them.
+func (f *File) SetChainedFixups(cf *ChainedFixups) error {
+	led := f.chainedFixups()
+	if led == nil {
+		return errors.New("file has no chained fixups")
+	}
+	base := f.imageBase()
+
+	// assign the fixups to pages
+	starts := append([]ChainedStarts(nil), cf.Starts...)
+	sort.SliceStable(starts, func(i, j int) bool { return starts[i].SegIndex < starts[j].SegIndex })
+	pages := make([]map[int][]ChainedFixup, len(starts))
+	for _, fx := range cf.Fixups {
+		found := false
+		for i := range starts {
+			st := &starts[i]
+			seg := f.segmentByIndex(st.SegIndex)
+			if seg == nil {
+				return fmt.Errorf("chained fixups refer to missing segment %d", st.SegIndex)
+			}
+			if fx.Address < seg.Addr || fx.Address >= seg.Addr+seg.Memsz {
+				continue
+			}
+			if fx.Bind && fx.Ordinal >= uint32(len(cf.Imports)) {
+				return fmt.Errorf("fixup at 0x%x binds to missing import %d", fx.Address, fx.Ordinal)
+			}
+			if pages[i] == nil {
+				pages[i] = make(map[int][]ChainedFixup)
+			}
+			p := int((fx.Address - seg.Addr) / uint64(st.PageSize))
+			pages[i][p] = append(pages[i][p], fx)
+			found = true
+			break
+		}
+		if !found {
+			return fmt.Errorf("fixup at 0x%x is outside of the segments with chained fixups", fx.Address)
+		}
+	}
+
+	// chain the slots of each page
+	data := make(map[*Section][]byte)
+	for i := range starts {
+		st := &starts[i]
+		cfmt, err := pointerFormat(st.PointerFormat)
+		if err != nil {
+			return err
+		}
+		if st.PageSize == 0 {
+			return fmt.Errorf("chained starts of segment %d have no page size", st.SegIndex)
+		}
+		seg := f.segmentByIndex(st.SegIndex)
+		st.SegmentOffset = seg.Addr - base
+		st.PageStarts = nil
+		if len(pages[i]) == 0 {
+			continue
+		}
+		n := int((seg.Memsz + uint64(st.PageSize) - 1) / uint64(st.PageSize))
+		for p := 0; p < n; p++ {
+			fixups := pages[i][p]
+			if len(fixups) == 0 {
+				st.PageStarts = append(st.PageStarts, DYLD_CHAINED_PTR_START_NONE)
+				continue
+			}
+			sort.SliceStable(fixups, func(a, b int) bool { return fixups[a].Address < fixups[b].Address })
+			pageAddr := seg.Addr + uint64(p)*uint64(st.PageSize)
+			st.PageStarts = append(st.PageStarts, uint16(fixups[0].Address-pageAddr))
+			for j, fx := range fixups {
+				next := uint64(0)
+				if j+1 < len(fixups) {
+					next = fixups[j+1].Address - fx.Address
+					if next == 0 {
+						return fmt.Errorf("two fixups at 0x%x", fx.Address)
+					}
+				}
+				v, err := cfmt.encode(fx, next, base)
+				if err != nil {
+					return err
+				}
+				if err := f.putPointer(data, fx.Address, v); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	dat, err := encodeChainedFixups(cf, starts, f.segmentCount())
+	if err != nil {
+		return err
+	}
+
+	// nothing can fail past this point
+	for s, sdat := range data {
+		s.Replace(bytes.NewReader(sdat), int64(len(sdat)))
+	}
+	led.RawDat = dat
+	cf.Starts = starts
+	return nil
+}
+
+// putPointer stores the 64-bit value v at address addr, in the copy of the
+// data of the section holding it.
+func (f *File) putPointer(data map[*Section][]byte, addr, v uint64) error {
+	for _, s := range f.Sections {
+		if addr < s.Addr || addr+8 > s.Addr+s.Size {
+			continue
+		}
+		if isZerofill(s.Flags) {
+			return fmt.Errorf("fixup at 0x%x is in zero fill section %s,%s", addr, s.Seg, s.Name)
+		}
+		dat, ok := data[s]
+		if !ok {
+			var err error
+			if dat, err = s.Data(); err != nil {
+				return fmt.Errorf("fail to read section %s,%s: %v", s.Seg, s.Name, err)
+			}
+			data[s] = dat
+		}
+		f.ByteOrder.PutUint64(dat[addr-s.Addr:], v)
+		return nil
+	}
+	return fmt.Errorf("fixup at 0x%x is not inside any section", addr)
+}
+
+func (f *File) segmentCount() int {
+	n := 0
+	for _, l := range f.Loads {
+		if _, ok := l.(*Segment); ok {
+			n++
+		}
+	}
+	return n
+}
+
+// encodeChainedFixups serializes the fixups header, the starts of segCount
+// segments, the imports and their names, as ld lays them out.
+func encodeChainedFixups(cf *ChainedFixups, starts []ChainedStarts, segCount int) ([]byte, error) {
+	le := binary.LittleEndian
+	var buf bytes.Buffer
+	w := func(v interface{}) { binary.Write(&buf, le, v) }
+	pad := func(a int) { buf.Write(make([]byte, alignUp(uint64(buf.Len()), uint64(a))-uint64(buf.Len()))) }
+
+	buf.Write(make([]byte, chainedFixupsHeaderSize))
+	pad(8)
+	startsOffset := buf.Len()
+	w(uint32(segCount))
+	index := buf.Len()
+	buf.Write(make([]byte, 4*segCount))
+	for _, st := range starts {
+		if len(st.PageStarts) == 0 {
+			continue
+		}
+		if st.SegIndex >= segCount {
+			return nil, fmt.Errorf("chained fixups refer to missing segment %d", st.SegIndex)
+		}
+		pad(8)
+		le.PutUint32(buf.Bytes()[index+4*st.SegIndex:], uint32(buf.Len()-startsOffset))
+		w(uint32(chainedStartsSegmentSize + 2*len(st.PageStarts)))
+		w(st.PageSize)
+		w(st.PointerFormat)
+		w(st.SegmentOffset)
+		w(st.MaxValidPointer)
+		w(uint16(len(st.PageStarts)))
+		w(st.PageStarts)
+	}
+
+	pad(4)
+	importsOffset := buf.Len()
+	var names bytes.Buffer
+	names.WriteByte(0)
+	nameOffsets := map[string]uint64{"": 0}
+	for _, imp := range cf.Imports {
+		nameOffset, ok := nameOffsets[imp.Name]
+		if !ok {
+			nameOffset = uint64(names.Len())
+			nameOffsets[imp.Name] = nameOffset
+			names.WriteString(imp.Name)
+			names.WriteByte(0)
+		}
+		weak := uint64(0)
+		if imp.WeakImport {
+			weak = 1
+		}
+		switch cf.ImportsFormat {
+		case DYLD_CHAINED_IMPORT, DYLD_CHAINED_IMPORT_ADDEND:
+			if nameOffset >= 1<<23 || imp.LibOrdinal > 0xf0 || imp.LibOrdinal < -0xf {
+				return nil, fmt.Errorf("import %s does not fit in format %d", imp.Name, cf.ImportsFormat)
+			}
+			w(uint32(uint8(imp.LibOrdinal)) | uint32(weak)<<8 | uint32(nameOffset)<<9)
+			if cf.ImportsFormat == DYLD_CHAINED_IMPORT_ADDEND {
+				if imp.Addend != int64(int32(imp.Addend)) {
+					return nil, fmt.Errorf("addend of import %s does not fit in 32 bits", imp.Name)
+				}
+				w(int32(imp.Addend))
+			} else if imp.Addend != 0 {
+				return nil, fmt.Errorf("import %s has an addend, which format %d cannot hold", imp.Name, cf.ImportsFormat)
+			}
+		case DYLD_CHAINED_IMPORT_ADDEND64:
+			w(uint64(uint16(imp.LibOrdinal)) | weak<<16 | nameOffset<<32)
+			w(imp.Addend)
+		default:
+			return nil, fmt.Errorf("unknown chained imports format %d", cf.ImportsFormat)
+		}
+	}
+	symbolsOffset := buf.Len()
+	buf.Write(names.Bytes())
+	pad(8)
+
+	b := buf.Bytes()
+	le.PutUint32(b[0:], cf.Version)
+	le.PutUint32(b[4:], uint32(startsOffset))
+	le.PutUint32(b[8:], uint32(importsOffset))
+	le.PutUint32(b[12:], uint32(symbolsOffset))
+	le.PutUint32(b[16:], uint32(len(cf.Imports)))
+	le.PutUint32(b[20:], cf.ImportsFormat)
+	le.PutUint32(b[24:], cf.SymbolsFormat)
+	return b, nil
+}
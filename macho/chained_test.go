@@ -0,0 +1,125 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestChainedFixups(t *testing.T) {
+	tests := []struct {
+		pointerFormat uint16
+		importsFormat uint32
+		imports       []ChainedImport
+		fixups        []ChainedFixup
+	}{
+		{
+			DYLD_CHAINED_PTR_64, DYLD_CHAINED_IMPORT,
+			[]ChainedImport{{LibOrdinal: 1, Name: "_printf"}, {LibOrdinal: BIND_SPECIAL_DYLIB_FLAT_LOOKUP, WeakImport: true, Name: "_weak"}},
+			[]ChainedFixup{
+				{Address: 0x100001000, Bind: true, Ordinal: 0},
+				{Address: 0x100001008, Target: 0x100000f60, High8: 0x80},
+				{Address: 0x100001010, Bind: true, Ordinal: 1, Addend: 16},
+			},
+		},
+		{
+			DYLD_CHAINED_PTR_64_OFFSET, DYLD_CHAINED_IMPORT_ADDEND,
+			[]ChainedImport{{LibOrdinal: 1, Name: "_printf", Addend: -8}},
+			[]ChainedFixup{
+				{Address: 0x100001000, Target: 0x100000f90},
+				{Address: 0x100001010, Bind: true},
+			},
+		},
+		{
+			DYLD_CHAINED_PTR_ARM64E, DYLD_CHAINED_IMPORT_ADDEND64,
+			[]ChainedImport{{LibOrdinal: 300, Name: "_printf", Addend: 1 << 40}, {LibOrdinal: BIND_SPECIAL_DYLIB_SELF, Name: "_self"}},
+			[]ChainedFixup{
+				{Address: 0x100001000, Bind: true, Ordinal: 1, Addend: -4},
+				{Address: 0x100001008, Target: 0x100000f60, Auth: true, Key: 2, AddrDiv: true, Diversity: 0x1234},
+				{Address: 0x100001010, Bind: true, Auth: true, Key: 0, Diversity: 0xabcd},
+			},
+		},
+	}
+	for _, tt := range tests {
+		f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var cmd bytes.Buffer
+		binary.Write(&cmd, f.ByteOrder, LinkEditDataCmd{Cmd: LoadCmdDyldChainedFixup, Len: uint32(binary.Size(LinkEditDataCmd{}))})
+		if err := f.insertLoad(len(f.Loads), &LinkEditData{LoadBytes: cmd.Bytes(), Cmd: LoadCmdDyldChainedFixup}); err != nil {
+			t.Fatal(err)
+		}
+		cf := &ChainedFixups{
+			ImportsFormat: tt.importsFormat,
+			Starts:        []ChainedStarts{{SegIndex: 2, PageSize: 0x1000, PointerFormat: tt.pointerFormat}},
+			Imports:       tt.imports,
+			Fixups:        tt.fixups,
+		}
+		if err := f.SetChainedFixups(cf); err != nil {
+			t.Fatalf("format %d: %v", tt.pointerFormat, err)
+		}
+		data, err := f.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := NewFile(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := g.ChainedFixups()
+		if err != nil {
+			t.Fatalf("format %d: %v", tt.pointerFormat, err)
+		}
+		if !reflect.DeepEqual(got.Imports, tt.imports) {
+			t.Errorf("format %d: imports are %+v, want %+v", tt.pointerFormat, got.Imports, tt.imports)
+		}
+		if !reflect.DeepEqual(got.Fixups, tt.fixups) {
+			t.Errorf("format %d: fixups are %+v, want %+v", tt.pointerFormat, got.Fixups, tt.fixups)
+		}
+		want := []ChainedStarts{{SegIndex: 2, PageSize: 0x1000, PointerFormat: tt.pointerFormat, SegmentOffset: 0x1000, PageStarts: []uint16{0}}}
+		if !reflect.DeepEqual(got.Starts, want) {
+			t.Errorf("format %d: starts are %+v, want %+v", tt.pointerFormat, got.Starts, want)
+		}
+		if n := len(got.Rebases()) + len(got.Binds()); n != len(tt.fixups) {
+			t.Errorf("format %d: %d rebases and binds, want %d", tt.pointerFormat, n, len(tt.fixups))
+		}
+		f.Close()
+	}
+}
+
+func TestSetChainedFixupsFailure(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var cmd bytes.Buffer
+	binary.Write(&cmd, f.ByteOrder, LinkEditDataCmd{Cmd: LoadCmdDyldChainedFixup, Len: uint32(binary.Size(LinkEditDataCmd{}))})
+	if err := f.insertLoad(len(f.Loads), &LinkEditData{LoadBytes: cmd.Bytes(), Cmd: LoadCmdDyldChainedFixup}); err != nil {
+		t.Fatal(err)
+	}
+	before := make(map[*Section][]byte)
+	for _, s := range f.Sections {
+		before[s], _ = s.Data()
+	}
+	// the pointers fit, but DYLD_CHAINED_IMPORT has no room for the addend
+	cf := &ChainedFixups{
+		ImportsFormat: DYLD_CHAINED_IMPORT,
+		Starts:        []ChainedStarts{{SegIndex: 2, PageSize: 0x1000, PointerFormat: DYLD_CHAINED_PTR_64}},
+		Imports:       []ChainedImport{{LibOrdinal: 1, Name: "_printf", Addend: 8}},
+		Fixups:        []ChainedFixup{{Address: 0x100001000, Bind: true}},
+	}
+	if err := f.SetChainedFixups(cf); err == nil {
+		t.Fatal("import addend in DYLD_CHAINED_IMPORT format was accepted")
+	}
+	for _, s := range f.Sections {
+		if have, _ := s.Data(); !bytes.Equal(have, before[s]) {
+			t.Errorf("section %s,%s changed by failed SetChainedFixups", s.Seg, s.Name)
+		}
+	}
+	if led := f.chainedFixups(); led.RawDat != nil {
+		t.Errorf("chained fixups data set by failed SetChainedFixups")
+	}
+}
@@ -0,0 +1,602 @@
+package macho
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// Code signature blob magic numbers
+const (
+	CSMagicRequirement            uint32 = 0xfade0c00
+	CSMagicRequirements           uint32 = 0xfade0c01
+	CSMagicCodeDirectory          uint32 = 0xfade0c02
+	CSMagicEmbeddedSignature      uint32 = 0xfade0cc0
+	CSMagicEmbeddedEntitlements   uint32 = 0xfade7171
+	CSMagicEmbeddedDEREntitlement uint32 = 0xfade7172
+	CSMagicBlobWrapper            uint32 = 0xfade0b01 // CMS signature
+)
+
+// Code signature SuperBlob slots
+const (
+	CSSlotCodeDirectory          uint32 = 0
+	CSSlotInfo                   uint32 = 1
+	CSSlotRequirements           uint32 = 2
+	CSSlotResourceDir            uint32 = 3
+	CSSlotApplication            uint32 = 4
+	CSSlotEntitlements           uint32 = 5
+	CSSlotDEREntitlements        uint32 = 7
+	CSSlotAlternateCodeDirectory uint32 = 0x1000 // up to 5 alternate code directories follow
+	CSSlotSignature              uint32 = 0x10000
+)
+
+// Code directory hash types
+const (
+	CSHashTypeSHA1            uint8 = 1
+	CSHashTypeSHA256          uint8 = 2
+	CSHashTypeSHA256Truncated uint8 = 3
+	CSHashTypeSHA384          uint8 = 4
+)
+
+// Code directory flags
+const (
+	CSFlagAdhoc        uint32 = 0x2
+	CSFlagRuntime      uint32 = 0x10000 // hardened runtime
+	CSFlagLinkerSigned uint32 = 0x20000
+)
+
+// Requirement types of a requirements set
+const (
+	RequirementHost       uint32 = 1
+	RequirementGuest      uint32 = 2
+	RequirementDesignated uint32 = 3
+	RequirementLibrary    uint32 = 4
+	RequirementPlugin     uint32 = 5
+)
+
+// Code directory exec segment flags
+const (
+	CSExecSegMainBinary uint64 = 0x1
+)
+
+const (
+	csPageShift          = 12 // code slots hash 4K pages
+	codeDirectorySize    = 88 // header of a version 0x20400 code directory
+	codeDirectoryVersion = 0x20400
+)
+
+// A CodeSignatureBlob is a blob of the SuperBlob of an embedded code signature.
+type CodeSignatureBlob struct {
+	Slot  uint32
+	Magic uint32
+	Data  []byte // the whole blob, including its magic and length
+}
+
+// A CodeSignature is the decoded SuperBlob of an embedded code signature.
+type CodeSignature struct {
+	Blobs []CodeSignatureBlob // in index order
+
+	CodeDirectories []*CodeDirectory // the primary code directory comes first
+	Requirements    []byte           // requirements blob
+	Entitlements    []byte           // XML entitlements blob
+	DEREntitlements []byte           // DER entitlements blob
+	CMS             []byte           // CMS signature, the contents of the blob wrapper
+}
+
+// A CodeDirectory holds the hashes of the pages of a signed file and of the
+// other blobs of its signature.
+type CodeDirectory struct {
+	Version      uint32
+	Flags        uint32
+	HashSize     uint8
+	HashType     uint8
+	Platform     uint8
+	PageSize     uint8 // log2 of the page size, 0 for a single page
+	CodeLimit    uint64
+	Identifier   string
+	TeamID       string
+	ExecSegBase  uint64
+	ExecSegLimit uint64
+	ExecSegFlags uint64
+
+	SpecialSlots [][]byte // SpecialSlots[i] is the hash of slot i+1, from the end of the table
+	CodeSlots    [][]byte
+	Raw          []byte
+}
+
+// A Requirement is a code requirement of a requirements set. Data is the
+// requirement blob, a compiled requirement expression.
+type Requirement struct {
+	Type uint32
+	Data []byte
+}
+
+// CodeSignature decodes the SuperBlob of the embedded code signature.
+func (f *File) CodeSignature() (*CodeSignature, error) {
+	if f.SigBlock == nil || len(f.SigBlock.RawDat) == 0 {
+		return nil, errors.New("file has no code signature")
+	}
+	return parseCodeSignature(f.SigBlock.RawDat)
+}
+
+func parseCodeSignature(dat []byte) (*CodeSignature, error) {
+	if len(dat) < 12 || binary.BigEndian.Uint32(dat) != CSMagicEmbeddedSignature {
+		return nil, errors.New("code signature is not an embedded signature SuperBlob")
+	}
+	length := binary.BigEndian.Uint32(dat[4:])
+	count := binary.BigEndian.Uint32(dat[8:])
+	if uint64(length) > uint64(len(dat)) || 12+uint64(count)*8 > uint64(length) {
+		return nil, errors.New("code signature SuperBlob is truncated")
+	}
+	dat = dat[:length]
+
+	cs := new(CodeSignature)
+	for i := uint32(0); i < count; i++ {
+		slot := binary.BigEndian.Uint32(dat[12+i*8:])
+		off := binary.BigEndian.Uint32(dat[16+i*8:])
+		if uint64(off)+8 > uint64(len(dat)) {
+			return nil, fmt.Errorf("code signature blob %d is outside of the SuperBlob", slot)
+		}
+		blobLen := binary.BigEndian.Uint32(dat[off+4:])
+		if blobLen < 8 || uint64(off)+uint64(blobLen) > uint64(len(dat)) {
+			return nil, fmt.Errorf("code signature blob %d has invalid length %d", slot, blobLen)
+		}
+		b := CodeSignatureBlob{Slot: slot, Magic: binary.BigEndian.Uint32(dat[off:]), Data: dat[off : off+blobLen]}
+		cs.Blobs = append(cs.Blobs, b)
+
+		switch b.Magic {
+		case CSMagicCodeDirectory:
+			cd, err := parseCodeDirectory(b.Data)
+			if err != nil {
+				return nil, err
+			}
+			if slot == CSSlotCodeDirectory {
+				cs.CodeDirectories = append([]*CodeDirectory{cd}, cs.CodeDirectories...)
+			} else {
+				cs.CodeDirectories = append(cs.CodeDirectories, cd)
+			}
+		case CSMagicRequirements:
+			cs.Requirements = b.Data
+		case CSMagicEmbeddedEntitlements:
+			cs.Entitlements = b.Data
+		case CSMagicEmbeddedDEREntitlement:
+			cs.DEREntitlements = b.Data
+		case CSMagicBlobWrapper:
+			cs.CMS = b.Data[8:]
+		}
+	}
+	return cs, nil
+}
+
+func parseCodeDirectory(dat []byte) (*CodeDirectory, error) {
+	if len(dat) < 44 {
+		return nil, errors.New("code directory is truncated")
+	}
+	be := binary.BigEndian
+	cd := &CodeDirectory{
+		Version:   be.Uint32(dat[8:]),
+		Flags:     be.Uint32(dat[12:]),
+		CodeLimit: uint64(be.Uint32(dat[32:])),
+		HashSize:  dat[36],
+		HashType:  dat[37],
+		Platform:  dat[38],
+		PageSize:  dat[39],
+		Raw:       dat,
+	}
+	hashOffset := be.Uint32(dat[16:])
+	identOffset := be.Uint32(dat[20:])
+	nSpecialSlots := be.Uint32(dat[24:])
+	nCodeSlots := be.Uint32(dat[28:])
+
+	// later versions append fields to the header
+	field := func(version uint32, off int, size int) uint64 {
+		if cd.Version < version || off+size > len(dat) {
+			return 0
+		}
+		if size == 4 {
+			return uint64(be.Uint32(dat[off:]))
+		}
+		return be.Uint64(dat[off:])
+	}
+	teamOffset := uint32(field(0x20200, 48, 4))
+	if limit64 := field(0x20300, 56, 8); limit64 != 0 {
+		cd.CodeLimit = limit64
+	}
+	cd.ExecSegBase = field(0x20400, 64, 8)
+	cd.ExecSegLimit = field(0x20400, 72, 8)
+	cd.ExecSegFlags = field(0x20400, 80, 8)
+
+	if identOffset >= uint32(len(dat)) {
+		return nil, errors.New("code directory identifier is outside of the blob")
+	}
+	cd.Identifier = cstring(dat[identOffset:])
+	if teamOffset != 0 && teamOffset < uint32(len(dat)) {
+		cd.TeamID = cstring(dat[teamOffset:])
+	}
+
+	size := uint64(cd.HashSize)
+	if uint64(hashOffset) < uint64(nSpecialSlots)*size || uint64(hashOffset)+uint64(nCodeSlots)*size > uint64(len(dat)) {
+		return nil, errors.New("code directory hashes are outside of the blob")
+	}
+	for i := uint64(1); i <= uint64(nSpecialSlots); i++ {
+		off := uint64(hashOffset) - i*size
+		cd.SpecialSlots = append(cd.SpecialSlots, dat[off:off+size])
+	}
+	for i := uint64(0); i < uint64(nCodeSlots); i++ {
+		off := uint64(hashOffset) + i*size
+		cd.CodeSlots = append(cd.CodeSlots, dat[off:off+size])
+	}
+	return cd, nil
+}
+
+// blob prefixes dat with a blob header.
+func blob(magic uint32, dat []byte) []byte {
+	b := make([]byte, 8, 8+len(dat))
+	binary.BigEndian.PutUint32(b, magic)
+	binary.BigEndian.PutUint32(b[4:], uint32(8+len(dat)))
+	return append(b, dat...)
+}
+
+// superBlob assembles blobs, which must be sorted by slot, into an embedded signature.
+func superBlob(blobs []CodeSignatureBlob) []byte {
+	var buf bytes.Buffer
+	w := func(v uint32) { binary.Write(&buf, binary.BigEndian, v) }
+	size := 12 + 8*len(blobs)
+	for _, b := range blobs {
+		size += len(b.Data)
+	}
+	w(CSMagicEmbeddedSignature)
+	w(uint32(size))
+	w(uint32(len(blobs)))
+	off := 12 + 8*len(blobs)
+	for _, b := range blobs {
+		w(b.Slot)
+		w(uint32(off))
+		off += len(b.Data)
+	}
+	for _, b := range blobs {
+		buf.Write(b.Data)
+	}
+	return buf.Bytes()
+}
+
+// AdHocSign replaces the code signature with an ad-hoc one: a SHA-256 code
+// directory over the 4K pages of the file as Bytes writes it, an empty set of
+// requirements, the entitlements of the previous signature, if any, and an
+// empty CMS blob. LC_CODE_SIGNATURE is added if needed, and __LINKEDIT is
+// resized to the new signature. An empty identifier keeps the previous one.
+func (f *File) AdHocSign(identifier string) error {
+	var old *CodeSignature
+	if f.SigBlock != nil && len(f.SigBlock.RawDat) > 0 {
+		// an unreadable signature is replaced all the same
+		old, _ = parseCodeSignature(f.SigBlock.RawDat)
+	}
+	var oldCD *CodeDirectory
+	if old != nil && len(old.CodeDirectories) > 0 {
+		oldCD = old.CodeDirectories[0]
+	}
+	if identifier == "" {
+		if oldCD == nil {
+			return errors.New("no identifier to sign with")
+		}
+		identifier = oldCD.Identifier
+	}
+
+	if f.SigBlock == nil {
+		cmd := SigBlockCmd{Cmd: LoadCmdSignature, Len: uint32(binary.Size(SigBlockCmd{}))}
+		var buf bytes.Buffer
+		binary.Write(&buf, f.ByteOrder, cmd)
+		if err := f.insertLoad(len(f.Loads), LoadBytes(buf.Bytes())); err != nil {
+			return err
+		}
+		f.SigBlock = new(SigBlock)
+	}
+
+	// special slots hash the other blobs
+	blobs := []CodeSignatureBlob{
+		{Slot: CSSlotRequirements, Magic: CSMagicRequirements, Data: blob(CSMagicRequirements, make([]byte, 4))},
+	}
+	if old != nil && old.Entitlements != nil {
+		blobs = append(blobs, CodeSignatureBlob{Slot: CSSlotEntitlements, Magic: CSMagicEmbeddedEntitlements, Data: old.Entitlements})
+	}
+	if old != nil && old.DEREntitlements != nil {
+		blobs = append(blobs, CodeSignatureBlob{Slot: CSSlotDEREntitlements, Magic: CSMagicEmbeddedDEREntitlement, Data: old.DEREntitlements})
+	}
+	nSpecialSlots := blobs[len(blobs)-1].Slot
+	cms := CodeSignatureBlob{Slot: CSSlotSignature, Magic: CSMagicBlobWrapper, Data: blob(CSMagicBlobWrapper, nil)}
+
+	// the signature goes last, so its offset, which is where hashing stops,
+	// does not depend on its size
+	f.SigBlock.RawDat = make([]byte, 16)
+	if _, _, err := f.layout(); err != nil {
+		return err
+	}
+	codeLimit := f.SigBlock.Offset
+	nCodeSlots := (codeLimit + 1<<csPageShift - 1) >> csPageShift
+	cdSize := codeDirectorySize + uint64(len(identifier)) + 1 + (uint64(nSpecialSlots)+nCodeSlots)*sha256.Size
+	size := 12 + 8*uint64(len(blobs)+2) + cdSize + uint64(len(cms.Data))
+	for _, b := range blobs {
+		size += uint64(len(b.Data))
+	}
+	f.SigBlock.RawDat = make([]byte, alignUp(size, 16))
+	image, err := f.Bytes()
+	if err != nil {
+		return err
+	}
+	if f.SigBlock.Offset != codeLimit {
+		return errors.New("code signature moved while it was resized")
+	}
+
+	cd := &CodeDirectory{
+		Version:    codeDirectoryVersion,
+		Flags:      CSFlagAdhoc,
+		HashSize:   sha256.Size,
+		HashType:   CSHashTypeSHA256,
+		PageSize:   csPageShift,
+		CodeLimit:  codeLimit,
+		Identifier: identifier,
+	}
+	if oldCD != nil {
+		cd.Flags |= oldCD.Flags &^ CSFlagLinkerSigned
+		cd.ExecSegFlags = oldCD.ExecSegFlags
+	} else if f.Type == TypeExec {
+		cd.ExecSegFlags = CSExecSegMainBinary
+	}
+	if text := f.Segment("__TEXT"); text != nil {
+		cd.ExecSegBase = text.Offset
+		cd.ExecSegLimit = text.Filesz
+	}
+	cd.SpecialSlots = make([][]byte, nSpecialSlots)
+	for i := range cd.SpecialSlots {
+		cd.SpecialSlots[i] = make([]byte, sha256.Size)
+	}
+	for _, b := range blobs {
+		h := sha256.Sum256(b.Data)
+		cd.SpecialSlots[b.Slot-1] = h[:]
+	}
+	for off := uint64(0); off < codeLimit; off += 1 << csPageShift {
+		end := off + 1<<csPageShift
+		if end > codeLimit {
+			end = codeLimit
+		}
+		h := sha256.Sum256(image[off:end])
+		cd.CodeSlots = append(cd.CodeSlots, h[:])
+	}
+	cd.Raw = cd.encode()
+
+	blobs = append([]CodeSignatureBlob{{Slot: CSSlotCodeDirectory, Magic: CSMagicCodeDirectory, Data: cd.Raw}}, blobs...)
+	blobs = append(blobs, cms)
+	copy(f.SigBlock.RawDat, superBlob(blobs))
+	return nil
+}
+
+// encode serializes a version 0x20400 code directory.
+func (cd *CodeDirectory) encode() []byte {
+	var buf bytes.Buffer
+	w := func(v interface{}) { binary.Write(&buf, binary.BigEndian, v) }
+	hashOffset := codeDirectorySize + len(cd.Identifier) + 1 + len(cd.SpecialSlots)*int(cd.HashSize)
+	length := hashOffset + len(cd.CodeSlots)*int(cd.HashSize)
+	codeLimit32 := uint32(cd.CodeLimit)
+	var codeLimit64 uint64
+	if cd.CodeLimit > 0xffffffff {
+		codeLimit32, codeLimit64 = 0, cd.CodeLimit
+	}
+
+	w(CSMagicCodeDirectory)
+	w(uint32(length))
+	w(uint32(codeDirectoryVersion))
+	w(cd.Flags)
+	w(uint32(hashOffset))
+	w(uint32(codeDirectorySize)) // identOffset
+	w(uint32(len(cd.SpecialSlots)))
+	w(uint32(len(cd.CodeSlots)))
+	w(codeLimit32)
+	w([4]uint8{cd.HashSize, cd.HashType, cd.Platform, cd.PageSize})
+	w(uint32(0)) // spare2
+	w(uint32(0)) // scatterOffset
+	w(uint32(0)) // teamOffset
+	w(uint32(0)) // spare3
+	w(codeLimit64)
+	w(cd.ExecSegBase)
+	w(cd.ExecSegLimit)
+	w(cd.ExecSegFlags)
+	buf.WriteString(cd.Identifier)
+	buf.WriteByte(0)
+	for i := len(cd.SpecialSlots) - 1; i >= 0; i-- {
+		buf.Write(cd.SpecialSlots[i])
+	}
+	for _, h := range cd.CodeSlots {
+		buf.Write(h)
+	}
+	return buf.Bytes()
+}
+
+// newHash returns the hash function of a code directory hash type.
+func newHash(hashType uint8) (hash.Hash, error) {
+	switch hashType {
+	case CSHashTypeSHA1:
+		return sha1.New(), nil
+	case CSHashTypeSHA256, CSHashTypeSHA256Truncated:
+		return sha256.New(), nil
+	case CSHashTypeSHA384:
+		return sha512.New384(), nil
+	}
+	return nil, fmt.Errorf("unknown code directory hash type %d", hashType)
+}
+
+// sum hashes dat as the slots of cd are hashed, truncated to the hash size.
+func (cd *CodeDirectory) sum(dat []byte) ([]byte, error) {
+	h, err := newHash(cd.HashType)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(dat)
+	sum := h.Sum(nil)
+	if int(cd.HashSize) < len(sum) {
+		sum = sum[:cd.HashSize]
+	}
+	return sum, nil
+}
+
+// CDHash returns the hash identifying the code directory: the hash of the
+// whole blob, truncated to 20 bytes.
+func (cd *CodeDirectory) CDHash() ([]byte, error) {
+	h, err := newHash(cd.HashType)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(cd.Raw)
+	return h.Sum(nil)[:20], nil
+}
+
+// AdHoc reports whether the code directory is signed ad hoc, without a CMS signature.
+func (cd *CodeDirectory) AdHoc() bool { return cd.Flags&CSFlagAdhoc != 0 }
+
+// HardenedRuntime reports whether the code directory opts into the hardened runtime.
+func (cd *CodeDirectory) HardenedRuntime() bool { return cd.Flags&CSFlagRuntime != 0 }
+
+// LinkerSigned reports whether the code directory was generated by the linker.
+func (cd *CodeDirectory) LinkerSigned() bool { return cd.Flags&CSFlagLinkerSigned != 0 }
+
+// RequirementSet decodes the requirements blob into its requirements.
+func (cs *CodeSignature) RequirementSet() ([]Requirement, error) {
+	dat := cs.Requirements
+	if dat == nil {
+		return nil, nil
+	}
+	if len(dat) < 12 {
+		return nil, errors.New("requirements blob is truncated")
+	}
+	count := binary.BigEndian.Uint32(dat[8:])
+	if 12+uint64(count)*8 > uint64(len(dat)) {
+		return nil, errors.New("requirements blob index is truncated")
+	}
+	reqs := make([]Requirement, count)
+	for i := range reqs {
+		typ := binary.BigEndian.Uint32(dat[12+i*8:])
+		off := binary.BigEndian.Uint32(dat[16+i*8:])
+		if uint64(off)+8 > uint64(len(dat)) || binary.BigEndian.Uint32(dat[off:]) != CSMagicRequirement {
+			return nil, fmt.Errorf("requirement %d is not a requirement blob", typ)
+		}
+		n := binary.BigEndian.Uint32(dat[off+4:])
+		if n < 8 || uint64(off)+uint64(n) > uint64(len(dat)) {
+			return nil, fmt.Errorf("requirement %d has invalid length %d", typ, n)
+		}
+		reqs[i] = Requirement{Type: typ, Data: dat[off : off+n]}
+	}
+	return reqs, nil
+}
+
+// VerifyCodeDirectory checks the code directories of the signature against
+// the contents f was read from: every page up to the code limit, and every
+// signature blob with a special slot, must hash as recorded. Edits made to f
+// since are not taken into account. For a loaded image, the pages dyld wrote
+// to, such as the ones it bound, do not match their hashes.
+func (f *File) VerifyCodeDirectory() error {
+	cs, err := f.CodeSignature()
+	if err != nil {
+		return err
+	}
+	if len(cs.CodeDirectories) == 0 {
+		return errors.New("code signature has no code directory")
+	}
+	var limit uint64
+	for _, cd := range cs.CodeDirectories {
+		if cd.CodeLimit > limit {
+			limit = cd.CodeLimit
+		}
+	}
+	image := make([]byte, limit)
+	if err := f.readContents(image, 0); err != nil {
+		return fmt.Errorf("cannot read the signed contents up to code limit 0x%x: %v", limit, err)
+	}
+	for _, cd := range cs.CodeDirectories {
+		pageSize := cd.CodeLimit
+		if cd.PageSize != 0 {
+			pageSize = 1 << cd.PageSize
+		}
+		if pageSize > 0 {
+			if n := (cd.CodeLimit + pageSize - 1) / pageSize; uint64(len(cd.CodeSlots)) != n {
+				return fmt.Errorf("code directory has %d page hashes, want %d", len(cd.CodeSlots), n)
+			}
+		}
+		for i, want := range cd.CodeSlots {
+			start := uint64(i) * pageSize
+			end := start + pageSize
+			if end > cd.CodeLimit {
+				end = cd.CodeLimit
+			}
+			have, err := cd.sum(image[start:end])
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(have, want) {
+				return fmt.Errorf("page %d at offset 0x%x does not match its hash", i, start)
+			}
+		}
+		for _, b := range cs.Blobs {
+			if b.Slot == CSSlotCodeDirectory || b.Slot > uint32(len(cd.SpecialSlots)) {
+				continue
+			}
+			have, err := cd.sum(b.Data)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(have, cd.SpecialSlots[b.Slot-1]) {
+				return fmt.Errorf("signature blob in slot %d does not match its hash", b.Slot)
+			}
+		}
+	}
+	return nil
+}
+
+// readContents reads len(b) bytes of the contents f was read from, starting
+// at file offset off. For a loaded image the offsets are mapped through the
+// segments.
+func (f *File) readContents(b []byte, off uint64) error {
+	if f.r == nil {
+		return errors.New("file was not read from a reader")
+	}
+	if !f.memoryMode {
+		n, err := f.r.ReadAt(b, int64(off))
+		if n == len(b) {
+			return nil
+		}
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	text := f.Segment("__TEXT")
+	if text == nil {
+		return errors.New("image has no __TEXT segment")
+	}
+	for len(b) > 0 {
+		var seg *Segment
+		for _, l := range f.Loads {
+			if s, ok := l.(*Segment); ok && off >= s.Offset && off < s.Offset+s.Filesz {
+				seg = s
+				break
+			}
+		}
+		if seg == nil {
+			return fmt.Errorf("file offset 0x%x is not mapped by any segment", off)
+		}
+		n := seg.Offset + seg.Filesz - off
+		if n > uint64(len(b)) {
+			n = uint64(len(b))
+		}
+		if _, err := f.r.ReadAt(b[:n], int64(seg.Addr-text.Addr+off-seg.Offset)); err != nil {
+			return err
+		}
+		b, off = b[n:], off+n
+	}
+	return nil
+}
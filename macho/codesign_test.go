@@ -0,0 +1,219 @@
+package macho
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"reflect"
+	"testing"
+)
+
+func TestAdHocSign(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.AdHocSign(""); err == nil {
+		t.Fatal("signing an unsigned file without an identifier succeeded")
+	}
+	if err := f.AdHocSign("com.example.hello"); err != nil {
+		t.Fatal(err)
+	}
+	// signing twice must converge on the same layout
+	if err := f.AdHocSign(""); err != nil {
+		t.Fatal(err)
+	}
+	data, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.SigBlock == nil {
+		t.Fatal("signed file has no LC_CODE_SIGNATURE")
+	}
+	linkedit := g.Segment("__LINKEDIT")
+	if end := g.SigBlock.Offset + uint64(g.SigBlock.Len); end != linkedit.Offset+linkedit.Filesz || end != uint64(len(data)) {
+		t.Errorf("signature ends at 0x%x, want the end of __LINKEDIT 0x%x and of the file 0x%x",
+			end, linkedit.Offset+linkedit.Filesz, len(data))
+	}
+
+	cs, err := g.CodeSignature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cs.CodeDirectories) != 1 || cs.Requirements == nil || cs.CMS == nil {
+		t.Fatalf("signature has %d code directories, requirements %x and CMS %x", len(cs.CodeDirectories), cs.Requirements, cs.CMS)
+	}
+	cd := cs.CodeDirectories[0]
+	if cd.Identifier != "com.example.hello" {
+		t.Errorf("identifier is %q, want %q", cd.Identifier, "com.example.hello")
+	}
+	if cd.Flags&CSFlagAdhoc == 0 || cd.HashType != CSHashTypeSHA256 || cd.ExecSegFlags != CSExecSegMainBinary {
+		t.Errorf("code directory has flags 0x%x, hash type %d and exec segment flags 0x%x", cd.Flags, cd.HashType, cd.ExecSegFlags)
+	}
+	if cd.CodeLimit != g.SigBlock.Offset {
+		t.Errorf("code limit is 0x%x, want the signature offset 0x%x", cd.CodeLimit, g.SigBlock.Offset)
+	}
+	if want := int(cd.CodeLimit+1<<cd.PageSize-1) >> cd.PageSize; len(cd.CodeSlots) != want {
+		t.Fatalf("code directory has %d page hashes, want %d", len(cd.CodeSlots), want)
+	}
+	for i, h := range cd.CodeSlots {
+		start := uint64(i) << cd.PageSize
+		end := start + 1<<cd.PageSize
+		if end > cd.CodeLimit {
+			end = cd.CodeLimit
+		}
+		if sum := sha256.Sum256(data[start:end]); !bytes.Equal(h, sum[:]) {
+			t.Errorf("hash of page %d is %x, want %x", i, h, sum)
+		}
+	}
+	if sum := sha256.Sum256(cs.Requirements); !bytes.Equal(cd.SpecialSlots[CSSlotRequirements-1], sum[:]) {
+		t.Errorf("requirements hash is %x, want %x", cd.SpecialSlots[CSSlotRequirements-1], sum)
+	}
+}
+
+const testEntitlements = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>com.apple.security.cs.allow-jit</key>
+	<true/>
+	<key>keychain-access-groups</key>
+	<array>
+		<string>ABCDE12345.example</string>
+	</array>
+	<key>version</key>
+	<integer>3</integer>
+</dict>
+</plist>
+`
+
+func TestCodeSignatureBlobs(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// {"a.b": true, "k": ["x"]}
+	der := []byte{
+		0x70, 0x19, 0x02, 0x01, 0x01, 0xb0, 0x14,
+		0x30, 0x08, 0x0c, 0x03, 'a', '.', 'b', 0x01, 0x01, 0xff,
+		0x30, 0x08, 0x0c, 0x01, 'k', 0x30, 0x03, 0x0c, 0x01, 'x',
+	}
+	if err := f.AdHocSign("hello"); err != nil {
+		t.Fatal(err)
+	}
+	cs, err := f.CodeSignature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the entitlements of the previous signature are kept on re-signing
+	f.SigBlock.RawDat = superBlob([]CodeSignatureBlob{
+		{CSSlotCodeDirectory, CSMagicCodeDirectory, cs.CodeDirectories[0].Raw},
+		{CSSlotEntitlements, CSMagicEmbeddedEntitlements, blob(CSMagicEmbeddedEntitlements, []byte(testEntitlements))},
+		{CSSlotDEREntitlements, CSMagicEmbeddedDEREntitlement, blob(CSMagicEmbeddedDEREntitlement, der)},
+	})
+	if err := f.AdHocSign(""); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(signed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.VerifyCodeDirectory(); err != nil {
+		t.Fatalf("fresh signature does not verify: %v", err)
+	}
+
+	// the same check through the segments of a loaded image
+	text := g.Segment("__TEXT")
+	var image []byte
+	for _, l := range g.Loads {
+		if seg, ok := l.(*Segment); ok && seg.Filesz > 0 {
+			end := seg.Addr - text.Addr + seg.Memsz
+			if uint64(len(image)) < end {
+				image = append(image, make([]byte, end-uint64(len(image)))...)
+			}
+			copy(image[seg.Addr-text.Addr:], signed[seg.Offset:seg.Offset+seg.Filesz])
+		}
+	}
+	m, err := NewFileFromMemory(bytes.NewReader(image))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.VerifyCodeDirectory(); err != nil {
+		t.Errorf("signature of the loaded image does not verify: %v", err)
+	}
+
+	if cs, err = f.CodeSignature(); err != nil {
+		t.Fatal(err)
+	}
+	cd := cs.CodeDirectories[0]
+	if cd.Identifier != "hello" || !cd.AdHoc() || cd.HardenedRuntime() || cd.LinkerSigned() {
+		t.Errorf("code directory %q has flags 0x%x", cd.Identifier, cd.Flags)
+	}
+	cdhash, err := cd.CDHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := sha256.Sum256(cd.Raw); !bytes.Equal(cdhash, sum[:20]) {
+		t.Errorf("CDHash is %x, want %x", cdhash, sum[:20])
+	}
+
+	ent, err := cs.DecodeEntitlements()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"com.apple.security.cs.allow-jit": true,
+		"keychain-access-groups":          []interface{}{"ABCDE12345.example"},
+		"version":                         int64(3),
+	}
+	if !reflect.DeepEqual(ent, want) {
+		t.Errorf("entitlements are %v, want %v", ent, want)
+	}
+	derEnt, err := cs.DecodeDEREntitlements()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]interface{}{"a.b": true, "k": []interface{}{"x"}}
+	if !reflect.DeepEqual(derEnt, want) {
+		t.Errorf("DER entitlements are %v, want %v", derEnt, want)
+	}
+
+	reqs, err := cs.RequirementSet()
+	if err != nil || len(reqs) != 0 {
+		t.Errorf("ad-hoc requirement set is %v, %v, want it empty", reqs, err)
+	}
+	designated := blob(CSMagicRequirement, []byte{0, 0, 0, 1, 0, 0, 0, 1}) // kind, opTrue
+	set := blob(CSMagicRequirements, append([]byte{0, 0, 0, 1, 0, 0, 0, 3, 0, 0, 0, 20}, designated...))
+	reqs, err = (&CodeSignature{Requirements: set}).RequirementSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reqs) != 1 || reqs[0].Type != RequirementDesignated || !bytes.Equal(reqs[0].Data, designated) {
+		t.Errorf("requirement set is %v, want the designated requirement %x", reqs, designated)
+	}
+
+	// tamper with the code and read the file back
+	data, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[f.Section("__text").Offset] ^= 0xff
+	g, err = NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.VerifyCodeDirectory(); err == nil {
+		t.Error("tampered code verified")
+	}
+}
@@ -0,0 +1,574 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// dyldCacheHeader is the header of a dyld shared cache file, as far as it is
+// read here. Older caches have a shorter header: the fields past
+// MappingOffset are then zero.
+type dyldCacheHeader struct {
+	Magic                  [16]byte
+	MappingOffset          uint32
+	MappingCount           uint32
+	ImagesOffsetOld        uint32
+	ImagesCountOld         uint32
+	DyldBaseAddress        uint64
+	CodeSignatureOffset    uint64
+	CodeSignatureSize      uint64
+	SlideInfoOffsetUnused  uint64
+	SlideInfoSizeUnused    uint64
+	LocalSymbolsOffset     uint64
+	LocalSymbolsSize       uint64
+	UUID                   [16]byte
+	CacheType              uint64
+	BranchPoolsOffset      uint32
+	BranchPoolsCount       uint32
+	DyldInCacheMH          uint64
+	DyldInCacheEntry       uint64
+	ImagesTextOffset       uint64
+	ImagesTextCount        uint64
+	PatchInfoAddr          uint64
+	PatchInfoSize          uint64
+	OtherImageGroupAddr    uint64
+	OtherImageGroupSize    uint64
+	ProgClosuresAddr       uint64
+	ProgClosuresSize       uint64
+	ProgClosuresTrieAddr   uint64
+	ProgClosuresTrieSize   uint64
+	Platform               uint32
+	FormatVersion          uint32 // and flags
+	SharedRegionStart      uint64
+	SharedRegionSize       uint64
+	MaxSlide               uint64
+	DylibsImageArrayAddr   uint64
+	DylibsImageArraySize   uint64
+	DylibsTrieAddr         uint64
+	DylibsTrieSize         uint64
+	OtherImageArrayAddr    uint64
+	OtherImageArraySize    uint64
+	OtherTrieAddr          uint64
+	OtherTrieSize          uint64
+	MappingWithSlideOffset uint32
+	MappingWithSlideCount  uint32
+	DylibsPBLStateArray    uint64
+	DylibsPBLSetAddr       uint64
+	ProgramsPBLSetPoolAddr uint64
+	ProgramsPBLSetPoolSize uint64
+	ProgramTrieAddr        uint64
+	ProgramTrieSize        uint32
+	OsVersion              uint32
+	AltPlatform            uint32
+	AltOsVersion           uint32
+	SwiftOptsOffset        uint64
+	SwiftOptsSize          uint64
+	SubCacheArrayOffset    uint32
+	SubCacheArrayCount     uint32
+	SymbolFileUUID         [16]byte
+	RosettaReadOnlyAddr    uint64
+	RosettaReadOnlySize    uint64
+	RosettaReadWriteAddr   uint64
+	RosettaReadWriteSize   uint64
+	ImagesOffset           uint32
+	ImagesCount            uint32
+	CacheSubType           uint32
+}
+
+// Offsets of the header fields that tell the format of a cache apart
+const (
+	dyldCacheSymbolFileUUIDOffset = 0x190
+	dyldCacheImagesCountOffset    = 0x1c4
+	dyldCacheCacheSubTypeOffset   = 0x1c8
+)
+
+// A DyldCacheMapping is a range of the address space of a dyld shared cache
+// mapped from one of its files.
+type DyldCacheMapping struct {
+	Address    uint64
+	Size       uint64
+	FileOffset uint64
+	MaxProt    uint32
+	InitProt   uint32
+}
+
+// A DyldCacheImage is a dylib of a dyld shared cache. An image may be listed
+// more than once under different install names.
+type DyldCacheImage struct {
+	Name    string
+	Address uint64
+	ModTime uint64
+	Inode   uint64
+}
+
+type dyldCacheImageInfo struct {
+	Address        uint64
+	ModTime        uint64
+	Inode          uint64
+	PathFileOffset uint32
+	Pad            uint32
+}
+
+// A DyldSubCache is a file of a split dyld shared cache, found next to the
+// main cache file with Suffix appended to its name.
+type DyldSubCache struct {
+	UUID     [16]byte
+	VMOffset uint64 // from the start of the cache
+	Suffix   string
+}
+
+type dyldCacheLocalSymbolsInfo struct {
+	NlistOffset   uint32
+	NlistCount    uint32
+	StringsOffset uint32
+	StringsSize   uint32
+	EntriesOffset uint32
+	EntriesCount  uint32
+}
+
+// dyldCacheFile is the main file of a cache or one of its sub-caches.
+type dyldCacheFile struct {
+	r        io.ReaderAt
+	hdr      dyldCacheHeader
+	mappings []DyldCacheMapping
+}
+
+// A DyldCache represents an open dyld shared cache.
+type DyldCache struct {
+	Magic     string // such as "dyld_v1  x86_64h"
+	UUID      [16]byte
+	Platform  uint32
+	Mappings  []DyldCacheMapping // of the main cache, then of each sub-cache
+	Images    []DyldCacheImage
+	SubCaches []DyldSubCache
+
+	files   []*dyldCacheFile
+	symbols *dyldCacheFile // where the local symbols are, if known
+	closers []io.Closer
+}
+
+// readDyldCacheFile reads the header and mappings of a cache file.
+func readDyldCacheFile(r io.ReaderAt) (*dyldCacheFile, error) {
+	var magic [16]byte
+	if _, err := r.ReadAt(magic[:], 0); err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(magic[:], []byte("dyld_v1 ")) {
+		return nil, &FormatError{0, "invalid dyld shared cache magic", cstring(magic[:])}
+	}
+	cf := &dyldCacheFile{r: r}
+	size := binary.Size(cf.hdr)
+	hdrdat := make([]byte, size)
+	if _, err := r.ReadAt(hdrdat[:20], 0); err != nil {
+		return nil, err
+	}
+	// the mappings follow the header, so their offset is its size
+	if n := int(binary.LittleEndian.Uint32(hdrdat[16:])); n < size {
+		size = n
+	}
+	if _, err := r.ReadAt(hdrdat[:size], 0); err != nil {
+		return nil, err
+	}
+	binary.Read(bytes.NewReader(hdrdat), binary.LittleEndian, &cf.hdr)
+
+	cf.mappings = make([]DyldCacheMapping, cf.hdr.MappingCount)
+	sr := io.NewSectionReader(r, int64(cf.hdr.MappingOffset), int64(cf.hdr.MappingCount)*int64(binary.Size(DyldCacheMapping{})))
+	if err := binary.Read(sr, binary.LittleEndian, cf.mappings); err != nil {
+		return nil, &FormatError{int64(cf.hdr.MappingOffset), "invalid dyld shared cache mappings", err}
+	}
+	return cf, nil
+}
+
+// readCString reads a NUL-terminated string at off.
+func readCString(r io.ReaderAt, off int64) (string, error) {
+	var s []byte
+	buf := make([]byte, 256)
+	for {
+		n, err := r.ReadAt(buf, off)
+		if i := bytes.IndexByte(buf[:n], 0); i >= 0 {
+			return string(append(s, buf[:i]...)), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		s = append(s, buf[:n]...)
+		off += int64(n)
+	}
+}
+
+// NewDyldCache creates a new DyldCache for accessing a dyld shared cache in an
+// underlying reader. The sub-caches of a split cache are not read, so the
+// images they hold cannot be read either; use OpenDyldCache for those.
+func NewDyldCache(r io.ReaderAt) (*DyldCache, error) {
+	main, err := readDyldCacheFile(r)
+	if err != nil {
+		return nil, err
+	}
+	hdr := &main.hdr
+	c := &DyldCache{
+		Magic:    strings.TrimRight(string(hdr.Magic[:]), "\x00"),
+		UUID:     hdr.UUID,
+		Platform: hdr.Platform,
+		Mappings: main.mappings,
+		files:    []*dyldCacheFile{main},
+	}
+	if hdr.LocalSymbolsSize > 0 {
+		c.symbols = main
+	}
+
+	imagesOffset, imagesCount := hdr.ImagesOffsetOld, hdr.ImagesCountOld
+	if hdr.MappingOffset > dyldCacheImagesCountOffset {
+		imagesOffset, imagesCount = hdr.ImagesOffset, hdr.ImagesCount
+	}
+	infos := make([]dyldCacheImageInfo, imagesCount)
+	sr := io.NewSectionReader(r, int64(imagesOffset), int64(imagesCount)*int64(binary.Size(dyldCacheImageInfo{})))
+	if err := binary.Read(sr, binary.LittleEndian, infos); err != nil {
+		return nil, &FormatError{int64(imagesOffset), "invalid dyld shared cache images", err}
+	}
+	c.Images = make([]DyldCacheImage, len(infos))
+	for i, info := range infos {
+		name, err := readCString(r, int64(info.PathFileOffset))
+		if err != nil {
+			return nil, &FormatError{int64(info.PathFileOffset), "invalid dyld shared cache image path", err}
+		}
+		c.Images[i] = DyldCacheImage{Name: name, Address: info.Address, ModTime: info.ModTime, Inode: info.Inode}
+	}
+
+	// caches before the ones with a cache sub type have numbered sub-caches
+	// without a suffix of their own
+	c.SubCaches = make([]DyldSubCache, hdr.SubCacheArrayCount)
+	off := int64(hdr.SubCacheArrayOffset)
+	for i := range c.SubCaches {
+		sc := &c.SubCaches[i]
+		if hdr.MappingOffset <= dyldCacheCacheSubTypeOffset {
+			var entry struct {
+				UUID     [16]byte
+				VMOffset uint64
+			}
+			if err := binary.Read(io.NewSectionReader(r, off, 24), binary.LittleEndian, &entry); err != nil {
+				return nil, &FormatError{off, "invalid dyld shared cache sub-cache", err}
+			}
+			sc.UUID, sc.VMOffset, sc.Suffix = entry.UUID, entry.VMOffset, fmt.Sprintf(".%d", i+1)
+			off += 24
+			continue
+		}
+		var entry struct {
+			UUID       [16]byte
+			VMOffset   uint64
+			FileSuffix [32]byte
+		}
+		if err := binary.Read(io.NewSectionReader(r, off, 56), binary.LittleEndian, &entry); err != nil {
+			return nil, &FormatError{off, "invalid dyld shared cache sub-cache", err}
+		}
+		sc.UUID, sc.VMOffset, sc.Suffix = entry.UUID, entry.VMOffset, cstring(entry.FileSuffix[:])
+		off += 56
+	}
+	return c, nil
+}
+
+// OpenDyldCache opens the named dyld shared cache using os.Open, along with
+// its sub-caches and symbols file, which are found next to it.
+func OpenDyldCache(name string) (*DyldCache, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewDyldCache(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	c.closers = append(c.closers, f)
+
+	open := func(suffix string, uuid [16]byte) (*dyldCacheFile, error) {
+		sf, err := os.Open(name + suffix)
+		if err != nil {
+			return nil, err
+		}
+		c.closers = append(c.closers, sf)
+		cf, err := readDyldCacheFile(sf)
+		if err != nil {
+			return nil, fmt.Errorf("%s%s: %v", name, suffix, err)
+		}
+		if cf.hdr.UUID != uuid {
+			return nil, fmt.Errorf("%s%s: uuid %x does not match the one of the main cache, %x", name, suffix, cf.hdr.UUID, uuid)
+		}
+		return cf, nil
+	}
+	for _, sc := range c.SubCaches {
+		cf, err := open(sc.Suffix, sc.UUID)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.files = append(c.files, cf)
+		c.Mappings = append(c.Mappings, cf.mappings...)
+	}
+	if uuid := c.files[0].hdr.SymbolFileUUID; uuid != ([16]byte{}) {
+		// the local symbols are not needed for anything else, so the
+		// cache is still usable without them
+		if cf, err := open(".symbols", uuid); err == nil {
+			c.symbols = cf
+		}
+	}
+	return c, nil
+}
+
+// Close closes the files of the cache opened by OpenDyldCache.
+func (c *DyldCache) Close() error {
+	var err error
+	for _, cl := range c.closers {
+		if e := cl.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	c.closers = nil
+	return err
+}
+
+// ReadAddr reads len(p) bytes at the address addr of the cache.
+func (c *DyldCache) ReadAddr(p []byte, addr uint64) (int, error) {
+	n := 0
+	for n < len(p) {
+		a := addr + uint64(n)
+		var read bool
+		for _, cf := range c.files {
+			for _, m := range cf.mappings {
+				if a < m.Address || a-m.Address >= m.Size {
+					continue
+				}
+				chunk := p[n:]
+				if rest := m.Size - (a - m.Address); uint64(len(chunk)) > rest {
+					chunk = chunk[:rest]
+				}
+				k, err := cf.r.ReadAt(chunk, int64(m.FileOffset+a-m.Address))
+				n += k
+				if err != nil {
+					return n, err
+				}
+				read = true
+				break
+			}
+			if read {
+				break
+			}
+		}
+		if !read {
+			return n, fmt.Errorf("address 0x%x is not mapped by the cache", a)
+		}
+	}
+	return n, nil
+}
+
+// image returns the address of the image with the given install name.
+func (c *DyldCache) image(installName string) (uint64, error) {
+	for _, img := range c.Images {
+		if img.Name == installName {
+			return img.Address, nil
+		}
+	}
+	return 0, fmt.Errorf("no image %s in the cache", installName)
+}
+
+// dyldCacheImageReader reads an image of a cache by file offset, as the
+// image's load commands give them, through the address space of the cache.
+type dyldCacheImageReader struct {
+	c      *DyldCache
+	addr   uint64 // of the mach header
+	hdrEnd uint64 // of the load commands
+	segs   []Segment
+}
+
+func (r *dyldCacheImageReader) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		o := uint64(off) + uint64(n)
+		var addr, avail uint64
+		if o < r.hdrEnd {
+			addr, avail = r.addr+o, r.hdrEnd-o
+		} else {
+			for _, s := range r.segs {
+				if o >= s.Offset && o-s.Offset < s.Filesz {
+					addr, avail = s.Addr+o-s.Offset, s.Filesz-(o-s.Offset)
+					break
+				}
+			}
+			if avail == 0 {
+				return n, fmt.Errorf("offset 0x%x is not part of any segment of the image", o)
+			}
+		}
+		chunk := p[n:]
+		if uint64(len(chunk)) > avail {
+			chunk = chunk[:avail]
+		}
+		k, err := r.c.ReadAddr(chunk, addr)
+		n += k
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Image returns the image with the given install name, read through the
+// address space of the cache. Its symbol table is the one left in the cache;
+// the local symbols that were removed from it are returned by LocalSymbols.
+func (c *DyldCache) Image(installName string) (*File, error) {
+	addr, err := c.image(installName)
+	if err != nil {
+		return nil, err
+	}
+	var hdr [fileHeaderSize64]byte
+	if _, err := c.ReadAddr(hdr[:], addr); err != nil {
+		return nil, err
+	}
+	magic := binary.LittleEndian.Uint32(hdr[:])
+	hdrSize := uint64(fileHeaderSize32)
+	switch magic {
+	case Magic64:
+		hdrSize = fileHeaderSize64
+	case Magic32:
+	default:
+		return nil, fmt.Errorf("image %s has an invalid magic number 0x%x", installName, magic)
+	}
+	ncmd, cmdsz := binary.LittleEndian.Uint32(hdr[16:]), binary.LittleEndian.Uint32(hdr[20:])
+	cmds := make([]byte, cmdsz)
+	if _, err := c.ReadAddr(cmds, addr+hdrSize); err != nil {
+		return nil, err
+	}
+
+	r := &dyldCacheImageReader{c: c, addr: addr, hdrEnd: hdrSize + uint64(cmdsz)}
+	for i := uint32(0); i < ncmd && len(cmds) >= 8; i++ {
+		cmd, siz := LoadCmd(binary.LittleEndian.Uint32(cmds)), binary.LittleEndian.Uint32(cmds[4:])
+		if siz < 8 || siz > uint32(len(cmds)) {
+			return nil, fmt.Errorf("image %s has an invalid command block size", installName)
+		}
+		b := bytes.NewReader(cmds[:siz])
+		switch cmd {
+		case LoadCmdSegment:
+			var seg32 Segment32
+			if err := binary.Read(b, binary.LittleEndian, &seg32); err != nil {
+				return nil, err
+			}
+			r.segs = append(r.segs, Segment{SegmentHeader: SegmentHeader{Addr: uint64(seg32.Addr), Offset: uint64(seg32.Offset), Filesz: uint64(seg32.Filesz)}})
+		case LoadCmdSegment64:
+			var seg64 Segment64
+			if err := binary.Read(b, binary.LittleEndian, &seg64); err != nil {
+				return nil, err
+			}
+			r.segs = append(r.segs, Segment{SegmentHeader: SegmentHeader{Addr: seg64.Addr, Offset: seg64.Offset, Filesz: seg64.Filesz}})
+		}
+		cmds = cmds[siz:]
+	}
+	return NewFile(r)
+}
+
+// LocalSymbols returns the local symbols of the image with the given install
+// name, which the cache keeps apart from the symbol table of the image.
+func (c *DyldCache) LocalSymbols(installName string) ([]Symbol, error) {
+	addr, err := c.image(installName)
+	if err != nil {
+		return nil, err
+	}
+	cf := c.symbols
+	if cf == nil {
+		return nil, errors.New("cache has no local symbols")
+	}
+	base := int64(cf.hdr.LocalSymbolsOffset)
+	var info dyldCacheLocalSymbolsInfo
+	if err := binary.Read(io.NewSectionReader(cf.r, base, int64(binary.Size(info))), binary.LittleEndian, &info); err != nil {
+		return nil, &FormatError{base, "invalid dyld shared cache local symbols", err}
+	}
+
+	// split caches identify images by their offset in the address space,
+	// older ones by their offset in the main file
+	main := c.files[0]
+	var dylibOffset uint64
+	wide := main.hdr.MappingOffset >= dyldCacheSymbolFileUUIDOffset
+	if wide {
+		dylibOffset = addr - main.mappings[0].Address
+	} else {
+		found := false
+		for _, m := range main.mappings {
+			if addr >= m.Address && addr-m.Address < m.Size {
+				dylibOffset, found = m.FileOffset+addr-m.Address, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("image %s is not in the main cache file", installName)
+		}
+	}
+
+	var start, count uint32
+	found := false
+	entries := io.NewSectionReader(cf.r, base+int64(info.EntriesOffset), 1<<62)
+	for i := uint32(0); i < info.EntriesCount && !found; i++ {
+		var off uint64
+		if wide {
+			var e struct {
+				DylibOffset     uint64
+				NlistStartIndex uint32
+				NlistCount      uint32
+			}
+			if err := binary.Read(entries, binary.LittleEndian, &e); err != nil {
+				return nil, err
+			}
+			off, start, count = e.DylibOffset, e.NlistStartIndex, e.NlistCount
+		} else {
+			var e struct {
+				DylibOffset     uint32
+				NlistStartIndex uint32
+				NlistCount      uint32
+			}
+			if err := binary.Read(entries, binary.LittleEndian, &e); err != nil {
+				return nil, err
+			}
+			off, start, count = uint64(e.DylibOffset), e.NlistStartIndex, e.NlistCount
+		}
+		found = off == dylibOffset
+	}
+	if !found {
+		return nil, nil
+	}
+	if uint64(start)+uint64(count) > uint64(info.NlistCount) {
+		return nil, &FormatError{base, "local symbols extend past the symbol table", installName}
+	}
+
+	strtab := make([]byte, info.StringsSize)
+	if _, err := cf.r.ReadAt(strtab, base+int64(info.StringsOffset)); err != nil {
+		return nil, err
+	}
+	// 32-bit caches have 32-bit symbols
+	nlistSize := 16
+	if strings.HasSuffix(c.Magic, "i386") || strings.HasSuffix(c.Magic, "armv7") ||
+		strings.HasSuffix(c.Magic, "armv7k") || strings.HasSuffix(c.Magic, "armv7s") || strings.HasSuffix(c.Magic, "arm64_32") {
+		nlistSize = 12
+	}
+	symdat := make([]byte, int(count)*nlistSize)
+	if _, err := cf.r.ReadAt(symdat, base+int64(info.NlistOffset)+int64(start)*int64(nlistSize)); err != nil {
+		return nil, err
+	}
+	syms := make([]Symbol, count)
+	for i := range syms {
+		d := symdat[i*nlistSize:]
+		var n Nlist64
+		if nlistSize == 16 {
+			binary.Read(bytes.NewReader(d), binary.LittleEndian, &n)
+		} else {
+			var n32 Nlist32
+			binary.Read(bytes.NewReader(d), binary.LittleEndian, &n32)
+			n = Nlist64{Name: n32.Name, Type: n32.Type, Sect: n32.Sect, Desc: n32.Desc, Value: uint64(n32.Value)}
+		}
+		if n.Name >= uint32(len(strtab)) {
+			return nil, &FormatError{base, "invalid name in local symbols", n.Name}
+		}
+		syms[i] = Symbol{Name: cstring(strtab[n.Name:]), Type: n.Type, Sect: n.Sect, Desc: n.Desc, Value: n.Value}
+	}
+	return syms, nil
+}
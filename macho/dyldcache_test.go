@@ -0,0 +1,138 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// dyldCacheTestFile builds a cache file with the given header, mappings and
+// extra data at fixed offsets.
+func dyldCacheTestFile(hdr dyldCacheHeader, mappings []DyldCacheMapping, extra map[int][]byte) []byte {
+	copy(hdr.Magic[:], "dyld_v1  x86_64h")
+	hdr.MappingOffset = 0x200
+	hdr.MappingCount = uint32(len(mappings))
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, &hdr)
+	buf.Write(make([]byte, 0x200-buf.Len()))
+	binary.Write(&buf, binary.LittleEndian, mappings)
+	dat := buf.Bytes()
+	for off, b := range extra {
+		if end := off + len(b); end > len(dat) {
+			dat = append(dat, make([]byte, end-len(dat))...)
+		}
+		copy(dat[off:], b)
+	}
+	return dat
+}
+
+func TestDyldCache(t *testing.T) {
+	const name = "/usr/lib/libtest.dylib"
+	image, err := ioutil.ReadFile("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "dyldcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cache := filepath.Join(dir, "dyld_shared_cache_x86_64h")
+
+	// the main cache holds __TEXT, the sub-cache the rest of the image
+	subUUID, symUUID := [16]byte{1}, [16]byte{2}
+	var images, subs bytes.Buffer
+	binary.Write(&images, binary.LittleEndian, &dyldCacheImageInfo{Address: 0x100000000, PathFileOffset: 0x240})
+	sub := struct {
+		UUID       [16]byte
+		VMOffset   uint64
+		FileSuffix [32]byte
+	}{UUID: subUUID, VMOffset: 0x1000}
+	copy(sub.FileSuffix[:], ".01")
+	binary.Write(&subs, binary.LittleEndian, &sub)
+	main := dyldCacheTestFile(
+		dyldCacheHeader{UUID: [16]byte{3}, ImagesOffset: 0x220, ImagesCount: 1, SubCacheArrayOffset: 0x280, SubCacheArrayCount: 1, SymbolFileUUID: symUUID},
+		[]DyldCacheMapping{{Address: 0x100000000, Size: 0x1000, FileOffset: 0x1000, MaxProt: 5, InitProt: 5}},
+		map[int][]byte{0x220: images.Bytes(), 0x240: []byte(name + "\x00"), 0x280: subs.Bytes(), 0x1000: image[:0x1000]},
+	)
+	subcache := dyldCacheTestFile(
+		dyldCacheHeader{UUID: subUUID},
+		[]DyldCacheMapping{{Address: 0x100001000, Size: uint64(len(image) - 0x1000), FileOffset: 0x1000, MaxProt: 3, InitProt: 3}},
+		map[int][]byte{0x1000: image[0x1000:]},
+	)
+
+	// one local symbol for the image, at the start of the cache
+	var locals bytes.Buffer
+	binary.Write(&locals, binary.LittleEndian, &dyldCacheLocalSymbolsInfo{NlistOffset: 0x18, NlistCount: 1, StringsOffset: 0x28, StringsSize: 16, EntriesOffset: 0x38, EntriesCount: 1})
+	binary.Write(&locals, binary.LittleEndian, &Nlist64{Name: 1, Type: N_SECT, Sect: 1, Value: 0x100000f70})
+	locals.WriteString("\x00_local_helper\x00\x00")
+	binary.Write(&locals, binary.LittleEndian, []uint64{0, 1 << 32})
+	symbols := dyldCacheTestFile(dyldCacheHeader{UUID: symUUID, LocalSymbolsOffset: 0x1000, LocalSymbolsSize: uint64(locals.Len())}, nil, map[int][]byte{0x1000: locals.Bytes()})
+
+	for suffix, dat := range map[string][]byte{"": main, ".01": subcache, ".symbols": symbols} {
+		if err := ioutil.WriteFile(cache+suffix, dat, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := OpenDyldCache(cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.Magic != "dyld_v1  x86_64h" || len(c.Mappings) != 2 {
+		t.Errorf("cache is %s with mappings %+v", c.Magic, c.Mappings)
+	}
+	if want := []DyldSubCache{{UUID: subUUID, VMOffset: 0x1000, Suffix: ".01"}}; !reflect.DeepEqual(c.SubCaches, want) {
+		t.Errorf("sub-caches are %+v, want %+v", c.SubCaches, want)
+	}
+	if want := []DyldCacheImage{{Name: name, Address: 0x100000000}}; !reflect.DeepEqual(c.Images, want) {
+		t.Errorf("images are %+v, want %+v", c.Images, want)
+	}
+
+	f, err := c.Image(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer want.Close()
+	if !reflect.DeepEqual(f.Symtab.Syms, want.Symtab.Syms) {
+		t.Errorf("symbols are %+v, want %+v", f.Symtab.Syms, want.Symtab.Syms)
+	}
+	for _, s := range want.Sections {
+		have, err := f.Section(s.Name).Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dat, _ := s.Data(); !bytes.Equal(have, dat) {
+			t.Errorf("section %s differs from the one of the image", s.Name)
+		}
+	}
+
+	syms, err := c.LocalSymbols(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Symbol{{Name: "_local_helper", Type: N_SECT, Sect: 1, Value: 0x100000f70}}; !reflect.DeepEqual(syms, want) {
+		t.Errorf("local symbols are %+v, want %+v", syms, want)
+	}
+	if _, err := c.Image("/usr/lib/libmissing.dylib"); err == nil {
+		t.Error("missing image was found")
+	}
+
+	// without its sub-cache, only the __TEXT of the image can be read
+	nc, err := NewDyldCache(bytes.NewReader(main))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nc.Image(name); err == nil {
+		t.Error("image was read without its sub-cache")
+	}
+}
@@ -0,0 +1,649 @@
+package macho
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Rebase types
+const (
+	REBASE_TYPE_POINTER         = 1
+	REBASE_TYPE_TEXT_ABSOLUTE32 = 2
+	REBASE_TYPE_TEXT_PCREL32    = 3
+)
+
+// Rebase opcodes
+const (
+	REBASE_OPCODE_MASK                               = 0xF0
+	REBASE_IMMEDIATE_MASK                            = 0x0F
+	REBASE_OPCODE_DONE                               = 0x00
+	REBASE_OPCODE_SET_TYPE_IMM                       = 0x10
+	REBASE_OPCODE_SET_SEGMENT_AND_OFFSET_ULEB        = 0x20
+	REBASE_OPCODE_ADD_ADDR_ULEB                      = 0x30
+	REBASE_OPCODE_ADD_ADDR_IMM_SCALED                = 0x40
+	REBASE_OPCODE_DO_REBASE_IMM_TIMES                = 0x50
+	REBASE_OPCODE_DO_REBASE_ULEB_TIMES               = 0x60
+	REBASE_OPCODE_DO_REBASE_ADD_ADDR_ULEB            = 0x70
+	REBASE_OPCODE_DO_REBASE_ULEB_TIMES_SKIPPING_ULEB = 0x80
+)
+
+// Bind types
+const (
+	BIND_TYPE_POINTER         = 1
+	BIND_TYPE_TEXT_ABSOLUTE32 = 2
+	BIND_TYPE_TEXT_PCREL32    = 3
+)
+
+// Special dylib ordinals of binds
+const (
+	BIND_SPECIAL_DYLIB_SELF            = 0
+	BIND_SPECIAL_DYLIB_MAIN_EXECUTABLE = -1
+	BIND_SPECIAL_DYLIB_FLAT_LOOKUP     = -2
+	BIND_SPECIAL_DYLIB_WEAK_LOOKUP     = -3
+)
+
+// Bind symbol flags
+const (
+	BIND_SYMBOL_FLAGS_WEAK_IMPORT         = 0x1
+	BIND_SYMBOL_FLAGS_NON_WEAK_DEFINITION = 0x8
+)
+
+// Bind opcodes
+const (
+	BIND_OPCODE_MASK                             = 0xF0
+	BIND_IMMEDIATE_MASK                          = 0x0F
+	BIND_OPCODE_DONE                             = 0x00
+	BIND_OPCODE_SET_DYLIB_ORDINAL_IMM            = 0x10
+	BIND_OPCODE_SET_DYLIB_ORDINAL_ULEB           = 0x20
+	BIND_OPCODE_SET_DYLIB_SPECIAL_IMM            = 0x30
+	BIND_OPCODE_SET_SYMBOL_TRAILING_FLAGS_IMM    = 0x40
+	BIND_OPCODE_SET_TYPE_IMM                     = 0x50
+	BIND_OPCODE_SET_ADDEND_SLEB                  = 0x60
+	BIND_OPCODE_SET_SEGMENT_AND_OFFSET_ULEB      = 0x70
+	BIND_OPCODE_ADD_ADDR_ULEB                    = 0x80
+	BIND_OPCODE_DO_BIND                          = 0x90
+	BIND_OPCODE_DO_BIND_ADD_ADDR_ULEB            = 0xA0
+	BIND_OPCODE_DO_BIND_ADD_ADDR_IMM_SCALED      = 0xB0
+	BIND_OPCODE_DO_BIND_ULEB_TIMES_SKIPPING_ULEB = 0xC0
+	BIND_OPCODE_THREADED                         = 0xD0
+)
+
+// Rebase - a slot that dyld slides by the load address of the image
+type Rebase struct {
+	Type      uint8
+	SegIndex  int    // index of the segment among the segment commands
+	SegOffset uint64 // offset of the slot from the start of the segment
+}
+
+// Bind - a slot that dyld sets to the address of a symbol, plus an addend
+type Bind struct {
+	Type      uint8
+	SegIndex  int // -1 for strong definitions of the weak binding stream, which have no slot
+	SegOffset uint64
+	Ordinal   int // 1-based index of the dylib among the dylib commands, or a BIND_SPECIAL_DYLIB_* value
+	Name      string
+	Flags     uint8
+	Addend    int64
+}
+
+// dyldStream reads an opcode stream, tracking the position for errors.
+type dyldStream struct {
+	dat []byte
+	pos int
+}
+
+func (s *dyldStream) uleb() (uint64, error) {
+	v, n, err := readULEB128(s.dat[s.pos:])
+	if err != nil {
+		return 0, fmt.Errorf("at offset 0x%x: %v", s.pos, err)
+	}
+	s.pos += n
+	return v, nil
+}
+
+func (s *dyldStream) sleb() (int64, error) {
+	v, n, err := readSLEB128(s.dat[s.pos:])
+	if err != nil {
+		return 0, fmt.Errorf("at offset 0x%x: %v", s.pos, err)
+	}
+	s.pos += n
+	return v, nil
+}
+
+func (s *dyldStream) cstring() (string, error) {
+	i := bytes.IndexByte(s.dat[s.pos:], 0)
+	if i < 0 {
+		return "", fmt.Errorf("at offset 0x%x: unterminated symbol name", s.pos)
+	}
+	name := string(s.dat[s.pos : s.pos+i])
+	s.pos += i + 1
+	return name, nil
+}
+
+// checkRun checks that count slots of ptr bytes, skip bytes apart, starting
+// at offset off of segment seg, all lie in the segment. Repeat counts come
+// from the opcode stream, so this is also what bounds them.
+func checkRun(segSizes []uint64, seg int, off, count, skip, ptr uint64) error {
+	if count == 0 {
+		return nil
+	}
+	if seg < 0 || seg >= len(segSizes) {
+		return fmt.Errorf("segment %d does not exist", seg)
+	}
+	size := segSizes[seg]
+	if off > size || ptr > size-off {
+		return fmt.Errorf("slot at offset 0x%x is past the end of segment %d", off, seg)
+	}
+	if count > 1 && (skip > size || (count-1) > (size-off-ptr)/(skip+ptr)) {
+		return fmt.Errorf("%d slots from offset 0x%x extend past the end of segment %d", count, off, seg)
+	}
+	return nil
+}
+
+// segmentSizes returns the memory size of each segment, by index among the
+// segment commands.
+func (f *File) segmentSizes() []uint64 {
+	var sizes []uint64
+	for _, l := range f.Loads {
+		if seg, ok := l.(*Segment); ok {
+			sizes = append(sizes, seg.Memsz)
+		}
+	}
+	return sizes
+}
+
+// DecodeRebases interprets a rebase opcode stream for pointers of ptrSize
+// bytes. segSizes gives the size of each segment, by index among the segment
+// commands; rebasing a slot outside of them is an error.
+func DecodeRebases(dat []byte, ptrSize int, segSizes []uint64) ([]Rebase, error) {
+	var rebases []Rebase
+	s := &dyldStream{dat: dat}
+	r := Rebase{Type: REBASE_TYPE_POINTER}
+	ptr := uint64(ptrSize)
+	do := func(count, skip uint64) error {
+		if err := checkRun(segSizes, r.SegIndex, r.SegOffset, count, skip, ptr); err != nil {
+			return fmt.Errorf("at offset 0x%x: %v", s.pos, err)
+		}
+		for i := uint64(0); i < count; i++ {
+			rebases = append(rebases, r)
+			r.SegOffset += skip + ptr
+		}
+		return nil
+	}
+	for s.pos < len(dat) {
+		op := dat[s.pos] & REBASE_OPCODE_MASK
+		imm := dat[s.pos] & REBASE_IMMEDIATE_MASK
+		s.pos++
+		switch op {
+		case REBASE_OPCODE_DONE:
+			return rebases, nil
+		case REBASE_OPCODE_SET_TYPE_IMM:
+			r.Type = imm
+		case REBASE_OPCODE_SET_SEGMENT_AND_OFFSET_ULEB:
+			off, err := s.uleb()
+			if err != nil {
+				return nil, err
+			}
+			r.SegIndex, r.SegOffset = int(imm), off
+		case REBASE_OPCODE_ADD_ADDR_ULEB:
+			delta, err := s.uleb()
+			if err != nil {
+				return nil, err
+			}
+			r.SegOffset += delta
+		case REBASE_OPCODE_ADD_ADDR_IMM_SCALED:
+			r.SegOffset += uint64(imm) * ptr
+		case REBASE_OPCODE_DO_REBASE_IMM_TIMES:
+			if err := do(uint64(imm), 0); err != nil {
+				return nil, err
+			}
+		case REBASE_OPCODE_DO_REBASE_ULEB_TIMES:
+			count, err := s.uleb()
+			if err != nil {
+				return nil, err
+			}
+			if err := do(count, 0); err != nil {
+				return nil, err
+			}
+		case REBASE_OPCODE_DO_REBASE_ADD_ADDR_ULEB:
+			skip, err := s.uleb()
+			if err != nil {
+				return nil, err
+			}
+			if err := do(1, skip); err != nil {
+				return nil, err
+			}
+		case REBASE_OPCODE_DO_REBASE_ULEB_TIMES_SKIPPING_ULEB:
+			count, err := s.uleb()
+			if err != nil {
+				return nil, err
+			}
+			skip, err := s.uleb()
+			if err != nil {
+				return nil, err
+			}
+			if err := do(count, skip); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unknown rebase opcode 0x%x at offset 0x%x", op, s.pos-1)
+		}
+	}
+	return rebases, nil
+}
+
+// EncodeRebases builds a rebase opcode stream for pointers of ptrSize bytes,
+// sorting the rebases by segment and offset.
+func EncodeRebases(rebases []Rebase, ptrSize int) []byte {
+	rs := append([]Rebase(nil), rebases...)
+	sort.SliceStable(rs, func(i, j int) bool {
+		if rs[i].SegIndex != rs[j].SegIndex {
+			return rs[i].SegIndex < rs[j].SegIndex
+		}
+		return rs[i].SegOffset < rs[j].SegOffset
+	})
+	ptr := uint64(ptrSize)
+	var b []byte
+	typ := uint8(0)
+	seg, off := -1, uint64(0) // where the next rebase would happen
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		if r.Type != typ {
+			typ = r.Type
+			b = append(b, REBASE_OPCODE_SET_TYPE_IMM|typ&REBASE_IMMEDIATE_MASK)
+		}
+		switch delta := r.SegOffset - off; {
+		case r.SegIndex != seg || r.SegOffset < off:
+			b = append(b, REBASE_OPCODE_SET_SEGMENT_AND_OFFSET_ULEB|byte(r.SegIndex)&REBASE_IMMEDIATE_MASK)
+			b = appendULEB128(b, r.SegOffset)
+		case delta == 0:
+		case delta%ptr == 0 && delta/ptr <= REBASE_IMMEDIATE_MASK:
+			b = append(b, REBASE_OPCODE_ADD_ADDR_IMM_SCALED|byte(delta/ptr))
+		default:
+			b = append(b, REBASE_OPCODE_ADD_ADDR_ULEB)
+			b = appendULEB128(b, delta)
+		}
+		seg = r.SegIndex
+
+		// count the following rebases at a constant stride
+		same := func(j int) bool { return rs[j].SegIndex == r.SegIndex && rs[j].Type == r.Type }
+		n := 1
+		stride := uint64(0)
+		if i+1 < len(rs) && same(i+1) && rs[i+1].SegOffset >= r.SegOffset+ptr {
+			stride = rs[i+1].SegOffset - r.SegOffset
+			for n = 2; i+n < len(rs) && same(i+n) && rs[i+n].SegOffset-rs[i+n-1].SegOffset == stride; n++ {
+			}
+		}
+		switch {
+		case n > 1 && stride == ptr && n <= REBASE_IMMEDIATE_MASK:
+			b = append(b, REBASE_OPCODE_DO_REBASE_IMM_TIMES|byte(n))
+		case n > 1 && stride == ptr:
+			b = append(b, REBASE_OPCODE_DO_REBASE_ULEB_TIMES)
+			b = appendULEB128(b, uint64(n))
+		case n > 2:
+			b = append(b, REBASE_OPCODE_DO_REBASE_ULEB_TIMES_SKIPPING_ULEB)
+			b = appendULEB128(b, uint64(n))
+			b = appendULEB128(b, stride-ptr)
+		case stride != 0:
+			// rebase and move on to the next one in one opcode
+			n = 1
+			b = append(b, REBASE_OPCODE_DO_REBASE_ADD_ADDR_ULEB)
+			b = appendULEB128(b, stride-ptr)
+		default:
+			n = 1
+			b = append(b, REBASE_OPCODE_DO_REBASE_IMM_TIMES|1)
+		}
+		if n == 1 {
+			off = r.SegOffset + stride
+			if stride == 0 {
+				off = r.SegOffset + ptr
+			}
+		} else {
+			off = r.SegOffset + uint64(n)*stride
+		}
+		i += n
+	}
+	return append(b, REBASE_OPCODE_DONE)
+}
+
+// DecodeBinds interprets a bind opcode stream for pointers of ptrSize bytes.
+// In lazy streams BIND_OPCODE_DONE ends each entry rather than the stream. In
+// weak streams, symbols flagged BIND_SYMBOL_FLAGS_NON_WEAK_DEFINITION are
+// reported once, with a SegIndex of -1. segSizes gives the size of each
+// segment, as for DecodeRebases.
+func DecodeBinds(dat []byte, ptrSize int, segSizes []uint64, lazy, weak bool) ([]Bind, error) {
+	var binds []Bind
+	s := &dyldStream{dat: dat}
+	ptr := uint64(ptrSize)
+	b := Bind{Type: BIND_TYPE_POINTER}
+	do := func(count, skip uint64) error {
+		if err := checkRun(segSizes, b.SegIndex, b.SegOffset, count, skip, ptr); err != nil {
+			return fmt.Errorf("at offset 0x%x: %v", s.pos, err)
+		}
+		for i := uint64(0); i < count; i++ {
+			binds = append(binds, b)
+			b.SegOffset += skip + ptr
+		}
+		return nil
+	}
+	for s.pos < len(dat) {
+		op := dat[s.pos] & BIND_OPCODE_MASK
+		imm := dat[s.pos] & BIND_IMMEDIATE_MASK
+		s.pos++
+		switch op {
+		case BIND_OPCODE_DONE:
+			if !lazy {
+				return binds, nil
+			}
+			// dyld decodes each lazy entry on its own
+			b = Bind{Type: BIND_TYPE_POINTER}
+		case BIND_OPCODE_SET_DYLIB_ORDINAL_IMM:
+			b.Ordinal = int(imm)
+		case BIND_OPCODE_SET_DYLIB_ORDINAL_ULEB:
+			ord, err := s.uleb()
+			if err != nil {
+				return nil, err
+			}
+			b.Ordinal = int(ord)
+		case BIND_OPCODE_SET_DYLIB_SPECIAL_IMM:
+			b.Ordinal = 0
+			if imm != 0 {
+				b.Ordinal = int(int8(BIND_OPCODE_MASK | imm))
+			}
+		case BIND_OPCODE_SET_SYMBOL_TRAILING_FLAGS_IMM:
+			name, err := s.cstring()
+			if err != nil {
+				return nil, err
+			}
+			b.Name, b.Flags = name, imm
+			if weak && imm&BIND_SYMBOL_FLAGS_NON_WEAK_DEFINITION != 0 {
+				strong := b
+				strong.SegIndex, strong.SegOffset = -1, 0
+				binds = append(binds, strong)
+			}
+		case BIND_OPCODE_SET_TYPE_IMM:
+			b.Type = imm
+		case BIND_OPCODE_SET_ADDEND_SLEB:
+			addend, err := s.sleb()
+			if err != nil {
+				return nil, err
+			}
+			b.Addend = addend
+		case BIND_OPCODE_SET_SEGMENT_AND_OFFSET_ULEB:
+			off, err := s.uleb()
+			if err != nil {
+				return nil, err
+			}
+			b.SegIndex, b.SegOffset = int(imm), off
+		case BIND_OPCODE_ADD_ADDR_ULEB:
+			delta, err := s.uleb()
+			if err != nil {
+				return nil, err
+			}
+			b.SegOffset += delta
+		case BIND_OPCODE_DO_BIND:
+			if err := do(1, 0); err != nil {
+				return nil, err
+			}
+		case BIND_OPCODE_DO_BIND_ADD_ADDR_ULEB:
+			skip, err := s.uleb()
+			if err != nil {
+				return nil, err
+			}
+			if err := do(1, skip); err != nil {
+				return nil, err
+			}
+		case BIND_OPCODE_DO_BIND_ADD_ADDR_IMM_SCALED:
+			if err := do(1, uint64(imm)*ptr); err != nil {
+				return nil, err
+			}
+		case BIND_OPCODE_DO_BIND_ULEB_TIMES_SKIPPING_ULEB:
+			count, err := s.uleb()
+			if err != nil {
+				return nil, err
+			}
+			skip, err := s.uleb()
+			if err != nil {
+				return nil, err
+			}
+			if err := do(count, skip); err != nil {
+				return nil, err
+			}
+		case BIND_OPCODE_THREADED:
+			return nil, errors.New("threaded binds are not supported")
+		default:
+			return nil, fmt.Errorf("unknown bind opcode 0x%x at offset 0x%x", op, s.pos-1)
+		}
+	}
+	return binds, nil
+}
+
+// bindEncoder emits bind opcodes, only changing the state that differs from
+// the previous bind.
+type bindEncoder struct {
+	b       []byte
+	ptr     uint64
+	bind    Bind
+	started bool
+}
+
+func (e *bindEncoder) setSymbol(b Bind, ordinal bool) {
+	if ordinal && (!e.started || b.Ordinal != e.bind.Ordinal) {
+		switch {
+		case b.Ordinal <= 0:
+			e.b = append(e.b, BIND_OPCODE_SET_DYLIB_SPECIAL_IMM|byte(b.Ordinal)&BIND_IMMEDIATE_MASK)
+		case b.Ordinal <= BIND_IMMEDIATE_MASK:
+			e.b = append(e.b, BIND_OPCODE_SET_DYLIB_ORDINAL_IMM|byte(b.Ordinal))
+		default:
+			e.b = append(e.b, BIND_OPCODE_SET_DYLIB_ORDINAL_ULEB)
+			e.b = appendULEB128(e.b, uint64(b.Ordinal))
+		}
+	}
+	if !e.started || b.Name != e.bind.Name || b.Flags != e.bind.Flags {
+		e.b = append(e.b, BIND_OPCODE_SET_SYMBOL_TRAILING_FLAGS_IMM|b.Flags&BIND_IMMEDIATE_MASK)
+		e.b = append(e.b, b.Name...)
+		e.b = append(e.b, 0)
+	}
+	if !e.started && b.Type != BIND_TYPE_POINTER || e.started && b.Type != e.bind.Type {
+		e.b = append(e.b, BIND_OPCODE_SET_TYPE_IMM|b.Type&BIND_IMMEDIATE_MASK)
+	}
+	if !e.started && b.Addend != 0 || e.started && b.Addend != e.bind.Addend {
+		e.b = append(e.b, BIND_OPCODE_SET_ADDEND_SLEB)
+		e.b = appendSLEB128(e.b, b.Addend)
+	}
+	if !e.started {
+		e.bind.SegIndex = -1
+	}
+	e.started = true
+	e.bind.Ordinal, e.bind.Name, e.bind.Flags, e.bind.Type, e.bind.Addend = b.Ordinal, b.Name, b.Flags, b.Type, b.Addend
+}
+
+// setAddress moves to the slot of b.
+func (e *bindEncoder) setAddress(b Bind) {
+	switch delta := b.SegOffset - e.bind.SegOffset; {
+	case b.SegIndex != e.bind.SegIndex || b.SegOffset < e.bind.SegOffset:
+		e.b = append(e.b, BIND_OPCODE_SET_SEGMENT_AND_OFFSET_ULEB|byte(b.SegIndex)&BIND_IMMEDIATE_MASK)
+		e.b = appendULEB128(e.b, b.SegOffset)
+	case delta != 0:
+		e.b = append(e.b, BIND_OPCODE_ADD_ADDR_ULEB)
+		e.b = appendULEB128(e.b, delta)
+	}
+	e.bind.SegIndex, e.bind.SegOffset = b.SegIndex, b.SegOffset
+}
+
+// sameSymbol reports whether a and b only differ by their slot.
+func sameSymbol(a, b Bind) bool {
+	return a.Ordinal == b.Ordinal && a.Name == b.Name && a.Flags == b.Flags && a.Type == b.Type && a.Addend == b.Addend
+}
+
+// encodeBinds emits binds in order, binding consecutive slots of a symbol
+// with the opcodes that also advance the address.
+func encodeBinds(binds []Bind, ptrSize int, ordinal bool) []byte {
+	e := &bindEncoder{ptr: uint64(ptrSize)}
+	for i, b := range binds {
+		if b.SegIndex < 0 {
+			// a strong definition overriding weak ones, which has no slot
+			e.setSymbol(b, ordinal)
+			continue
+		}
+		e.setSymbol(b, ordinal)
+		e.setAddress(b)
+		next := e.bind.SegOffset + e.ptr
+		if i+1 < len(binds) && sameSymbol(b, binds[i+1]) && binds[i+1].SegIndex == b.SegIndex && binds[i+1].SegOffset >= next {
+			skip := binds[i+1].SegOffset - next
+			if skip%e.ptr == 0 && skip/e.ptr <= BIND_IMMEDIATE_MASK {
+				e.b = append(e.b, BIND_OPCODE_DO_BIND_ADD_ADDR_IMM_SCALED|byte(skip/e.ptr))
+			} else {
+				e.b = append(e.b, BIND_OPCODE_DO_BIND_ADD_ADDR_ULEB)
+				e.b = appendULEB128(e.b, skip)
+			}
+			e.bind.SegOffset = next + skip
+			continue
+		}
+		e.b = append(e.b, BIND_OPCODE_DO_BIND)
+		e.bind.SegOffset = next
+	}
+	return append(e.b, BIND_OPCODE_DONE)
+}
+
+// sortBinds sorts binds by symbol, as ld does, so that the symbol state
+// changes as little as possible, and then by address.
+func sortBinds(binds []Bind) []Bind {
+	bs := append([]Bind(nil), binds...)
+	sort.SliceStable(bs, func(i, j int) bool {
+		a, b := bs[i], bs[j]
+		switch {
+		case a.Ordinal != b.Ordinal:
+			return a.Ordinal < b.Ordinal
+		case a.Name != b.Name:
+			return a.Name < b.Name
+		case a.Flags != b.Flags:
+			return a.Flags < b.Flags
+		case a.Type != b.Type:
+			return a.Type < b.Type
+		case a.Addend != b.Addend:
+			return a.Addend < b.Addend
+		case a.SegIndex != b.SegIndex:
+			return a.SegIndex < b.SegIndex
+		}
+		return a.SegOffset < b.SegOffset
+	})
+	return bs
+}
+
+// EncodeBinds builds a bind opcode stream for pointers of ptrSize bytes.
+func EncodeBinds(binds []Bind, ptrSize int) []byte {
+	return encodeBinds(sortBinds(binds), ptrSize, true)
+}
+
+// EncodeWeakBinds builds a weak bind opcode stream for pointers of ptrSize
+// bytes. Dylib ordinals are not encoded, weak symbols being looked up in all
+// images, and strong definitions come first.
+func EncodeWeakBinds(binds []Bind, ptrSize int) []byte {
+	bs := make([]Bind, len(binds))
+	for i, b := range binds {
+		b.Ordinal = 0
+		bs[i] = b
+	}
+	bs = sortBinds(bs)
+	sort.SliceStable(bs, func(i, j int) bool { return bs[i].SegIndex < 0 && bs[j].SegIndex >= 0 })
+	return encodeBinds(bs, ptrSize, false)
+}
+
+// EncodeLazyBinds builds a lazy bind opcode stream for pointers of ptrSize
+// bytes. Each bind is encoded on its own, in order, and the offset of each
+// entry in the stream, which the stub helpers of the image push, is returned.
+func EncodeLazyBinds(binds []Bind, ptrSize int) ([]byte, []uint32) {
+	var b []byte
+	offsets := make([]uint32, len(binds))
+	for i, bind := range binds {
+		offsets[i] = uint32(len(b))
+		e := &bindEncoder{ptr: uint64(ptrSize), bind: Bind{SegIndex: -1}}
+		e.setAddress(Bind{SegIndex: bind.SegIndex, SegOffset: bind.SegOffset})
+		e.setSymbol(bind, true)
+		b = append(b, e.b...)
+		b = append(b, BIND_OPCODE_DO_BIND, BIND_OPCODE_DONE)
+	}
+	return b, offsets
+}
+
+func (f *File) dylinkInfo() (*DylinkInfo, error) {
+	if f.DylinkInfo == nil {
+		return nil, errors.New("file has no dyld info")
+	}
+	return f.DylinkInfo, nil
+}
+
+// Rebases decodes the rebase opcodes of the dyld info.
+func (f *File) Rebases() ([]Rebase, error) {
+	di, err := f.dylinkInfo()
+	if err != nil {
+		return nil, err
+	}
+	return DecodeRebases(di.RebaseDat, int(f.ptrSize()), f.segmentSizes())
+}
+
+// Binds decodes the bind opcodes of the dyld info.
+func (f *File) Binds() ([]Bind, error) {
+	di, err := f.dylinkInfo()
+	if err != nil {
+		return nil, err
+	}
+	return DecodeBinds(di.BindingInfoDat, int(f.ptrSize()), f.segmentSizes(), false, false)
+}
+
+// LazyBinds decodes the lazy bind opcodes of the dyld info.
+func (f *File) LazyBinds() ([]Bind, error) {
+	di, err := f.dylinkInfo()
+	if err != nil {
+		return nil, err
+	}
+	return DecodeBinds(di.LazyBindingDat, int(f.ptrSize()), f.segmentSizes(), true, false)
+}
+
+// WeakBinds decodes the weak bind opcodes of the dyld info.
+func (f *File) WeakBinds() ([]Bind, error) {
+	di, err := f.dylinkInfo()
+	if err != nil {
+		return nil, err
+	}
+	return DecodeBinds(di.WeakBindingDat, int(f.ptrSize()), f.segmentSizes(), false, true)
+}
+
+// SetRebases replaces the rebase opcodes of the dyld info.
+func (f *File) SetRebases(rebases []Rebase) error {
+	di, err := f.dylinkInfo()
+	if err != nil {
+		return err
+	}
+	di.RebaseDat = f.padDyldInfo(EncodeRebases(rebases, int(f.ptrSize())))
+	return nil
+}
+
+// SetBinds replaces the bind opcodes of the dyld info.
+func (f *File) SetBinds(binds []Bind) error {
+	di, err := f.dylinkInfo()
+	if err != nil {
+		return err
+	}
+	di.BindingInfoDat = f.padDyldInfo(EncodeBinds(binds, int(f.ptrSize())))
+	return nil
+}
+
+// SetWeakBinds replaces the weak bind opcodes of the dyld info.
+func (f *File) SetWeakBinds(binds []Bind) error {
+	di, err := f.dylinkInfo()
+	if err != nil {
+		return err
+	}
+	di.WeakBindingDat = f.padDyldInfo(EncodeWeakBinds(binds, int(f.ptrSize())))
+	return nil
+}
+
+// padDyldInfo pads an opcode stream with BIND_OPCODE_DONE/REBASE_OPCODE_DONE
+// to the pointer size, as ld does.
+func (f *File) padDyldInfo(b []byte) []byte {
+	return append(b, make([]byte, alignUp(uint64(len(b)), f.ptrSize())-uint64(len(b)))...)
+}
@@ -0,0 +1,154 @@
+package macho
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDyldInfoRoundTrip(t *testing.T) {
+	for _, name := range []string{"testdata/clang-386-darwin-exec-with-rpath", "testdata/clang-amd64-darwin-exec-with-rpath"} {
+		f, err := Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ptrSize := int(f.ptrSize())
+		rebases, err := f.Rebases()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := DecodeRebases(EncodeRebases(rebases, ptrSize), ptrSize, f.segmentSizes())
+		if err != nil || len(got) != len(rebases) {
+			t.Fatalf("%s: rebases %v, %v after round trip, want %v", name, got, err, rebases)
+		}
+		// rebases are encoded by segment and offset
+		for _, r := range rebases {
+			found := false
+			for _, g := range got {
+				found = found || g == r
+			}
+			if !found {
+				t.Errorf("%s: rebase %v lost in round trip", name, r)
+			}
+		}
+		binds, err := f.Binds()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		want := []Bind{{Type: BIND_TYPE_POINTER, SegIndex: 2, Ordinal: 1, Name: "dyld_stub_binder"}}
+		if !reflect.DeepEqual(binds, want) {
+			t.Errorf("%s: binds are %v, want %v", name, binds, want)
+		}
+		lazy, err := f.LazyBinds()
+		if err != nil || len(lazy) != 1 || lazy[0].Name != "_printf" {
+			t.Fatalf("%s: lazy binds are %v, %v", name, lazy, err)
+		}
+		dat, offsets := EncodeLazyBinds(lazy, ptrSize)
+		if got, err := DecodeBinds(dat, ptrSize, f.segmentSizes(), true, false); err != nil || !reflect.DeepEqual(got, lazy) || !reflect.DeepEqual(offsets, []uint32{0}) {
+			t.Errorf("%s: lazy binds %v, %v at %v after round trip, want %v", name, got, err, offsets, lazy)
+		}
+
+		// move the binder to another slot and write the file back
+		binds[0].SegOffset = 0x100
+		if err := f.SetBinds(binds); err != nil {
+			t.Fatal(err)
+		}
+		out, err := f.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := NewFile(bytes.NewReader(out))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := g.Binds(); err != nil || !reflect.DeepEqual(got, binds) {
+			t.Errorf("%s: binds are %v, %v after rewriting, want %v", name, got, err, binds)
+		}
+		if got, err := g.LazyBinds(); err != nil || !reflect.DeepEqual(got, lazy) {
+			t.Errorf("%s: lazy binds are %v, %v after rewriting, want %v", name, got, err, lazy)
+		}
+		f.Close()
+	}
+}
+
+func TestDyldInfoEncoding(t *testing.T) {
+	var rebases []Rebase
+	for i := 0; i < 20; i++ {
+		rebases = append(rebases, Rebase{REBASE_TYPE_POINTER, 2, uint64(i * 8)}) // contiguous
+	}
+	for i := 0; i < 4; i++ {
+		rebases = append(rebases, Rebase{REBASE_TYPE_POINTER, 2, uint64(0x1000 + i*24)}) // strided
+	}
+	rebases = append(rebases,
+		Rebase{REBASE_TYPE_POINTER, 2, 0x2000},
+		Rebase{REBASE_TYPE_POINTER, 2, 0x3000},
+		Rebase{REBASE_TYPE_TEXT_ABSOLUTE32, 3, 0x10},
+	)
+	segs := []uint64{0, 0, 0x4000, 0x1000}
+	got, err := DecodeRebases(EncodeRebases(rebases, 8), 8, segs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, rebases) {
+		t.Errorf("rebases are %v after round trip, want %v", got, rebases)
+	}
+
+	binds := []Bind{
+		{Type: BIND_TYPE_POINTER, SegIndex: 2, SegOffset: 0x20, Ordinal: BIND_SPECIAL_DYLIB_FLAT_LOOKUP, Name: "_flat"},
+		{Type: BIND_TYPE_POINTER, SegIndex: 2, SegOffset: 0x0, Ordinal: 1, Name: "_a"},
+		{Type: BIND_TYPE_POINTER, SegIndex: 2, SegOffset: 0x8, Ordinal: 1, Name: "_a"},
+		{Type: BIND_TYPE_POINTER, SegIndex: 2, SegOffset: 0x400, Ordinal: 1, Name: "_a"},
+		{Type: BIND_TYPE_POINTER, SegIndex: 3, SegOffset: 0x10, Ordinal: 20, Name: "_b", Addend: -8, Flags: BIND_SYMBOL_FLAGS_WEAK_IMPORT},
+	}
+	got2, err := DecodeBinds(EncodeBinds(binds, 8), 8, segs, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := sortBinds(binds); !reflect.DeepEqual(got2, want) {
+		t.Errorf("binds are %v after round trip, want %v", got2, want)
+	}
+
+	weak := []Bind{
+		{Type: BIND_TYPE_POINTER, SegIndex: 2, SegOffset: 0x8, Name: "__ZdlPv"},
+		{Type: BIND_TYPE_POINTER, SegIndex: -1, Name: "__Znwm", Flags: BIND_SYMBOL_FLAGS_NON_WEAK_DEFINITION},
+	}
+	got2, err = DecodeBinds(EncodeWeakBinds(weak, 8), 8, segs, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Bind{weak[1], weak[0]}; !reflect.DeepEqual(got2, want) {
+		t.Errorf("weak binds are %v after round trip, want %v", got2, want)
+	}
+
+	dat, offsets := EncodeLazyBinds(binds, 8)
+	for i, off := range offsets {
+		got, err := DecodeBinds(dat[off:], 8, segs, false, false)
+		if err != nil || len(got) != 1 || !reflect.DeepEqual(got[0], binds[i]) {
+			t.Errorf("lazy bind at offset %d is %v, %v, want %v", off, got, err, binds[i])
+		}
+	}
+}
+
+func TestDyldInfoBadRuns(t *testing.T) {
+	huge := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}
+	segs := []uint64{0, 0, 0x1000}
+	for _, dat := range [][]byte{
+		append([]byte{REBASE_OPCODE_SET_SEGMENT_AND_OFFSET_ULEB | 2, 0, REBASE_OPCODE_DO_REBASE_ULEB_TIMES}, huge...),
+		append([]byte{REBASE_OPCODE_SET_SEGMENT_AND_OFFSET_ULEB | 2, 0, REBASE_OPCODE_DO_REBASE_ULEB_TIMES_SKIPPING_ULEB}, append(huge, 0)...),
+		{REBASE_OPCODE_SET_SEGMENT_AND_OFFSET_ULEB | 2, 0x80, 0x20, REBASE_OPCODE_DO_REBASE_IMM_TIMES | 1},
+		{REBASE_OPCODE_SET_SEGMENT_AND_OFFSET_ULEB | 5, 0, REBASE_OPCODE_DO_REBASE_IMM_TIMES | 1},
+	} {
+		if got, err := DecodeRebases(dat, 8, segs); err == nil {
+			t.Errorf("rebases %x decoded to %d entries, want error", dat, len(got))
+		}
+	}
+	for _, dat := range [][]byte{
+		append([]byte{BIND_OPCODE_SET_SEGMENT_AND_OFFSET_ULEB | 2, 0, BIND_OPCODE_DO_BIND_ULEB_TIMES_SKIPPING_ULEB}, append(huge, 0)...),
+		append([]byte{BIND_OPCODE_SET_SEGMENT_AND_OFFSET_ULEB | 2, 0, BIND_OPCODE_DO_BIND_ULEB_TIMES_SKIPPING_ULEB, 2}, huge...),
+		{BIND_OPCODE_SET_SEGMENT_AND_OFFSET_ULEB | 2, 0x80, 0x20, BIND_OPCODE_DO_BIND},
+	} {
+		if got, err := DecodeBinds(dat, 8, segs, false, false); err == nil {
+			t.Errorf("binds %x decoded to %d entries, want error", dat, len(got))
+		}
+	}
+}
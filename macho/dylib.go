@@ -0,0 +1,327 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// headerPadding returns the number of free bytes between the end of the load
+// commands and the first data in the file, which new load commands can use.
+func (f *File) headerPadding() uint64 {
+	end := uint64(fileHeaderSize32)
+	if f.Magic == Magic64 {
+		end = fileHeaderSize64
+	}
+	for _, l := range f.Loads {
+		end += uint64(len(l.Raw()))
+	}
+	end += uint64(len(f.Insertion))
+
+	first := ^uint64(0)
+	for _, s := range f.Sections {
+		if isZerofill(s.Flags) || s.Size == 0 {
+			continue
+		}
+		if uint64(s.Offset) < first {
+			first = uint64(s.Offset)
+		}
+	}
+	for _, l := range f.Loads {
+		if seg, ok := l.(*Segment); ok && seg.Offset > 0 && seg.Filesz > 0 && seg.Offset < first {
+			first = seg.Offset
+		}
+	}
+	if first < end {
+		return 0
+	}
+	return first - end
+}
+
+// encodeCmd builds a load command made of the fixed part hdr followed by the
+// string s, padded so that the command size is a multiple of the pointer size.
+// The Len field of hdr, which must follow Cmd, is filled in.
+func (f *File) encodeCmd(hdr interface{}, s string) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, f.ByteOrder, hdr)
+	buf.WriteString(s)
+	buf.WriteByte(0)
+	buf.Write(make([]byte, alignUp(uint64(buf.Len()), f.ptrSize())-uint64(buf.Len())))
+	raw := buf.Bytes()
+	f.ByteOrder.PutUint32(raw[4:], uint32(len(raw)))
+	return raw
+}
+
+func (f *File) newDylib(cmd LoadCmd, name string, time, currentVersion, compatVersion uint32) *Dylib {
+	hdr := DylibCmd{Cmd: cmd, Name: uint32(binary.Size(DylibCmd{})), Time: time, CurrentVersion: currentVersion, CompatVersion: compatVersion}
+	return &Dylib{
+		LoadBytes:      f.encodeCmd(&hdr, name),
+		Cmd:            cmd,
+		Name:           name,
+		Time:           time,
+		CurrentVersion: currentVersion,
+		CompatVersion:  compatVersion,
+	}
+}
+
+// insertLoad inserts l before Loads[idx], if it fits in the header padding.
+func (f *File) insertLoad(idx int, l Load) error {
+	size := uint64(len(l.Raw()))
+	if room := f.headerPadding(); size > room {
+		return fmt.Errorf("not enough room for a %d byte load command, %d bytes left before the first section", size, room)
+	}
+	f.Loads = append(f.Loads, nil)
+	copy(f.Loads[idx+1:], f.Loads[idx:])
+	f.Loads[idx] = l
+	f.Ncmd++
+	f.Cmdsz += uint32(size)
+	return nil
+}
+
+// removeLoad removes Loads[idx].
+func (f *File) removeLoad(idx int) {
+	f.Ncmd--
+	f.Cmdsz -= uint32(len(f.Loads[idx].Raw()))
+	f.Loads = append(f.Loads[:idx], f.Loads[idx+1:]...)
+}
+
+// AddDylib adds a command loading the dylib at path after the other dylib
+// commands, as a weak import if weak is set. Versions are encoded as
+// xxxx.yy.zz, e.g. 0x10000 for 1.0.0.
+func (f *File) AddDylib(path string, weak bool, currentVersion, compatVersion uint32) error {
+	cmd := LoadCmdDylib
+	if weak {
+		cmd = LoadCmdWeakDylib
+	}
+	idx := len(f.Loads)
+	for i, l := range f.Loads {
+		if lib, ok := l.(*Dylib); ok {
+			if lib.Name == path && lib.Cmd != LoadCmdIdDylib {
+				return fmt.Errorf("dylib %s is already loaded", path)
+			}
+			idx = i + 1
+		}
+	}
+	// dylibs are recorded with a fixed timestamp, as ld does
+	return f.insertLoad(idx, f.newDylib(cmd, path, 2, currentVersion, compatVersion))
+}
+
+// RemoveDylib removes the commands loading the dylib at path. Binds, chained
+// fixup imports, re-exports and two-level symbols refer to dylibs by their load
+// order, so the ordinals of the later dylibs are renumbered. It fails without
+// changing f if anything still refers to the removed dylib.
+func (f *File) RemoveDylib(path string) error {
+	var removed []int
+	ordinal := 0
+	for _, l := range f.Loads {
+		if lib, ok := l.(*Dylib); ok && lib.Cmd != LoadCmdIdDylib {
+			ordinal++
+			if lib.Name == path {
+				removed = append(removed, ordinal)
+			}
+		}
+	}
+	if len(removed) == 0 {
+		return fmt.Errorf("dylib %s is not loaded", path)
+	}
+	renumber := func(ordinal int) (int, error) {
+		if ordinal <= 0 { // BIND_SPECIAL_DYLIB_*
+			return ordinal, nil
+		}
+		n := ordinal
+		for _, r := range removed {
+			if r == ordinal {
+				return 0, fmt.Errorf("dylib %s is still referred to by ordinal %d", path, ordinal)
+			}
+			if r < ordinal {
+				n--
+			}
+		}
+		return n, nil
+	}
+	apply, err := f.renumberDylibs(renumber)
+	if err != nil {
+		return err
+	}
+	for _, fn := range apply {
+		fn()
+	}
+
+	for i := 0; i < len(f.Loads); i++ {
+		if lib, ok := f.Loads[i].(*Dylib); ok && lib.Name == path && lib.Cmd != LoadCmdIdDylib {
+			f.removeLoad(i)
+			i--
+		}
+	}
+	return nil
+}
+
+// renumberDylibs maps the dylib ordinals referred to by the dyld info, the
+// chained fixups, the export trie and the symbol table through renumber. It
+// returns the changes to make rather than making them, so that nothing is
+// changed if any ordinal cannot be mapped.
+func (f *File) renumberDylibs(renumber func(int) (int, error)) ([]func(), error) {
+	var apply []func()
+	ptrSize := int(f.ptrSize())
+
+	renumberBinds := func(binds []Bind) (bool, error) {
+		changed := false
+		for i := range binds {
+			n, err := renumber(binds[i].Ordinal)
+			if err != nil {
+				return false, fmt.Errorf("bind of %s: %v", binds[i].Name, err)
+			}
+			changed = changed || n != binds[i].Ordinal
+			binds[i].Ordinal = n
+		}
+		return changed, nil
+	}
+
+	if di := f.DylinkInfo; di != nil {
+		binds, err := f.Binds()
+		if err != nil {
+			return nil, err
+		}
+		if changed, err := renumberBinds(binds); err != nil {
+			return nil, err
+		} else if changed {
+			dat := f.padDyldInfo(EncodeBinds(binds, ptrSize))
+			apply = append(apply, func() { di.BindingInfoDat = dat })
+		}
+
+		// the stub helpers push the offsets of the lazy bind entries, so the
+		// entries are only rewritten if none of them moves
+		lazy, err := f.LazyBinds()
+		if err != nil {
+			return nil, err
+		}
+		old, oldOffsets := EncodeLazyBinds(lazy, ptrSize)
+		if changed, err := renumberBinds(lazy); err != nil {
+			return nil, err
+		} else if changed {
+			dat, offsets := EncodeLazyBinds(lazy, ptrSize)
+			if !bytes.HasPrefix(di.LazyBindingDat, old) || len(dat) != len(old) || !reflect.DeepEqual(offsets, oldOffsets) {
+				return nil, errors.New("lazy binds cannot be renumbered without moving their entries")
+			}
+			dat = append(dat, di.LazyBindingDat[len(dat):]...)
+			apply = append(apply, func() { di.LazyBindingDat = dat })
+		}
+	}
+
+	if led := f.chainedFixups(); led != nil {
+		cf, err := f.ChainedFixups()
+		if err != nil {
+			return nil, err
+		}
+		changed := false
+		for i := range cf.Imports {
+			imp := &cf.Imports[i]
+			n, err := renumber(imp.LibOrdinal)
+			if err != nil {
+				return nil, fmt.Errorf("chained fixup import of %s: %v", imp.Name, err)
+			}
+			changed = changed || n != imp.LibOrdinal
+			imp.LibOrdinal = n
+		}
+		if changed {
+			dat, err := encodeChainedFixups(cf, cf.Starts, f.segmentCount())
+			if err != nil {
+				return nil, err
+			}
+			apply = append(apply, func() { led.RawDat = dat })
+		}
+	}
+
+	entries, err := f.ExportTrie()
+	if err != nil {
+		return nil, err
+	}
+	changed := false
+	for i := range entries {
+		e := &entries[i]
+		if e.Flags&EXPORT_SYMBOL_FLAGS_REEXPORT == 0 {
+			continue
+		}
+		n, err := renumber(int(e.DylibOrdinal))
+		if err != nil {
+			return nil, fmt.Errorf("re-export of %s: %v", e.Name, err)
+		}
+		changed = changed || uint64(n) != e.DylibOrdinal
+		e.DylibOrdinal = uint64(n)
+	}
+	if changed {
+		trie := BuildExportTrie(entries)
+		trie = append(trie, make([]byte, alignUp(uint64(len(trie)), f.ptrSize())-uint64(len(trie)))...)
+		dat := f.exportTrie()
+		apply = append(apply, func() { *dat = trie })
+	}
+
+	// undefined symbols of two-level namespace images keep the ordinal of
+	// their dylib in the high byte of n_desc
+	if st := f.Symtab; st != nil && f.Flags&FlagTwoLevel != 0 {
+		for i := range st.Syms {
+			s := &st.Syms[i]
+			if symbolPartition(s) != symUndef {
+				continue
+			}
+			lib := int(s.Desc >> 8)
+			if lib == 0 || lib >= 0xfe { // SELF, DYNAMIC_LOOKUP or EXECUTABLE
+				continue
+			}
+			n, err := renumber(lib)
+			if err != nil {
+				return nil, fmt.Errorf("symbol %s: %v", s.Name, err)
+			}
+			if n != lib {
+				desc := s.Desc&0xff | uint16(n)<<8
+				apply = append(apply, func() { s.Desc = desc })
+			}
+		}
+	}
+	return apply, nil
+}
+
+// AddRpath adds an LC_RPATH command for path at the end of the load commands.
+func (f *File) AddRpath(path string) error {
+	for _, l := range f.Loads {
+		if rpath, ok := l.(*Rpath); ok && rpath.Path == path {
+			return fmt.Errorf("rpath %s already exists", path)
+		}
+	}
+	hdr := RpathCmd{Cmd: LoadCmdRpath, Path: uint32(binary.Size(RpathCmd{}))}
+	l := &Rpath{LoadBytes: f.encodeCmd(&hdr, path), Path: path}
+	return f.insertLoad(len(f.Loads), l)
+}
+
+// RemoveRpath removes the LC_RPATH command for path.
+func (f *File) RemoveRpath(path string) error {
+	for i, l := range f.Loads {
+		if rpath, ok := l.(*Rpath); ok && rpath.Path == path {
+			f.removeLoad(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("rpath %s does not exist", path)
+}
+
+// SetInstallName changes the install name of a dylib, the name recorded in
+// its LC_ID_DYLIB command.
+func (f *File) SetInstallName(name string) error {
+	for i, l := range f.Loads {
+		lib, ok := l.(*Dylib)
+		if !ok || lib.Cmd != LoadCmdIdDylib {
+			continue
+		}
+		id := f.newDylib(LoadCmdIdDylib, name, lib.Time, lib.CurrentVersion, lib.CompatVersion)
+		if grow := len(id.LoadBytes) - len(lib.LoadBytes); grow > 0 && uint64(grow) > f.headerPadding() {
+			return fmt.Errorf("not enough room to grow the install name command by %d bytes", grow)
+		}
+		f.Cmdsz += uint32(len(id.LoadBytes))
+		f.Cmdsz -= uint32(len(lib.LoadBytes))
+		f.Loads[i] = id
+		return nil
+	}
+	return errors.New("file has no install name, it is not a dylib")
+}
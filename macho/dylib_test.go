@@ -0,0 +1,182 @@
+package macho
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEditDylibs(t *testing.T) {
+	for _, name := range []string{"testdata/clang-amd64-darwin-exec-with-rpath", "testdata/clang-386-darwin-exec-with-rpath"} {
+		f, err := Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.AddDylib("@rpath/libfoo.dylib", true, 0x10203, 0x10000); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.AddRpath("@loader_path/../lib"); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.RemoveRpath("/my/rpath"); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.RemoveRpath("/my/rpath"); err == nil {
+			t.Errorf("%s: removing a missing rpath succeeded", name)
+		}
+
+		data, err := f.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := NewFile(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g.Ncmd != f.Ncmd || g.Cmdsz != f.Cmdsz {
+			t.Errorf("%s: header has %d commands of %d bytes, want %d of %d", name, g.Ncmd, g.Cmdsz, f.Ncmd, f.Cmdsz)
+		}
+		libs, _ := g.ImportedLibraries()
+		if want := []string{"/usr/lib/libSystem.B.dylib", "@rpath/libfoo.dylib"}; !reflect.DeepEqual(libs, want) {
+			t.Errorf("%s: imported libraries are %q, want %q", name, libs, want)
+		}
+		var rpaths []string
+		for _, l := range g.Loads {
+			switch l := l.(type) {
+			case *Rpath:
+				rpaths = append(rpaths, l.Path)
+			case *Dylib:
+				if l.Name == "@rpath/libfoo.dylib" && (l.Cmd != LoadCmdWeakDylib || l.CurrentVersion != 0x10203) {
+					t.Errorf("%s: added dylib is %v version 0x%x", name, l.Cmd, l.CurrentVersion)
+				}
+			}
+			if len(l.Raw())%int(g.ptrSize()) != 0 {
+				t.Errorf("%s: load command of %d bytes is not padded", name, len(l.Raw()))
+			}
+		}
+		if want := []string{"@loader_path/../lib"}; !reflect.DeepEqual(rpaths, want) {
+			t.Errorf("%s: rpaths are %q, want %q", name, rpaths, want)
+		}
+
+		if err := g.RemoveDylib("@rpath/libfoo.dylib"); err != nil {
+			t.Fatal(err)
+		}
+		if libs, _ := g.ImportedLibraries(); len(libs) != 1 {
+			t.Errorf("%s: imported libraries are %q after removing one", name, libs)
+		}
+
+		// commands are only added while there is room for them
+		long := strings.Repeat("x", 512)
+		var added int
+		for ; g.AddRpath(long+string(rune('a'+added))) == nil; added++ {
+		}
+		if added == 0 || g.headerPadding() >= uint64(len(long)) {
+			t.Errorf("%s: %d rpaths were added, %d bytes are left", name, added, g.headerPadding())
+		}
+		if _, err := g.Bytes(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		f.Close()
+	}
+}
+
+func TestSetInstallName(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.SetInstallName("libfoo.dylib"); err == nil {
+		t.Fatal("executable has an install name")
+	}
+	if err := f.insertLoad(len(f.Loads), f.newDylib(LoadCmdIdDylib, "libfoo.dylib", 1, 0x10000, 0x10000)); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetInstallName("@rpath/Frameworks/Foo.framework/Versions/A/Foo"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := g.Loads[len(g.Loads)-1].(*Dylib)
+	if id.Cmd != LoadCmdIdDylib || id.Name != "@rpath/Frameworks/Foo.framework/Versions/A/Foo" || id.Time != 1 {
+		t.Errorf("install name command is %v %q time %d", id.Cmd, id.Name, id.Time)
+	}
+	if libs, _ := g.ImportedLibraries(); len(libs) != 1 {
+		t.Errorf("install name is reported as an imported library: %q", libs)
+	}
+}
+
+func TestRemoveDylibRenumbers(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	wantBinds, _ := f.Binds()
+	wantLazy, _ := f.LazyBinds()
+	wantSyms := append([]Symbol(nil), f.Symtab.Syms...)
+
+	// load libbar first, moving libSystem to ordinal 2
+	idx := -1
+	for i, l := range f.Loads {
+		if _, ok := l.(*Dylib); ok && idx < 0 {
+			idx = i
+		}
+	}
+	if err := f.insertLoad(idx, f.newDylib(LoadCmdDylib, "@rpath/libbar.dylib", 2, 0x10000, 0x10000)); err != nil {
+		t.Fatal(err)
+	}
+	apply, err := f.renumberDylibs(func(ordinal int) (int, error) { return ordinal + 1, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fn := range apply {
+		fn()
+	}
+	if binds, _ := f.Binds(); binds[0].Ordinal != 2 {
+		t.Fatalf("bind ordinal is %d after renumbering, want 2", binds[0].Ordinal)
+	}
+	if lazy, _ := f.LazyBinds(); lazy[0].Ordinal != 2 {
+		t.Fatalf("lazy bind ordinal is %d after renumbering, want 2", lazy[0].Ordinal)
+	}
+	for _, s := range f.Symtab.Syms {
+		if symbolPartition(&s) == symUndef && s.Desc>>8 != 2 {
+			t.Fatalf("symbol %s has library ordinal %d after renumbering, want 2", s.Name, s.Desc>>8)
+		}
+	}
+
+	if err := f.RemoveDylib("/usr/lib/libSystem.B.dylib"); err == nil {
+		t.Error("removed a dylib that is still bound to")
+	}
+	if libs, _ := f.ImportedLibraries(); len(libs) != 2 {
+		t.Errorf("imported libraries are %q after a failed removal", libs)
+	}
+	if err := f.RemoveDylib("@rpath/libbar.dylib"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binds, _ := g.Binds(); !reflect.DeepEqual(binds, wantBinds) {
+		t.Errorf("binds are %+v, want %+v", binds, wantBinds)
+	}
+	if lazy, _ := g.LazyBinds(); !reflect.DeepEqual(lazy, wantLazy) {
+		t.Errorf("lazy binds are %+v, want %+v", lazy, wantLazy)
+	}
+	if !reflect.DeepEqual(g.Symtab.Syms, wantSyms) {
+		t.Errorf("symbols are %+v, want %+v", g.Symtab.Syms, wantSyms)
+	}
+}
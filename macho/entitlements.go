@@ -0,0 +1,217 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DecodeEntitlements decodes the XML entitlements blob, a property list
+// dictionary. Values are bool, int64, float64, string, []byte, time.Time,
+// []interface{} and map[string]interface{}.
+func (cs *CodeSignature) DecodeEntitlements() (map[string]interface{}, error) {
+	if len(cs.Entitlements) < 8 {
+		return nil, errors.New("code signature has no entitlements")
+	}
+	d := xml.NewDecoder(bytes.NewReader(cs.Entitlements[8:]))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, fmt.Errorf("fail to decode entitlements: %v", err)
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Local == "plist" {
+			continue
+		}
+		v, err := plistValue(d, se)
+		if err != nil {
+			return nil, fmt.Errorf("fail to decode entitlements: %v", err)
+		}
+		dict, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("entitlements are not a dictionary")
+		}
+		return dict, nil
+	}
+}
+
+// plistValue decodes the property list value started by se.
+func plistValue(d *xml.Decoder, se xml.StartElement) (interface{}, error) {
+	switch se.Name.Local {
+	case "dict":
+		dict := make(map[string]interface{})
+		key := ""
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := tok.(type) {
+			case xml.EndElement:
+				return dict, nil
+			case xml.StartElement:
+				if t.Name.Local == "key" {
+					var k string
+					if err := d.DecodeElement(&k, &t); err != nil {
+						return nil, err
+					}
+					key = k
+					continue
+				}
+				v, err := plistValue(d, t)
+				if err != nil {
+					return nil, err
+				}
+				dict[key] = v
+			}
+		}
+	case "array":
+		array := []interface{}{}
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := tok.(type) {
+			case xml.EndElement:
+				return array, nil
+			case xml.StartElement:
+				v, err := plistValue(d, t)
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, v)
+			}
+		}
+	case "true", "false":
+		if err := d.Skip(); err != nil {
+			return nil, err
+		}
+		return se.Name.Local == "true", nil
+	}
+
+	var s string
+	if err := d.DecodeElement(&s, &se); err != nil {
+		return nil, err
+	}
+	switch se.Name.Local {
+	case "string":
+		return s, nil
+	case "integer":
+		return strconv.ParseInt(strings.TrimSpace(s), 0, 64)
+	case "real":
+		return strconv.ParseFloat(strings.TrimSpace(s), 64)
+	case "data":
+		return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+	case "date":
+		return time.Parse(time.RFC3339, strings.TrimSpace(s))
+	}
+	return nil, fmt.Errorf("unknown property list element <%s>", se.Name.Local)
+}
+
+// DER entitlements tags
+const (
+	derTagDictionary   = 16 // context specific, constructed
+	derTagEntitlements = 16 // application, constructed
+)
+
+// DecodeDEREntitlements decodes the DER entitlements blob into the same
+// values as DecodeEntitlements: the blob holds a version and a dictionary,
+// dictionaries being sets of key and value sequences.
+func (cs *CodeSignature) DecodeDEREntitlements() (map[string]interface{}, error) {
+	if len(cs.DEREntitlements) < 8 {
+		return nil, errors.New("code signature has no DER entitlements")
+	}
+	var top asn1.RawValue
+	if _, err := asn1.Unmarshal(cs.DEREntitlements[8:], &top); err != nil {
+		return nil, fmt.Errorf("fail to decode DER entitlements: %v", err)
+	}
+	if top.Class != asn1.ClassApplication || top.Tag != derTagEntitlements {
+		return nil, errors.New("DER entitlements have an unexpected outer tag")
+	}
+	var version int
+	rest, err := asn1.Unmarshal(top.Bytes, &version)
+	if err != nil {
+		return nil, fmt.Errorf("fail to decode DER entitlements version: %v", err)
+	}
+	if version != 1 {
+		return nil, fmt.Errorf("unknown DER entitlements version %d", version)
+	}
+	v, _, err := derValue(rest)
+	if err != nil {
+		return nil, fmt.Errorf("fail to decode DER entitlements: %v", err)
+	}
+	dict, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("DER entitlements are not a dictionary")
+	}
+	return dict, nil
+}
+
+// derValue decodes the first value of b and returns the bytes following it.
+func derValue(b []byte) (interface{}, []byte, error) {
+	var raw asn1.RawValue
+	rest, err := asn1.Unmarshal(b, &raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	if raw.Class == asn1.ClassContextSpecific && raw.Tag == derTagDictionary || raw.Class == asn1.ClassUniversal && raw.Tag == asn1.TagSet {
+		dict := make(map[string]interface{})
+		for d := raw.Bytes; len(d) > 0; {
+			var pair asn1.RawValue
+			if d, err = asn1.Unmarshal(d, &pair); err != nil {
+				return nil, nil, err
+			}
+			if pair.Tag != asn1.TagSequence {
+				return nil, nil, errors.New("dictionary entry is not a sequence")
+			}
+			k, v, err := derValue(pair.Bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, nil, errors.New("dictionary key is not a string")
+			}
+			if dict[key], _, err = derValue(v); err != nil {
+				return nil, nil, err
+			}
+		}
+		return dict, rest, nil
+	}
+	if raw.Class != asn1.ClassUniversal {
+		return nil, nil, fmt.Errorf("unknown DER tag %d of class %d", raw.Tag, raw.Class)
+	}
+
+	switch raw.Tag {
+	case asn1.TagSequence:
+		array := []interface{}{}
+		for d := raw.Bytes; len(d) > 0; {
+			var v interface{}
+			if v, d, err = derValue(d); err != nil {
+				return nil, nil, err
+			}
+			array = append(array, v)
+		}
+		return array, rest, nil
+	case asn1.TagBoolean:
+		var v bool
+		_, err = asn1.Unmarshal(raw.FullBytes, &v)
+		return v, rest, err
+	case asn1.TagInteger:
+		var v int64
+		_, err = asn1.Unmarshal(raw.FullBytes, &v)
+		return v, rest, err
+	case asn1.TagUTF8String:
+		return string(raw.Bytes), rest, nil
+	case asn1.TagOctetString:
+		return raw.Bytes, rest, nil
+	}
+	return nil, nil, fmt.Errorf("unknown DER tag %d", raw.Tag)
+}
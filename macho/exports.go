@@ -1,19 +1,83 @@
 package macho
 
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
 const N_SECT = 0x0E
 const N_PEXT = 0x10
 const N_EXT = 0x01
 
+// Export trie symbol flags
+const (
+	EXPORT_SYMBOL_FLAGS_KIND_MASK         = 0x03
+	EXPORT_SYMBOL_FLAGS_KIND_REGULAR      = 0x00
+	EXPORT_SYMBOL_FLAGS_KIND_THREAD_LOCAL = 0x01
+	EXPORT_SYMBOL_FLAGS_KIND_ABSOLUTE     = 0x02
+	EXPORT_SYMBOL_FLAGS_WEAK_DEFINITION   = 0x04
+	EXPORT_SYMBOL_FLAGS_REEXPORT          = 0x08
+	EXPORT_SYMBOL_FLAGS_STUB_AND_RESOLVER = 0x10
+	EXPORT_SYMBOL_FLAGS_STATIC_RESOLVER   = 0x20
+)
+
 // Export - describes a single export entry (similar to PE version for future refactoring)
 type Export struct {
 	//Ordinal        uint32 // no ordinals for Mach-O
 	Name           string
-	VirtualAddress uint64
+	VirtualAddress uint64 // zero for re-exports
+	Flags          uint64 // EXPORT_SYMBOL_FLAGS_*, zero when read from the symbol table
+	Reexport       string // name of a re-exported symbol in its dylib, the same name if empty
+	DylibOrdinal   uint64 // ordinal of the dylib a symbol is re-exported from
+	Resolver       uint64 // address of the resolver of a stub
+}
+
+// ExportTrieEntry - a terminal of an export trie. Addresses are offsets from
+// the mach header.
+type ExportTrieEntry struct {
+	Name         string
+	Flags        uint64
+	Address      uint64
+	DylibOrdinal uint64 // EXPORT_SYMBOL_FLAGS_REEXPORT only
+	ImportName   string // EXPORT_SYMBOL_FLAGS_REEXPORT only, empty if the same as Name
+	Resolver     uint64 // EXPORT_SYMBOL_FLAGS_STUB_AND_RESOLVER only
 }
 
-// Exports - gets exports, including private exports
+// Exports - gets exports from the export trie, including re-exports and stub
+// resolvers, or from the symbol table, including private exports, if the
+// file has no export trie or it cannot be read
 func (f *File) Exports() []Export {
+	if entries, err := f.ExportTrie(); err == nil && entries != nil {
+		base := uint64(0)
+		if text := f.Segment("__TEXT"); text != nil {
+			base = text.Addr
+		}
+		exports := make([]Export, 0, len(entries))
+		for _, e := range entries {
+			export := Export{Name: e.Name, Flags: e.Flags}
+			switch {
+			case e.Flags&EXPORT_SYMBOL_FLAGS_REEXPORT != 0:
+				export.DylibOrdinal = e.DylibOrdinal
+				export.Reexport = e.ImportName
+			case e.Flags&EXPORT_SYMBOL_FLAGS_KIND_MASK == EXPORT_SYMBOL_FLAGS_KIND_ABSOLUTE:
+				export.VirtualAddress = e.Address
+			default:
+				export.VirtualAddress = base + e.Address
+				if e.Flags&EXPORT_SYMBOL_FLAGS_STUB_AND_RESOLVER != 0 {
+					export.Resolver = base + e.Resolver
+				}
+			}
+			exports = append(exports, export)
+		}
+		return exports
+	}
+
 	var exports []Export
+	if f.Symtab == nil {
+		return nil
+	}
 	for _, symbol := range f.Symtab.Syms {
 		if (symbol.Type&N_PEXT == N_PEXT ||
 			symbol.Type&N_EXT == N_EXT) && symbol.Value != 0 {
@@ -25,3 +89,225 @@ func (f *File) Exports() []Export {
 	}
 	return exports
 }
+
+// exportTrie returns where the export trie of the file is kept: the
+// LC_DYLD_EXPORTS_TRIE blob, or else the dyld info.
+func (f *File) exportTrie() *[]byte {
+	for _, l := range f.Loads {
+		if led, ok := l.(*LinkEditData); ok && led.Cmd == LoadCmdDyldExportsTrie {
+			return &led.RawDat
+		}
+	}
+	if f.DylinkInfo != nil {
+		return &f.DylinkInfo.ExportInfoDat
+	}
+	return nil
+}
+
+// ExportTrie decodes the export trie of LC_DYLD_EXPORTS_TRIE or of the dyld
+// info. It returns nil if the file has neither.
+func (f *File) ExportTrie() ([]ExportTrieEntry, error) {
+	dat := f.exportTrie()
+	if dat == nil || len(*dat) == 0 {
+		return nil, nil
+	}
+	return ParseExportTrie(*dat)
+}
+
+// SetExportTrie replaces the export trie of the file with one built from entries.
+func (f *File) SetExportTrie(entries []ExportTrieEntry) error {
+	dat := f.exportTrie()
+	if dat == nil {
+		return errors.New("file has no export trie")
+	}
+	trie := BuildExportTrie(entries)
+	*dat = append(trie, make([]byte, alignUp(uint64(len(trie)), f.ptrSize())-uint64(len(trie)))...)
+	return nil
+}
+
+// ParseExportTrie decodes an export trie into its terminals, in trie order.
+func ParseExportTrie(dat []byte) ([]ExportTrieEntry, error) {
+	var entries []ExportTrieEntry
+	visited := make(map[uint64]bool)
+	var walk func(off uint64, prefix string) error
+	walk = func(off uint64, prefix string) error {
+		if off >= uint64(len(dat)) {
+			return fmt.Errorf("export trie node at 0x%x is outside of the trie", off)
+		}
+		if visited[off] {
+			return fmt.Errorf("export trie node at 0x%x is visited twice", off)
+		}
+		visited[off] = true
+		s := &dyldStream{dat: dat, pos: int(off)}
+
+		size, err := s.uleb()
+		if err != nil {
+			return err
+		}
+		children := uint64(s.pos) + size
+		if size > 0 {
+			e := ExportTrieEntry{Name: prefix}
+			if e.Flags, err = s.uleb(); err != nil {
+				return err
+			}
+			switch {
+			case e.Flags&EXPORT_SYMBOL_FLAGS_REEXPORT != 0:
+				if e.DylibOrdinal, err = s.uleb(); err != nil {
+					return err
+				}
+				if e.ImportName, err = s.cstring(); err != nil {
+					return err
+				}
+			default:
+				if e.Address, err = s.uleb(); err != nil {
+					return err
+				}
+				if e.Flags&EXPORT_SYMBOL_FLAGS_STUB_AND_RESOLVER != 0 {
+					if e.Resolver, err = s.uleb(); err != nil {
+						return err
+					}
+				}
+			}
+			entries = append(entries, e)
+		}
+
+		if children >= uint64(len(dat)) {
+			return fmt.Errorf("export trie node at 0x%x is truncated", off)
+		}
+		s.pos = int(children)
+		n := int(dat[s.pos])
+		s.pos++
+		for i := 0; i < n; i++ {
+			label, err := s.cstring()
+			if err != nil {
+				return err
+			}
+			child, err := s.uleb()
+			if err != nil {
+				return err
+			}
+			if err := walk(child, prefix+label); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(0, ""); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+type trieNode struct {
+	edges    []trieEdge
+	terminal *ExportTrieEntry
+	offset   uint64
+}
+
+type trieEdge struct {
+	label string
+	child *trieNode
+}
+
+// insert adds e below n, whose edges lead to the rest of name.
+func (n *trieNode) insert(name string, e *ExportTrieEntry) {
+	if name == "" {
+		n.terminal = e
+		return
+	}
+	for i := range n.edges {
+		edge := &n.edges[i]
+		common := 0
+		for common < len(edge.label) && common < len(name) && edge.label[common] == name[common] {
+			common++
+		}
+		if common == 0 {
+			continue
+		}
+		if common < len(edge.label) {
+			// split the edge at the end of the common prefix
+			mid := &trieNode{edges: []trieEdge{{edge.label[common:], edge.child}}}
+			edge.label, edge.child = edge.label[:common], mid
+		}
+		edge.child.insert(name[common:], e)
+		return
+	}
+	child := new(trieNode)
+	n.edges = append(n.edges, trieEdge{name, child})
+	child.terminal = e
+}
+
+// info encodes the terminal information of n.
+func (n *trieNode) info() []byte {
+	e := n.terminal
+	if e == nil {
+		return nil
+	}
+	b := appendULEB128(nil, e.Flags)
+	switch {
+	case e.Flags&EXPORT_SYMBOL_FLAGS_REEXPORT != 0:
+		b = appendULEB128(b, e.DylibOrdinal)
+		b = append(b, e.ImportName...)
+		b = append(b, 0)
+	default:
+		b = appendULEB128(b, e.Address)
+		if e.Flags&EXPORT_SYMBOL_FLAGS_STUB_AND_RESOLVER != 0 {
+			b = appendULEB128(b, e.Resolver)
+		}
+	}
+	return b
+}
+
+// encode serializes n, with the current offsets of its children.
+func (n *trieNode) encode() []byte {
+	info := n.info()
+	b := appendULEB128(nil, uint64(len(info)))
+	b = append(b, info...)
+	b = append(b, byte(len(n.edges)))
+	for _, edge := range n.edges {
+		b = append(b, edge.label...)
+		b = append(b, 0)
+		b = appendULEB128(b, edge.child.offset)
+	}
+	return b
+}
+
+// BuildExportTrie builds an export trie from entries, as ld lays it out:
+// nodes in depth-first order, their edges sorted by name.
+func BuildExportTrie(entries []ExportTrieEntry) []byte {
+	es := append([]ExportTrieEntry(nil), entries...)
+	sort.SliceStable(es, func(i, j int) bool { return es[i].Name < es[j].Name })
+	root := new(trieNode)
+	for i := range es {
+		root.insert(es[i].Name, &es[i])
+	}
+
+	var nodes []*trieNode
+	var order func(n *trieNode)
+	order = func(n *trieNode) {
+		nodes = append(nodes, n)
+		for _, edge := range n.edges {
+			order(edge.child)
+		}
+	}
+	order(root)
+
+	// the size of a node depends on the offsets of its children, so lay
+	// the nodes out until the offsets settle
+	for changed := true; changed; {
+		changed = false
+		off := uint64(0)
+		for _, n := range nodes {
+			if n.offset != off {
+				n.offset = off
+				changed = true
+			}
+			off += uint64(len(n.encode()))
+		}
+	}
+	var buf bytes.Buffer
+	for _, n := range nodes {
+		buf.Write(n.encode())
+	}
+	return buf.Bytes()
+}
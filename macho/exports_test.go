@@ -0,0 +1,63 @@
+package macho
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestExportTrie(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	entries, err := f.ExportTrie()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ExportTrieEntry{{Name: "__mh_execute_header"}, {Name: "_main", Address: 0xf60}}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("export trie is %v, want %v", entries, want)
+	}
+	// ld pads the trie to the pointer size
+	if trie := BuildExportTrie(entries); !bytes.Equal(trie, f.DylinkInfo.ExportInfoDat[:len(trie)]) {
+		t.Errorf("built trie is %x, want %x", trie, f.DylinkInfo.ExportInfoDat)
+	}
+	exports := f.Exports()
+	if len(exports) != 2 || exports[1].Name != "_main" || exports[1].VirtualAddress != 0x100000f60 {
+		t.Errorf("exports are %v", exports)
+	}
+}
+
+func TestBuildExportTrie(t *testing.T) {
+	entries := []ExportTrieEntry{
+		{Name: "_foo", Address: 0x1000},
+		{Name: "_foobar", Flags: EXPORT_SYMBOL_FLAGS_WEAK_DEFINITION, Address: 0x1010},
+		{Name: "_fob", Flags: EXPORT_SYMBOL_FLAGS_STUB_AND_RESOLVER, Address: 0x1020, Resolver: 0x1030},
+		{Name: "_malloc", Flags: EXPORT_SYMBOL_FLAGS_REEXPORT, DylibOrdinal: 2},
+		{Name: "_my_free", Flags: EXPORT_SYMBOL_FLAGS_REEXPORT, DylibOrdinal: 2, ImportName: "_free"},
+		{Name: "_tlv", Flags: EXPORT_SYMBOL_FLAGS_KIND_THREAD_LOCAL, Address: 0x4000},
+	}
+	// enough symbols to push node offsets past one ULEB128 byte
+	for i := 0; i < 100; i++ {
+		entries = append(entries, ExportTrieEntry{Name: fmt.Sprintf("_sym%03d", i), Address: uint64(0x2000 + i*16)})
+	}
+	got, err := ParseExportTrie(BuildExportTrie(entries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(entries) {
+		t.Fatalf("trie has %d entries, want %d", len(got), len(entries))
+	}
+	byName := make(map[string]ExportTrieEntry)
+	for _, e := range got {
+		byName[e.Name] = e
+	}
+	for _, e := range entries {
+		if byName[e.Name] != e {
+			t.Errorf("entry %s is %+v after round trip, want %+v", e.Name, byName[e.Name], e)
+		}
+	}
+}
@@ -5,7 +5,9 @@
 package macho
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -19,15 +21,19 @@ type FatFile struct {
 }
 
 // A FatArchHeader represents a fat header for a specific image architecture.
+// Offset and Size only exceed 32 bits in FAT_MAGIC_64 files.
 type FatArchHeader struct {
 	Cpu    Cpu
 	SubCpu uint32
-	Offset uint32
-	Size   uint32
-	Align  uint32
+	Offset uint64
+	Size   uint64
+	Align  uint32 // log2 of the alignment of the image
 }
 
-const fatArchHeaderSize = 5 * 4
+const (
+	fatArchHeaderSize   = 5 * 4
+	fatArchHeaderSize64 = 8 * 4 // with 64-bit offset and size, and a reserved field
+)
 
 // A FatArch is a Mach-O File inside a FatFile.
 type FatArch struct {
@@ -51,7 +57,7 @@ func NewFatFile(r io.ReaderAt) (*FatFile, error) {
 	err := binary.Read(sr, binary.BigEndian, &ff.Magic)
 	if err != nil {
 		return nil, &FormatError{0, "error reading magic number", nil}
-	} else if ff.Magic != MagicFat {
+	} else if ff.Magic != MagicFat && ff.Magic != MagicFat64 {
 		// See if this is a Mach-O file via its magic number. The magic
 		// must be converted to little endian first though.
 		var buf [4]byte
@@ -88,11 +94,26 @@ func NewFatFile(r io.ReaderAt) (*FatFile, error) {
 	ff.Arches = make([]FatArch, narch)
 	for i := uint32(0); i < narch; i++ {
 		fa := &ff.Arches[i]
-		err = binary.Read(sr, binary.BigEndian, &fa.FatArchHeader)
-		if err != nil {
+		hdrSize := fatArchHeaderSize
+		if ff.Magic == MagicFat64 {
+			hdrSize = fatArchHeaderSize64
+		}
+		hdr := make([]byte, hdrSize)
+		if _, err := io.ReadFull(sr, hdr); err != nil {
 			return nil, &FormatError{offset, "invalid fat_arch header", nil}
 		}
-		offset += fatArchHeaderSize
+		fa.Cpu = Cpu(binary.BigEndian.Uint32(hdr[0:]))
+		fa.SubCpu = binary.BigEndian.Uint32(hdr[4:])
+		if ff.Magic == MagicFat64 {
+			fa.Offset = binary.BigEndian.Uint64(hdr[8:])
+			fa.Size = binary.BigEndian.Uint64(hdr[16:])
+			fa.Align = binary.BigEndian.Uint32(hdr[24:])
+		} else {
+			fa.Offset = uint64(binary.BigEndian.Uint32(hdr[8:]))
+			fa.Size = uint64(binary.BigEndian.Uint32(hdr[12:]))
+			fa.Align = binary.BigEndian.Uint32(hdr[16:])
+		}
+		offset += int64(hdrSize)
 
 		fr := io.NewSectionReader(r, int64(fa.Offset), int64(fa.Size))
 		fa.File, err = NewFile(fr)
@@ -144,3 +165,154 @@ func (ff *FatFile) Close() error {
 	}
 	return err
 }
+
+// cpuSubtypeMask masks the capability bits out of a cpu subtype.
+const cpuSubtypeMask = 0x00ffffff
+
+// sameArch reports whether a slice is for the given cpu and subtype.
+func (fa *FatArch) sameArch(cpu Cpu, subCpu uint32) bool {
+	return fa.Cpu == cpu && fa.SubCpu&cpuSubtypeMask == subCpu&cpuSubtypeMask
+}
+
+// defaultAlign returns the log2 of the alignment lipo gives to a slice: the
+// page size of its cpu.
+func defaultAlign(cpu Cpu) uint32 {
+	if cpu == CpuArm || cpu == CpuArm64 {
+		return 14
+	}
+	return 12
+}
+
+// NewFatFileFrom creates a universal binary from thin files, one per
+// architecture. Offsets and sizes are computed when the file is written.
+func NewFatFileFrom(files ...*File) (*FatFile, error) {
+	ff := &FatFile{Magic: MagicFat}
+	for _, f := range files {
+		if err := ff.Add(f); err != nil {
+			return nil, err
+		}
+	}
+	return ff, nil
+}
+
+// Add appends a slice for a thin file, whose architecture must not be in the
+// universal binary already.
+func (ff *FatFile) Add(f *File) error {
+	for i := range ff.Arches {
+		if ff.Arches[i].sameArch(f.Cpu, f.SubCpu) {
+			return fmt.Errorf("architecture cpu=%v, subcpu=%#x is already present", f.Cpu, f.SubCpu)
+		}
+	}
+	if len(ff.Arches) > 0 && ff.Arches[0].Type != f.Type {
+		return fmt.Errorf("Mach-O type %#x does not match the type %#x of the other architectures", f.Type, ff.Arches[0].Type)
+	}
+	ff.Arches = append(ff.Arches, FatArch{
+		FatArchHeader: FatArchHeader{Cpu: f.Cpu, SubCpu: f.SubCpu, Align: defaultAlign(f.Cpu)},
+		File:          f,
+	})
+	return nil
+}
+
+// Extract returns the thin file of the slice for cpu and subCpu. Capability
+// bits of the subtype are ignored.
+func (ff *FatFile) Extract(cpu Cpu, subCpu uint32) (*File, error) {
+	for i := range ff.Arches {
+		if ff.Arches[i].sameArch(cpu, subCpu) {
+			return ff.Arches[i].File, nil
+		}
+	}
+	return nil, fmt.Errorf("no architecture cpu=%v, subcpu=%#x", cpu, subCpu)
+}
+
+// Remove removes the slice for cpu and subCpu. The last slice cannot be removed.
+func (ff *FatFile) Remove(cpu Cpu, subCpu uint32) error {
+	for i := range ff.Arches {
+		if !ff.Arches[i].sameArch(cpu, subCpu) {
+			continue
+		}
+		if len(ff.Arches) == 1 {
+			return errors.New("cannot remove the only architecture")
+		}
+		ff.Arches = append(ff.Arches[:i], ff.Arches[i+1:]...)
+		return nil
+	}
+	return fmt.Errorf("no architecture cpu=%v, subcpu=%#x", cpu, subCpu)
+}
+
+// Replace replaces the slice for the architecture of f with f.
+func (ff *FatFile) Replace(f *File) error {
+	for i := range ff.Arches {
+		fa := &ff.Arches[i]
+		if fa.sameArch(f.Cpu, f.SubCpu) {
+			fa.File = f
+			fa.SubCpu = f.SubCpu
+			return nil
+		}
+	}
+	return fmt.Errorf("no architecture cpu=%v, subcpu=%#x", f.Cpu, f.SubCpu)
+}
+
+// Bytes assembles the universal binary. Each slice is rewritten with
+// File.Bytes and placed at the next offset aligned to 1<<Align; the Offset
+// and Size of the arches are updated. FAT_MAGIC_64 is used when an offset or
+// size does not fit in 32 bits, or if the file was read with it.
+func (ff *FatFile) Bytes() ([]byte, error) {
+	if len(ff.Arches) == 0 {
+		return nil, errors.New("universal binary has no architecture")
+	}
+	slices := make([][]byte, len(ff.Arches))
+	for i := range ff.Arches {
+		fa := &ff.Arches[i]
+		dat, err := fa.File.Bytes()
+		if err != nil {
+			return nil, fmt.Errorf("fail to write architecture cpu=%v, subcpu=%#x: %v", fa.Cpu, fa.SubCpu, err)
+		}
+		slices[i] = dat
+		if fa.Align == 0 {
+			fa.Align = defaultAlign(fa.Cpu)
+		}
+	}
+
+	layout := func(hdrSize int) bool {
+		off := uint64(8 + len(ff.Arches)*hdrSize)
+		fits := true
+		for i := range ff.Arches {
+			fa := &ff.Arches[i]
+			fa.Offset = alignUp(off, 1<<fa.Align)
+			fa.Size = uint64(len(slices[i]))
+			off = fa.Offset + fa.Size
+			fits = fits && off <= 0xffffffff
+		}
+		return fits
+	}
+	if ff.Magic != MagicFat64 && !layout(fatArchHeaderSize) {
+		ff.Magic = MagicFat64
+	}
+	if ff.Magic == MagicFat64 {
+		layout(fatArchHeaderSize64)
+	}
+
+	var buf bytes.Buffer
+	w := func(v interface{}) { binary.Write(&buf, binary.BigEndian, v) }
+	w(ff.Magic)
+	w(uint32(len(ff.Arches)))
+	for _, fa := range ff.Arches {
+		w(fa.Cpu)
+		w(fa.SubCpu)
+		if ff.Magic == MagicFat64 {
+			w(fa.Offset)
+			w(fa.Size)
+			w(fa.Align)
+			w(uint32(0))
+		} else {
+			w(uint32(fa.Offset))
+			w(uint32(fa.Size))
+			w(fa.Align)
+		}
+	}
+	for i, fa := range ff.Arches {
+		buf.Write(make([]byte, fa.Offset-uint64(buf.Len())))
+		buf.Write(slices[i])
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,87 @@
+package macho
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestFatBytesRoundTrip(t *testing.T) {
+	name := "testdata/fat-gcc-386-amd64-darwin-exec"
+	ff, err := OpenFat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ff.Close()
+	have, err := ff.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have, want) {
+		t.Errorf("%s: unmodified universal binary was not written back as it was read", name)
+	}
+}
+
+func TestFatEdit(t *testing.T) {
+	var thin []*File
+	for _, name := range []string{"testdata/gcc-386-darwin-exec", "testdata/gcc-amd64-darwin-exec"} {
+		f, err := Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		thin = append(thin, f)
+	}
+	ff, err := NewFatFileFrom(thin...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ff.Add(thin[0]); err == nil {
+		t.Error("adding a duplicate architecture succeeded")
+	}
+
+	for _, magic := range []uint32{MagicFat, MagicFat64} {
+		ff.Magic = magic
+		data, err := ff.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := NewFatFile(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("magic %#x: %v", magic, err)
+		}
+		if g.Magic != magic || len(g.Arches) != 2 {
+			t.Fatalf("magic %#x: read back magic %#x and %d architectures", magic, g.Magic, len(g.Arches))
+		}
+		for i, fa := range g.Arches {
+			want, _ := thin[i].Bytes()
+			if fa.Offset%(1<<fa.Align) != 0 || fa.Size != uint64(len(want)) {
+				t.Errorf("magic %#x: architecture %v at offset %#x with size %#x and alignment 2^%d", magic, fa.Cpu, fa.Offset, fa.Size, fa.Align)
+			}
+			if !bytes.Equal(data[fa.Offset:fa.Offset+fa.Size], want) {
+				t.Errorf("magic %#x: architecture %v differs from its thin file", magic, fa.Cpu)
+			}
+		}
+	}
+
+	f, err := ff.Extract(CpuAmd64, thin[1].SubCpu)
+	if err != nil || f != thin[1] {
+		t.Errorf("Extract returned %v, %v", f, err)
+	}
+	if err := ff.Replace(thin[1]); err != nil {
+		t.Error(err)
+	}
+	if err := ff.Remove(Cpu386, thin[0].SubCpu); err != nil {
+		t.Fatal(err)
+	}
+	if err := ff.Remove(CpuAmd64, thin[1].SubCpu); err == nil {
+		t.Error("removing the only architecture succeeded")
+	}
+	if _, err := ff.Extract(Cpu386, thin[0].SubCpu); err == nil {
+		t.Error("extracting a removed architecture succeeded")
+	}
+}
@@ -9,13 +9,12 @@ package macho
 
 import (
 	"bytes"
-	"compress/zlib"
-	"debug/dwarf"
 	"encoding/binary"
 	"fmt"
 	"io"
 	"os"
-	"strings"
+
+	"github.com/lesnuages/debug/dwarf"
 )
 
 // A File represents an open Mach-O file.
@@ -35,7 +34,9 @@ type File struct {
 	EntryPoint uint64
 	Insertion  []byte
 
-	closer io.Closer
+	r          io.ReaderAt // the reader the file was decoded from
+	memoryMode bool        // r holds a loaded image rather than a file
+	closer     io.Closer
 }
 
 // A Load represents any Mach-O load command.
@@ -155,7 +156,12 @@ type Reloc struct {
 
 type Section struct {
 	SectionHeader
-	Relocs []Reloc
+	Reserved1 uint32 // index into the indirect symbol table for symbol pointer and stub sections
+	Reserved2 uint32 // size of a stub for symbol stub sections
+	Reserved3 uint32 // 64-bit only
+	Relocs    []Reloc
+
+	rawRelocs []byte
 
 	// Embed ReaderAt for ReadAt method.
 	// Do not embed SectionReader directly
@@ -180,15 +186,25 @@ func (s *Section) Data() ([]byte, error) {
 // Open returns a new ReadSeeker reading the Mach-O section.
 func (s *Section) Open() io.ReadSeeker { return io.NewSectionReader(s.sr, 0, 1<<63-1) }
 
+// Replace sets the contents of the section to the first length bytes of
+// reader, which Bytes then writes in its place.
+func (s *Section) Replace(reader io.ReaderAt, length int64) {
+	s.sr = io.NewSectionReader(reader, 0, length)
+	s.ReaderAt = s.sr
+}
+
 // A Dylinker represents a Mach-O load dynamic library command.
 type Dylinker struct {
 	LoadBytes
 	Name string
 }
 
-// A Dylib represents a Mach-O load dynamic library command.
+// A Dylib represents a Mach-O load dynamic library command. The same type
+// holds weak, re-exported, lazy and upward imports, and the install name of a
+// dylib; Command tells them apart.
 type Dylib struct {
 	LoadBytes
+	Cmd            LoadCmd // LoadCmdDylib, LoadCmdWeakDylib, LoadCmdIdDylib...
 	Name           string
 	Time           uint32
 	CurrentVersion uint32
@@ -202,6 +218,9 @@ type Symtab struct {
 	Syms         []Symbol
 	RawSymtab    []byte
 	RawStringtab []byte
+
+	syms []Symbol // the symbols as last encoded, to tell whether Syms was edited
+	ids  []int    // index in syms of each of Syms once RemoveSymbol was called, -1 for new ones
 }
 
 // A Dysymtab represents a Mach-O dynamic symbol table command.
@@ -210,6 +229,20 @@ type Dysymtab struct {
 	DysymtabCmd
 	IndirectSyms []uint32 // indices into Symtab.Syms
 	RawDysymtab  []byte
+
+	// the other tables the command refers to, kept as they are
+	rawToc, rawModtab, rawExtrefsyms, rawExtrel, rawLocrel []byte
+}
+
+// A LinkEditData represents a Mach-O load command that refers to a blob of
+// __LINKEDIT data the package does not otherwise decode, such as segment split
+// info or chained fixups.
+type LinkEditData struct {
+	LoadBytes
+	Cmd    LoadCmd
+	Len    uint32
+	Offset uint64
+	RawDat []byte
 }
 
 // A Rpath represents a Mach-O rpath command.
@@ -288,7 +321,7 @@ func NewFileFromMemory(r io.ReaderAt) (*File, error) {
 // NewFile creates a new File for accessing a PE binary in an underlying reader.
 func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 
-	f := new(File)
+	f := &File{r: r, memoryMode: memoryMode}
 	sr := io.NewSectionReader(r, 0, 1<<63-1)
 
 	// Read and decode Mach magic to determine byte order, size.
@@ -344,6 +377,17 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 		default:
 			f.Loads[i] = LoadBytes(cmddat)
 
+		case LoadCmdUUID, LoadCmdBuildVersion, LoadCmdVersionMinMacosx, LoadCmdVersionMinIphoneos,
+			LoadCmdVersionMinTvos, LoadCmdVersionMinWatchos, LoadCmdSourceVersion,
+			LoadCmdEncryptionInfo, LoadCmdEncryptionInfo64, LoadCmdLinkerOption, LoadCmdNote:
+			// a malformed command is kept as raw bytes, as it was before
+			// these commands were decoded, rather than rejecting the file
+			l, err := decodeLoad(cmd, cmddat, bo)
+			if err != nil {
+				l = LoadBytes(cmddat)
+			}
+			f.Loads[i] = l
+
 		case LoadCmdRpath:
 			var hdr RpathCmd
 			b := bytes.NewReader(cmddat)
@@ -372,7 +416,7 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 			l.LoadBytes = LoadBytes(cmddat)
 			f.Loads[i] = l
 
-		case LoadCmdDylib:
+		case LoadCmdDylib, LoadCmdIdDylib, LoadCmdWeakDylib, LoadCmdReexportDylib, LoadCmdLazyDylib, LoadCmdUpwardDylib:
 			var hdr DylibCmd
 			b := bytes.NewReader(cmddat)
 			if err := binary.Read(b, bo, &hdr); err != nil {
@@ -382,6 +426,7 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 			if hdr.Name >= uint32(len(cmddat)) {
 				return nil, &FormatError{offset, "invalid name in dynamic library command", hdr.Name}
 			}
+			l.Cmd = cmd
 			l.Name = cstring(cmddat[hdr.Name:])
 			l.Time = hdr.Time
 			l.CurrentVersion = hdr.CurrentVersion
@@ -448,8 +493,7 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 			}
 			f.Loads[i] = st
 			f.Symtab = st
-			f.Symtab.Symoff = hdr.Symoff
-			f.Symtab.Stroff = hdr.Stroff
+			f.Symtab.SymtabCmd = hdr
 
 		case LoadCmdSignature:
 			var sigCmd SigBlockCmd
@@ -505,7 +549,26 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 			f.DataInCode = &datacode
 			f.Loads[i] = LoadBytes(cmddat)
 
-		case LoadCmdDylinkInfo:
+		case LoadCmdSplitInfo, LoadCmdSignDrs, LoadCmdOptHint, LoadCmdDyldExportsTrie, LoadCmdDyldChainedFixup:
+			var hdr LinkEditDataCmd
+			b := bytes.NewReader(cmddat)
+			if err := binary.Read(b, bo, &hdr); err != nil {
+				return nil, err
+			}
+			l := new(LinkEditData)
+			l.LoadBytes = LoadBytes(cmddat)
+			l.Cmd = cmd
+			l.Len = hdr.Datasize
+			l.Offset = uint64(hdr.Dataoff)
+			if !memoryMode {
+				l.RawDat = make([]byte, hdr.Datasize)
+				if _, err := r.ReadAt(l.RawDat, int64(hdr.Dataoff)); err != nil {
+					return nil, err
+				}
+			}
+			f.Loads[i] = l
+
+		case LoadCmdDylinkInfo, LoadCmdDyldInfo:
 			var dylinkInfoCmd DylinkInfoCmd
 			dic := bytes.NewReader(cmddat)
 			if err := binary.Read(dic, bo, &dylinkInfoCmd); err != nil {
@@ -601,6 +664,38 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 			f.Dysymtab.Indirectsymoff = hdr.Indirectsymoff
 			f.Dysymtab.RawDysymtab = dat
 
+			// The remaining tables are only needed to write the file back,
+			// so those that lie outside of it are left nil and layout
+			// reports them then.
+			modsz := uint64(52)
+			if f.Magic == Magic64 {
+				modsz = 56
+			}
+			for _, t := range []struct {
+				dat       *[]byte
+				off, size uint64
+			}{
+				{&st.rawToc, uint64(hdr.Tocoffset), uint64(hdr.Ntoc) * 8},
+				{&st.rawModtab, uint64(hdr.Modtaboff), uint64(hdr.Nmodtab) * modsz},
+				{&st.rawExtrefsyms, uint64(hdr.Extrefsymoff), uint64(hdr.Nextrefsyms) * 4},
+				{&st.rawExtrel, uint64(hdr.Extreloff), uint64(hdr.Nextrel) * 8},
+				{&st.rawLocrel, uint64(hdr.Locreloff), uint64(hdr.Nlocrel) * 8},
+			} {
+				if t.size == 0 {
+					continue
+				}
+				// check the last byte is there before allocating the table
+				var last [1]byte
+				if _, err := r.ReadAt(last[:], int64(t.off+t.size-1)); err != nil {
+					continue
+				}
+				dat := make([]byte, t.size)
+				if _, err := r.ReadAt(dat, int64(t.off)); err != nil {
+					continue
+				}
+				*t.dat = dat
+			}
+
 		case LoadCmdSegment:
 			var seg32 Segment32
 			b := bytes.NewReader(cmddat)
@@ -620,9 +715,6 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 			s.Prot = seg32.Prot
 			s.Nsect = seg32.Nsect
 			s.Flag = seg32.Flag
-			if uint64((seg32.Offset + seg32.Filesz)) > FinalSegEnd {
-				FinalSegEnd = uint64((seg32.Offset + seg32.Filesz))
-			}
 			f.Loads[i] = s
 			for i := 0; i < int(s.Nsect); i++ {
 				var sh32 Section32
@@ -639,6 +731,8 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 				sh.Reloff = sh32.Reloff
 				sh.Nreloc = sh32.Nreloc
 				sh.Flags = sh32.Flags
+				sh.Reserved1 = sh32.Reserve1
+				sh.Reserved2 = sh32.Reserve2
 				if err := f.pushSection(sh, r); err != nil {
 					return nil, err
 				}
@@ -663,9 +757,6 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 			s.Prot = seg64.Prot
 			s.Nsect = seg64.Nsect
 			s.Flag = seg64.Flag
-			if uint64((seg64.Offset + seg64.Filesz)) > FinalSegEnd {
-				FinalSegEnd = uint64((seg64.Offset + seg64.Filesz))
-			}
 			f.Loads[i] = s
 			for i := 0; i < int(s.Nsect); i++ {
 				var sh64 Section64
@@ -682,13 +773,23 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 				sh.Reloff = sh64.Reloff
 				sh.Nreloc = sh64.Nreloc
 				sh.Flags = sh64.Flags
+				sh.Reserved1 = sh64.Reserve1
+				sh.Reserved2 = sh64.Reserve2
+				sh.Reserved3 = sh64.Reserve3
 				if err := f.pushSection(sh, r); err != nil {
 					return nil, err
 				}
 			}
 
-		//case LoadCmdUnixThread:
-		// todo: do we have to support thread_command here for older binaries? or is the LC_MAIN handling backwards compatible?
+		case LoadCmdThread, LoadCmdUnixThread:
+			// a malformed thread command is kept as raw bytes, without
+			// an entry point, rather than rejecting the file
+			t, err := decodeThread(cmd, cmddat, bo)
+			if err != nil {
+				f.Loads[i] = LoadBytes(cmddat)
+				break
+			}
+			f.Loads[i] = t
 
 		case LoadCmdMain:
 			var entryPoint EntryPointCmd
@@ -697,6 +798,7 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 				return nil, err
 			}
 			f.EntryPoint = entryPoint.EntryOff
+			f.Loads[i] = LoadBytes(cmddat)
 		}
 		if s != nil {
 			if !memoryMode {
@@ -707,6 +809,12 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 			s.ReaderAt = s.sr
 		}
 	}
+	if f.EntryPoint == 0 {
+		// executables without LC_MAIN start at the PC of their thread command
+		if ep, ok := f.threadEntryPoint(); ok {
+			f.EntryPoint = ep
+		}
+	}
 	return f, nil
 }
 
@@ -744,6 +852,7 @@ func (f *File) parseSymtab(symdat, strtab, cmddat []byte, hdr *SymtabCmd, offset
 	st := new(Symtab)
 	st.LoadBytes = LoadBytes(cmddat)
 	st.Syms = symtab
+	st.syms = append([]Symbol(nil), symtab...)
 	st.RawSymtab = symdat
 	st.RawStringtab = strtab
 	return st, nil
@@ -764,6 +873,7 @@ func (f *File) pushSection(sh *Section, r io.ReaderAt) error {
 		if _, err := r.ReadAt(reldat, int64(sh.Reloff)); err != nil {
 			return err
 		}
+		sh.rawRelocs = reldat
 		b := bytes.NewReader(reldat)
 
 		bo := f.ByteOrder
@@ -841,84 +951,18 @@ func (f *File) Section(name string) *Section {
 
 // DWARF returns the DWARF debug information for the Mach-O file.
 func (f *File) DWARF() (*dwarf.Data, error) {
-	dwarfSuffix := func(s *Section) string {
-		switch {
-		case strings.HasPrefix(s.Name, "__debug_"):
-			return s.Name[8:]
-		case strings.HasPrefix(s.Name, "__zdebug_"):
-			return s.Name[9:]
-		default:
-			return ""
-		}
-
-	}
-	sectionData := func(s *Section) ([]byte, error) {
-		b, err := s.Data()
-		if err != nil && uint64(len(b)) < s.Size {
-			return nil, err
-		}
-
-		if len(b) >= 12 && string(b[:4]) == "ZLIB" {
-			dlen := binary.BigEndian.Uint64(b[4:12])
-			dbuf := make([]byte, dlen)
-			r, err := zlib.NewReader(bytes.NewBuffer(b[12:]))
-			if err != nil {
-				return nil, err
-			}
-			if _, err := io.ReadFull(r, dbuf); err != nil {
-				return nil, err
-			}
-			if err := r.Close(); err != nil {
+	sections := make([]dwarf.Section, len(f.Sections))
+	for i, s := range f.Sections {
+		s := s
+		sections[i] = dwarf.Section{Name: s.Name, Data: func() ([]byte, error) {
+			b, err := s.Data()
+			if err != nil && uint64(len(b)) < s.Size {
 				return nil, err
 			}
-			b = dbuf
-		}
-		return b, nil
-	}
-
-	// There are many other DWARF sections, but these
-	// are the ones the debug/dwarf package uses.
-	// Don't bother loading others.
-	var dat = map[string][]byte{"abbrev": nil, "info": nil, "str": nil, "line": nil, "ranges": nil}
-	for _, s := range f.Sections {
-		suffix := dwarfSuffix(s)
-		if suffix == "" {
-			continue
-		}
-		if _, ok := dat[suffix]; !ok {
-			continue
-		}
-		b, err := sectionData(s)
-		if err != nil {
-			return nil, err
-		}
-		dat[suffix] = b
-	}
-
-	d, err := dwarf.New(dat["abbrev"], nil, nil, dat["info"], dat["line"], nil, dat["ranges"], dat["str"])
-	if err != nil {
-		return nil, err
+			return b, nil
+		}}
 	}
-
-	// Look for DWARF4 .debug_types sections.
-	for i, s := range f.Sections {
-		suffix := dwarfSuffix(s)
-		if suffix != "types" {
-			continue
-		}
-
-		b, err := sectionData(s)
-		if err != nil {
-			return nil, err
-		}
-
-		err = d.AddTypes(fmt.Sprintf("types-%d", i), b)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	return d, nil
+	return dwarf.Load(sections)
 }
 
 // ImportedSymbols returns the names of all symbols
@@ -944,7 +988,7 @@ func (f *File) ImportedSymbols() ([]string, error) {
 func (f *File) ImportedLibraries() ([]string, error) {
 	var all []string
 	for _, l := range f.Loads {
-		if lib, ok := l.(*Dylib); ok {
+		if lib, ok := l.(*Dylib); ok && lib.Cmd != LoadCmdIdDylib {
 			all = append(all, lib.Name)
 		}
 	}
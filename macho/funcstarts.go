@@ -0,0 +1,141 @@
+package macho
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Data in code entry kinds
+const (
+	DICE_KIND_DATA             = 0x0001
+	DICE_KIND_JUMP_TABLE8      = 0x0002
+	DICE_KIND_JUMP_TABLE16     = 0x0003
+	DICE_KIND_JUMP_TABLE32     = 0x0004
+	DICE_KIND_ABS_JUMP_TABLE32 = 0x0005
+)
+
+// A DataInCodeEntry is a range of data within the code of a Mach-O file, such
+// as a jump table. Offset is from the mach header.
+type DataInCodeEntry struct {
+	Offset uint32
+	Length uint16
+	Kind   uint16
+}
+
+// DecodeFunctionStarts decodes the ULEB128 deltas of function starts into
+// addresses, the first delta being from base, the address of __TEXT. The
+// addresses of thumb functions have their low bit set.
+func DecodeFunctionStarts(dat []byte, base uint64) ([]uint64, error) {
+	var addrs []uint64
+	s := &dyldStream{dat: dat}
+	addr := base
+	for s.pos < len(dat) {
+		delta, err := s.uleb()
+		if err != nil {
+			return nil, err
+		}
+		if delta == 0 {
+			break
+		}
+		addr += delta
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// EncodeFunctionStarts encodes sorted function addresses as ULEB128 deltas
+// from base, terminated by a zero delta.
+func EncodeFunctionStarts(addrs []uint64, base uint64) ([]byte, error) {
+	var b []byte
+	prev := base
+	for _, addr := range addrs {
+		if addr <= prev {
+			return nil, fmt.Errorf("function start 0x%x is not after 0x%x", addr, prev)
+		}
+		b = appendULEB128(b, addr-prev)
+		prev = addr
+	}
+	return append(b, 0), nil
+}
+
+// DecodeDataInCode decodes data in code entries.
+func DecodeDataInCode(dat []byte, bo binary.ByteOrder) ([]DataInCodeEntry, error) {
+	if len(dat)%8 != 0 {
+		return nil, fmt.Errorf("data in code size %d is not a multiple of 8", len(dat))
+	}
+	entries := make([]DataInCodeEntry, len(dat)/8)
+	for i := range entries {
+		e := dat[8*i:]
+		entries[i] = DataInCodeEntry{Offset: bo.Uint32(e), Length: bo.Uint16(e[4:]), Kind: bo.Uint16(e[6:])}
+	}
+	return entries, nil
+}
+
+// EncodeDataInCode encodes data in code entries.
+func EncodeDataInCode(entries []DataInCodeEntry, bo binary.ByteOrder) []byte {
+	dat := make([]byte, 8*len(entries))
+	for i, e := range entries {
+		bo.PutUint32(dat[8*i:], e.Offset)
+		bo.PutUint16(dat[8*i+4:], e.Length)
+		bo.PutUint16(dat[8*i+6:], e.Kind)
+	}
+	return dat
+}
+
+// textBase returns the address of __TEXT, which function starts are relative to.
+func (f *File) textBase() (uint64, error) {
+	text := f.Segment("__TEXT")
+	if text == nil {
+		return 0, errors.New("file has no __TEXT segment")
+	}
+	return text.Addr, nil
+}
+
+// FunctionStarts decodes the function starts of the file into addresses.
+func (f *File) FunctionStarts() ([]uint64, error) {
+	if f.FuncStarts == nil {
+		return nil, errors.New("file has no function starts")
+	}
+	base, err := f.textBase()
+	if err != nil {
+		return nil, err
+	}
+	return DecodeFunctionStarts(f.FuncStarts.RawDat, base)
+}
+
+// SetFunctionStarts replaces the function starts of the file with addrs,
+// which must be sorted.
+func (f *File) SetFunctionStarts(addrs []uint64) error {
+	if f.FuncStarts == nil {
+		return errors.New("file has no function starts")
+	}
+	base, err := f.textBase()
+	if err != nil {
+		return err
+	}
+	b, err := EncodeFunctionStarts(addrs, base)
+	if err != nil {
+		return err
+	}
+	// ld pads the deltas with zeros to the pointer size
+	f.FuncStarts.RawDat = append(b, make([]byte, alignUp(uint64(len(b)), f.ptrSize())-uint64(len(b)))...)
+	return nil
+}
+
+// DataInCodeEntries decodes the data in code entries of the file.
+func (f *File) DataInCodeEntries() ([]DataInCodeEntry, error) {
+	if f.DataInCode == nil {
+		return nil, errors.New("file has no data in code")
+	}
+	return DecodeDataInCode(f.DataInCode.RawDat, f.ByteOrder)
+}
+
+// SetDataInCode replaces the data in code entries of the file.
+func (f *File) SetDataInCode(entries []DataInCodeEntry) error {
+	if f.DataInCode == nil {
+		return errors.New("file has no data in code")
+	}
+	f.DataInCode.RawDat = EncodeDataInCode(entries, f.ByteOrder)
+	return nil
+}
@@ -0,0 +1,84 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestFunctionStarts(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	addrs, err := f.FunctionStarts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint64{f.Section("__text").Addr}; !reflect.DeepEqual(addrs, want) {
+		t.Errorf("function starts are %#x, want %#x", addrs, want)
+	}
+
+	orig := f.FuncStarts.RawDat
+	if err := f.SetFunctionStarts(addrs); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(f.FuncStarts.RawDat, orig) {
+		t.Errorf("function starts are encoded as %x, want %x", f.FuncStarts.RawDat, orig)
+	}
+
+	addrs = append(addrs, addrs[0]+0x10, addrs[0]+0x200)
+	if err := f.SetFunctionStarts(addrs); err != nil {
+		t.Fatal(err)
+	}
+	dat, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(dat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, err := g.FunctionStarts(); err != nil || !reflect.DeepEqual(have, addrs) {
+		t.Errorf("function starts after rewrite are %#x, %v, want %#x", have, err, addrs)
+	}
+
+	if err := f.SetFunctionStarts([]uint64{addrs[1], addrs[0]}); err == nil {
+		t.Error("unsorted function starts were encoded")
+	}
+}
+
+func TestDataInCode(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if entries, err := f.DataInCodeEntries(); err != nil || len(entries) != 0 {
+		t.Fatalf("data in code entries are %v, %v", entries, err)
+	}
+	want := []DataInCodeEntry{
+		{Offset: 0xf70, Length: 16, Kind: DICE_KIND_JUMP_TABLE32},
+		{Offset: 0xf90, Length: 4, Kind: DICE_KIND_DATA},
+	}
+	if err := f.SetDataInCode(want); err != nil {
+		t.Fatal(err)
+	}
+	dat, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(dat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, err := g.DataInCodeEntries(); err != nil || !reflect.DeepEqual(have, want) {
+		t.Errorf("data in code entries are %+v, %v, want %+v", have, err, want)
+	}
+
+	if _, err := DecodeDataInCode(make([]byte, 12), binary.LittleEndian); err == nil {
+		t.Error("truncated data in code was decoded")
+	}
+}
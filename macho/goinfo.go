@@ -0,0 +1,303 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lesnuages/debug/gosym"
+)
+
+// GoBuildInfo is the build information the Go linker embeds in a binary, as
+// printed by go version -m.
+type GoBuildInfo struct {
+	GoVersion string // version of the toolchain that built the binary
+	Path      string // package path of the main package
+	Main      GoModule
+	Deps      []*GoModule
+	Settings  []GoBuildSetting
+}
+
+// A GoModule is a module of a Go binary.
+type GoModule struct {
+	Path    string
+	Version string
+	Sum     string    // checksum
+	Replace *GoModule // replaced by, or nil
+}
+
+// A GoBuildSetting is a key/value setting of the build, such as GOOS or
+// vcs.revision.
+type GoBuildSetting struct {
+	Key, Value string
+}
+
+const goBuildInfoMagic = "\xff Go buildinf:"
+
+// goSectionData returns the contents of the named Go section.
+func (f *File) goSectionData(name string) ([]byte, error) {
+	s := f.Section(name)
+	if s == nil {
+		return nil, fmt.Errorf("file has no %s section", name)
+	}
+	return s.Data()
+}
+
+// goTextStart returns the address the Go line table is relative to: the one
+// of runtime.text, or else the start of __text.
+func (f *File) goTextStart() uint64 {
+	if f.Symtab != nil {
+		for _, s := range f.Symtab.Syms {
+			if s.Name == "runtime.text" {
+				return s.Value
+			}
+		}
+	}
+	if text := f.Section("__text"); text != nil {
+		return text.Addr
+	}
+	return 0
+}
+
+// GoLineTable returns the line table of __gopclntab.
+func (f *File) GoLineTable() (*gosym.LineTable, error) {
+	dat, err := f.goSectionData("__gopclntab")
+	if err != nil {
+		return nil, err
+	}
+	return gosym.NewLineTable(dat, f.goTextStart()), nil
+}
+
+// GoSymTable returns the symbol table of __gosymtab and __gopclntab. The
+// first is empty since Go 1.3, and no longer there since Go 1.18.
+func (f *File) GoSymTable() (*gosym.Table, error) {
+	pcln, err := f.GoLineTable()
+	if err != nil {
+		return nil, err
+	}
+	var symtab []byte
+	if f.Section("__gosymtab") != nil {
+		if symtab, err = f.goSectionData("__gosymtab"); err != nil {
+			return nil, err
+		}
+	}
+	return gosym.NewTable(symtab, pcln)
+}
+
+// readAddr reads n bytes at the address addr of the file.
+func (f *File) readAddr(addr uint64, n int) ([]byte, error) {
+	for _, s := range f.Sections {
+		if addr < s.Addr || addr-s.Addr >= s.Size || isZerofill(s.Flags) {
+			continue
+		}
+		if uint64(n) > s.Size-(addr-s.Addr) {
+			break
+		}
+		b := make([]byte, n)
+		if _, err := s.ReadAt(b, int64(addr-s.Addr)); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("address 0x%x is not in the file", addr)
+}
+
+// GoBuildInfo decodes the build information of __go_buildinfo.
+func (f *File) GoBuildInfo() (*GoBuildInfo, error) {
+	dat, err := f.goSectionData("__go_buildinfo")
+	if err != nil {
+		return nil, err
+	}
+	return decodeGoBuildInfo(dat, f.readAddr)
+}
+
+// decodeGoBuildInfo decodes a Go build info blob. Since Go 1.18 it holds its
+// strings, before that it points at them through readAddr.
+func decodeGoBuildInfo(dat []byte, readAddr func(addr uint64, n int) ([]byte, error)) (*GoBuildInfo, error) {
+	const hdrSize = 32
+	if len(dat) < hdrSize || !bytes.HasPrefix(dat, []byte(goBuildInfoMagic)) {
+		return nil, errors.New("invalid Go build info magic")
+	}
+	ptrSize, flags := int(dat[14]), dat[15]
+	var bo binary.ByteOrder = binary.LittleEndian
+	if flags&1 != 0 {
+		bo = binary.BigEndian
+	}
+
+	var vers, mod string
+	if flags&2 != 0 {
+		rest := dat[hdrSize:]
+		str := func() (string, error) {
+			n, k := binary.Uvarint(rest)
+			if k <= 0 || n > uint64(len(rest)-k) {
+				return "", errors.New("invalid Go build info string")
+			}
+			s := string(rest[k : k+int(n)])
+			rest = rest[k+int(n):]
+			return s, nil
+		}
+		var err error
+		if vers, err = str(); err != nil {
+			return nil, err
+		}
+		if mod, err = str(); err != nil {
+			return nil, err
+		}
+	} else {
+		if ptrSize != 4 && ptrSize != 8 {
+			return nil, fmt.Errorf("invalid Go build info pointer size %d", ptrSize)
+		}
+		ptr := func(b []byte) uint64 {
+			if ptrSize == 4 {
+				return uint64(bo.Uint32(b))
+			}
+			return bo.Uint64(b)
+		}
+		// each pointer is to a string header, the address and length of its data
+		str := func(addr uint64) (string, error) {
+			hdr, err := readAddr(addr, 2*ptrSize)
+			if err != nil {
+				return "", err
+			}
+			n := ptr(hdr[ptrSize:])
+			if n > 1<<20 {
+				return "", fmt.Errorf("Go build info string of %d bytes is too large", n)
+			}
+			b, err := readAddr(ptr(hdr), int(n))
+			if err != nil {
+				return "", err
+			}
+			return string(b), nil
+		}
+		var err error
+		if vers, err = str(ptr(dat[16:])); err != nil {
+			return nil, err
+		}
+		if mod, err = str(ptr(dat[16+ptrSize:])); err != nil {
+			return nil, err
+		}
+	}
+
+	// the module information is framed by 16 byte sentinels
+	if len(mod) >= 33 && mod[len(mod)-17] == '\n' {
+		mod = mod[16 : len(mod)-16]
+	}
+	info, err := parseGoModInfo(mod)
+	if err != nil {
+		return nil, err
+	}
+	info.GoVersion = vers
+	return info, nil
+}
+
+// parseGoModInfo parses the module information of a Go binary, in the text
+// format of go version -m.
+func parseGoModInfo(mod string) (*GoBuildInfo, error) {
+	info := new(GoBuildInfo)
+	var last *GoModule
+	module := func(fields []string) (*GoModule, error) {
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("invalid Go module %q", strings.Join(fields, "\t"))
+		}
+		m := &GoModule{Path: fields[0], Version: fields[1]}
+		if len(fields) == 3 {
+			m.Sum = fields[2]
+		}
+		return m, nil
+	}
+	for _, line := range strings.Split(mod, "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		var err error
+		switch fields[0] {
+		case "path":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("invalid Go build info line %q", line)
+			}
+			info.Path = fields[1]
+		case "mod":
+			var m *GoModule
+			if m, err = module(fields[1:]); err == nil {
+				info.Main = *m
+				last = &info.Main
+			}
+		case "dep":
+			var m *GoModule
+			if m, err = module(fields[1:]); err == nil {
+				info.Deps = append(info.Deps, m)
+				last = m
+			}
+		case "=>":
+			if last == nil {
+				return nil, fmt.Errorf("Go module replacement %q of no module", line)
+			}
+			var m *GoModule
+			if m, err = module(fields[1:]); err == nil {
+				last.Replace, last = m, nil
+			}
+		case "build":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("invalid Go build setting %q", line)
+			}
+			var s GoBuildSetting
+			if s, err = parseGoBuildSetting(fields[1]); err == nil {
+				info.Settings = append(info.Settings, s)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// parseGoBuildSetting parses key=value, either of which is quoted when it
+// holds spaces, quotes or an equal sign for the key.
+func parseGoBuildSetting(s string) (GoBuildSetting, error) {
+	var key string
+	if strings.HasPrefix(s, `"`) {
+		q := quotedPrefix(s)
+		var err error
+		if key, err = strconv.Unquote(q); err != nil {
+			return GoBuildSetting{}, err
+		}
+		s = s[len(q):]
+		if !strings.HasPrefix(s, "=") {
+			return GoBuildSetting{}, fmt.Errorf("invalid Go build setting %q", s)
+		}
+		s = s[1:]
+	} else {
+		i := strings.IndexByte(s, '=')
+		if i < 0 {
+			return GoBuildSetting{}, fmt.Errorf("invalid Go build setting %q", s)
+		}
+		key, s = s[:i], s[i+1:]
+	}
+	value := s
+	if strings.HasPrefix(s, `"`) {
+		var err error
+		if value, err = strconv.Unquote(s); err != nil {
+			return GoBuildSetting{}, fmt.Errorf("invalid Go build setting value %q", s)
+		}
+	}
+	return GoBuildSetting{Key: key, Value: value}, nil
+}
+
+// quotedPrefix returns the double quoted string s starts with, up to its
+// closing quote.
+func quotedPrefix(s string) string {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return s[:i+1]
+		}
+	}
+	return s
+}
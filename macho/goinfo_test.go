@@ -0,0 +1,93 @@
+package macho
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const testGoModInfo = "path\texample.com/hello\n" +
+	"mod\texample.com/hello\t(devel)\t\n" +
+	"dep\tgolang.org/x/sys\tv0.1.0\th1:abc=\n" +
+	"dep\tgolang.org/x/text\tv0.3.0\th1:def=\n" +
+	"=>\t../text\t(devel)\t\n" +
+	"build\t-compiler=gc\n" +
+	"build\t\"-ldflags=-s -w\"=\"-X main.v=1\"\n" +
+	"build\tGOOS=darwin\n"
+
+var testGoBuildInfo = &GoBuildInfo{
+	GoVersion: "go1.21.0",
+	Path:      "example.com/hello",
+	Main:      GoModule{Path: "example.com/hello", Version: "(devel)"},
+	Deps: []*GoModule{
+		{Path: "golang.org/x/sys", Version: "v0.1.0", Sum: "h1:abc="},
+		{Path: "golang.org/x/text", Version: "v0.3.0", Sum: "h1:def=", Replace: &GoModule{Path: "../text", Version: "(devel)"}},
+	},
+	Settings: []GoBuildSetting{{"-compiler", "gc"}, {"-ldflags=-s -w", "-X main.v=1"}, {"GOOS", "darwin"}},
+}
+
+// goModInfoSentinels frames module information as the linker embeds it.
+func goModInfoSentinels(mod string) string {
+	return "0w\xaf\x0c\x92t\x08\x02A\xe1\xc1\x07\xe6\xd6\x18\xe6" + mod + "\xf92C1\x86\x18 r\x00\x82B\x10A\x16\xd8\xf2"
+}
+
+func TestGoBuildInfoInline(t *testing.T) {
+	dat := make([]byte, 32)
+	copy(dat, goBuildInfoMagic)
+	dat[14], dat[15] = 8, 2
+	for _, s := range []string{"go1.21.0", goModInfoSentinels(testGoModInfo)} {
+		dat = append(dat, make([]byte, binary.MaxVarintLen64)...)
+		dat = dat[:len(dat)-binary.MaxVarintLen64+binary.PutUvarint(dat[len(dat)-binary.MaxVarintLen64:], uint64(len(s)))]
+		dat = append(dat, s...)
+	}
+	info, err := decodeGoBuildInfo(dat, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(info, testGoBuildInfo) {
+		t.Errorf("build info is %+v, want %+v", info, testGoBuildInfo)
+	}
+}
+
+func TestGoBuildInfoPointers(t *testing.T) {
+	// before Go 1.18, the header points at string headers elsewhere in the binary
+	mem := map[uint64][]byte{
+		0x1000: {0x00, 0x20, 0, 0, 0x08, 0, 0, 0},
+		0x1008: {0x00, 0x30, 0, 0, byte(len(goModInfoSentinels(testGoModInfo))), 0, 0, 0},
+		0x2000: []byte("go1.21.0"),
+		0x3000: []byte(goModInfoSentinels(testGoModInfo)),
+	}
+	readAddr := func(addr uint64, n int) ([]byte, error) {
+		if b, ok := mem[addr]; ok && len(b) >= n {
+			return b[:n], nil
+		}
+		return nil, errors.New("unmapped")
+	}
+	dat := make([]byte, 32)
+	copy(dat, goBuildInfoMagic)
+	dat[14] = 4
+	binary.LittleEndian.PutUint32(dat[16:], 0x1000)
+	binary.LittleEndian.PutUint32(dat[20:], 0x1008)
+	info, err := decodeGoBuildInfo(dat, readAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(info, testGoBuildInfo) {
+		t.Errorf("build info is %+v, want %+v", info, testGoBuildInfo)
+	}
+}
+
+func TestGoSectionsMissing(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.GoBuildInfo(); err == nil {
+		t.Error("build info of a C binary was decoded")
+	}
+	if _, err := f.GoLineTable(); err == nil {
+		t.Error("line table of a C binary was returned")
+	}
+}
@@ -0,0 +1,424 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// a chunk is a run of bytes the writer places at a file offset
+type chunk struct {
+	off uint64
+	dat []byte
+}
+
+func alignUp(n, a uint64) uint64 {
+	return (n + a - 1) &^ (a - 1)
+}
+
+func isZerofill(flags uint32) bool {
+	switch flags & sectionTypeMask {
+	case SectionZerofill, SectionGBZerofill, SectionThreadLocalZerofill:
+		return true
+	}
+	return false
+}
+
+// pageSize returns the segment alignment used for the file's architecture.
+func (f *File) pageSize() uint64 {
+	if f.Cpu == CpuArm64 {
+		return 0x4000
+	}
+	return 0x1000
+}
+
+// ptrSize returns the size of a pointer, which __LINKEDIT tables are aligned to.
+func (f *File) ptrSize() uint64 {
+	if f.Magic == Magic64 {
+		return 8
+	}
+	return 4
+}
+
+// segmentSections returns the sections of each segment command. Sections are
+// kept in load command order, so a segment owns the next Nsect of them.
+func (f *File) segmentSections() (map[*Segment][]*Section, error) {
+	m := make(map[*Segment][]*Section)
+	next := 0
+	for _, l := range f.Loads {
+		seg, ok := l.(*Segment)
+		if !ok {
+			continue
+		}
+		if next+int(seg.Nsect) > len(f.Sections) {
+			return nil, fmt.Errorf("segment %s has %d sections, but only %d are left", seg.Name, seg.Nsect, len(f.Sections)-next)
+		}
+		m[seg] = f.Sections[next : next+int(seg.Nsect)]
+		next += int(seg.Nsect)
+	}
+	if next != len(f.Sections) {
+		return nil, fmt.Errorf("%d sections are not part of any segment", len(f.Sections)-next)
+	}
+	return m, nil
+}
+
+// encodeSegment serializes a segment command from its header and sections.
+func (f *File) encodeSegment(seg *Segment, secs []*Section) []byte {
+	var buf bytes.Buffer
+	bo := f.ByteOrder
+	if seg.Cmd == LoadCmdSegment64 {
+		seg64 := Segment64{
+			Cmd: seg.Cmd, Len: seg.Len,
+			Addr: seg.Addr, Memsz: seg.Memsz, Offset: seg.Offset, Filesz: seg.Filesz,
+			Maxprot: seg.Maxprot, Prot: seg.Prot, Nsect: seg.Nsect, Flag: seg.Flag,
+		}
+		copy(seg64.Name[:], seg.Name)
+		binary.Write(&buf, bo, seg64)
+		for _, s := range secs {
+			sh := Section64{
+				Addr: s.Addr, Size: s.Size, Offset: s.Offset, Align: s.Align,
+				Reloff: s.Reloff, Nreloc: s.Nreloc, Flags: s.Flags,
+				Reserve1: s.Reserved1, Reserve2: s.Reserved2, Reserve3: s.Reserved3,
+			}
+			copy(sh.Name[:], s.Name)
+			copy(sh.Seg[:], s.Seg)
+			binary.Write(&buf, bo, sh)
+		}
+	} else {
+		seg32 := Segment32{
+			Cmd: seg.Cmd, Len: seg.Len,
+			Addr: uint32(seg.Addr), Memsz: uint32(seg.Memsz), Offset: uint32(seg.Offset), Filesz: uint32(seg.Filesz),
+			Maxprot: seg.Maxprot, Prot: seg.Prot, Nsect: seg.Nsect, Flag: seg.Flag,
+		}
+		copy(seg32.Name[:], seg.Name)
+		binary.Write(&buf, bo, seg32)
+		for _, s := range secs {
+			sh := Section32{
+				Addr: uint32(s.Addr), Size: uint32(s.Size), Offset: s.Offset, Align: s.Align,
+				Reloff: s.Reloff, Nreloc: s.Nreloc, Flags: s.Flags,
+				Reserve1: s.Reserved1, Reserve2: s.Reserved2,
+			}
+			copy(sh.Name[:], s.Name)
+			copy(sh.Seg[:], s.Seg)
+			binary.Write(&buf, bo, sh)
+		}
+	}
+	return buf.Bytes()
+}
+
+// patchCmd returns a copy of the load command raw with its leading fields
+// replaced by hdr.
+func (f *File) patchCmd(raw []byte, hdr interface{}) LoadBytes {
+	var buf bytes.Buffer
+	binary.Write(&buf, f.ByteOrder, hdr)
+	out := append(LoadBytes(nil), raw...)
+	copy(out, buf.Bytes())
+	return out
+}
+
+// linkEditRank orders the __LINKEDIT blobs of LinkEditData commands relative
+// to the function starts, as ld64 lays them out.
+func linkEditRank(cmd LoadCmd) int {
+	switch cmd {
+	case LoadCmdDyldChainedFixup:
+		return 0
+	case LoadCmdDyldExportsTrie:
+		return 1
+	case LoadCmdSplitInfo:
+		return 2
+	}
+	return 3 // after the data in code entries
+}
+
+// layout recomputes the file layout: the size of the load commands, the file
+// offsets of sections, and the placement of every __LINKEDIT table, which are
+// packed one after the other. Segments other than __LINKEDIT keep their file
+// offset. An edited symbol table is encoded again first. The headers and load
+// commands of f are updated to match; layout returns the data to write at
+// each offset and the size of the file.
+func (f *File) layout() ([]chunk, uint64, error) {
+	if err := f.encodeSymtab(); err != nil {
+		return nil, 0, err
+	}
+	secs, err := f.segmentSections()
+	if err != nil {
+		return nil, 0, err
+	}
+	bo := f.ByteOrder
+
+	// segment commands are rebuilt, so their size follows their number of sections
+	hdrSize := uint64(fileHeaderSize32)
+	segSize, secSize := binary.Size(Segment32{}), binary.Size(Section32{})
+	if f.Magic == Magic64 {
+		hdrSize = fileHeaderSize64
+		segSize, secSize = binary.Size(Segment64{}), binary.Size(Section64{})
+	}
+	var cmdsz uint64
+	for _, l := range f.Loads {
+		if seg, ok := l.(*Segment); ok {
+			seg.Nsect = uint32(len(secs[seg]))
+			seg.Len = uint32(segSize + len(secs[seg])*secSize)
+			cmdsz += uint64(seg.Len)
+			continue
+		}
+		cmdsz += uint64(len(l.Raw()))
+	}
+	f.Ncmd = uint32(len(f.Loads))
+	f.Cmdsz = uint32(cmdsz)
+	cmdEnd := hdrSize + cmdsz + uint64(len(f.Insertion))
+
+	// segment data stays where it is, with the current contents of its sections
+	var chunks []chunk
+	linkedit := f.Segment("__LINKEDIT")
+	dataEnd := cmdEnd
+	for _, l := range f.Loads {
+		seg, ok := l.(*Segment)
+		if !ok || seg == linkedit {
+			continue
+		}
+		var segDat []byte
+		if seg.Filesz > 0 {
+			if segDat, err = seg.Data(); err != nil {
+				return nil, 0, fmt.Errorf("fail to read segment %s: %v", seg.Name, err)
+			}
+			segDat = append(segDat, make([]byte, seg.Filesz-uint64(len(segDat)))...)
+		}
+		// the header padding before the first section is not copied
+		skip := uint64(len(segDat))
+		for _, s := range secs[seg] {
+			if isZerofill(s.Flags) {
+				s.Offset = 0
+				continue
+			}
+			if s.Addr >= seg.Addr && s.Addr-seg.Addr < seg.Filesz {
+				s.Offset = uint32(seg.Offset + s.Addr - seg.Addr)
+			}
+			if s.Size == 0 {
+				continue
+			}
+			if uint64(s.Offset) < cmdEnd {
+				return nil, 0, fmt.Errorf("load commands overlap section %s,%s", s.Seg, s.Name)
+			}
+			dat, err := s.Data()
+			if err != nil {
+				return nil, 0, fmt.Errorf("fail to read section %s,%s: %v", s.Seg, s.Name, err)
+			}
+			rel := uint64(s.Offset) - seg.Offset
+			if uint64(s.Offset) >= seg.Offset && rel+uint64(len(dat)) <= uint64(len(segDat)) {
+				copy(segDat[rel:], dat)
+				if rel < skip {
+					skip = rel
+				}
+			} else {
+				chunks = append(chunks, chunk{uint64(s.Offset), dat})
+			}
+			if end := uint64(s.Offset) + uint64(len(dat)); end > dataEnd {
+				dataEnd = end
+			}
+		}
+		if seg.Offset >= cmdEnd {
+			skip = 0
+		}
+		if skip < uint64(len(segDat)) {
+			chunks = append(chunks, chunk{seg.Offset + skip, segDat[skip:]})
+		}
+		if seg.Filesz > 0 && seg.Offset+seg.Filesz > dataEnd {
+			dataEnd = seg.Offset + seg.Filesz
+		}
+	}
+
+	// __LINKEDIT keeps its offset unless the data before it has grown
+	ptr := f.ptrSize()
+	start := dataEnd
+	if linkedit != nil {
+		start = alignUp(dataEnd, f.pageSize())
+		if linkedit.Offset >= dataEnd {
+			start = linkedit.Offset
+		}
+	}
+	off := start
+	place := func(dat []byte, align uint64) uint64 {
+		if len(dat) == 0 {
+			return 0
+		}
+		off = alignUp(off, align)
+		o := off
+		chunks = append(chunks, chunk{o, dat})
+		off += uint64(len(dat))
+		return o
+	}
+	// empty linkedit_data_command blobs still point at where they would be, as ld64 does
+	placeData := func(dat []byte) uint64 {
+		if len(dat) == 0 {
+			return alignUp(off, ptr)
+		}
+		return place(dat, ptr)
+	}
+
+	for _, s := range f.Sections {
+		if s.rawRelocs, err = f.encodeRelocs(s); err != nil {
+			return nil, 0, err
+		}
+		s.Nreloc = uint32(len(s.Relocs))
+		s.Reloff = uint32(place(s.rawRelocs, ptr))
+	}
+	dst := f.Dysymtab
+	if dst != nil {
+		for _, t := range []struct {
+			name string
+			n    uint32
+			dat  []byte
+		}{
+			{"table of contents", dst.Ntoc, dst.rawToc},
+			{"module table", dst.Nmodtab, dst.rawModtab},
+			{"external reference table", dst.Nextrefsyms, dst.rawExtrefsyms},
+			{"external relocations", dst.Nextrel, dst.rawExtrel},
+			{"local relocations", dst.Nlocrel, dst.rawLocrel},
+		} {
+			if t.n > 0 && len(t.dat) == 0 {
+				return nil, 0, fmt.Errorf("%s was not read from the file", t.name)
+			}
+		}
+		dst.Locreloff = uint32(place(dst.rawLocrel, ptr))
+	}
+
+	if di := f.DylinkInfo; di != nil {
+		for _, p := range []struct {
+			name string
+			dat  []byte
+			len  *uint32
+			off  *uint64
+		}{
+			{"rebase", di.RebaseDat, &di.RebaseLen, &di.RebaseOffset},
+			{"binding", di.BindingInfoDat, &di.BindingInfoLen, &di.BindingInfoOffset},
+			{"weak binding", di.WeakBindingDat, &di.WeakBindingLen, &di.WeakBindingOffset},
+			{"lazy binding", di.LazyBindingDat, &di.LazyBindingLen, &di.LazyBindingOffset},
+			{"export", di.ExportInfoDat, &di.ExportInfoLen, &di.ExportInfoOffset},
+		} {
+			if *p.len > 0 && len(p.dat) == 0 {
+				return nil, 0, fmt.Errorf("%s info was not read from the file", p.name)
+			}
+			*p.off = place(p.dat, ptr)
+			*p.len = uint32(len(p.dat))
+		}
+	}
+
+	placeLinkEditData := func(before bool) error {
+		for _, l := range f.Loads {
+			led, ok := l.(*LinkEditData)
+			if !ok || (linkEditRank(led.Cmd) < 3) != before {
+				continue
+			}
+			if led.Len > 0 && len(led.RawDat) == 0 {
+				return fmt.Errorf("%v data was not read from the file", led.Cmd)
+			}
+			led.Offset = placeData(led.RawDat)
+			led.Len = uint32(len(led.RawDat))
+		}
+		return nil
+	}
+	if err := placeLinkEditData(true); err != nil {
+		return nil, 0, err
+	}
+	if fs := f.FuncStarts; fs != nil {
+		fs.Offset = placeData(fs.RawDat)
+		fs.Len = uint32(len(fs.RawDat))
+	}
+	if dc := f.DataInCode; dc != nil {
+		dc.Offset = placeData(dc.RawDat)
+		dc.Len = uint32(len(dc.RawDat))
+	}
+	if err := placeLinkEditData(false); err != nil {
+		return nil, 0, err
+	}
+
+	if st := f.Symtab; st != nil {
+		st.Symoff = uint32(place(st.RawSymtab, ptr))
+	}
+	if dst != nil {
+		dst.Extreloff = uint32(place(dst.rawExtrel, ptr))
+		dst.Indirectsymoff = uint32(place(dst.RawDysymtab, ptr))
+		dst.Tocoffset = uint32(place(dst.rawToc, ptr))
+		dst.Modtaboff = uint32(place(dst.rawModtab, ptr))
+		dst.Extrefsymoff = uint32(place(dst.rawExtrefsyms, ptr))
+	}
+	if st := f.Symtab; st != nil {
+		st.Stroff = uint32(place(st.RawStringtab, ptr))
+		off = alignUp(off, ptr)
+	}
+	if sig := f.SigBlock; sig != nil {
+		// the code signature is 16 byte aligned
+		sig.Offset = place(sig.RawDat, 16)
+		sig.Len = uint32(len(sig.RawDat))
+	}
+
+	if linkedit != nil {
+		linkedit.Offset = start
+		linkedit.Filesz = off - start
+		if memsz := alignUp(linkedit.Filesz, f.pageSize()); memsz > linkedit.Memsz {
+			linkedit.Memsz = memsz
+		}
+	}
+	size := off
+	for _, l := range f.Loads {
+		if seg, ok := l.(*Segment); ok && seg.Offset+seg.Filesz > size {
+			size = seg.Offset + seg.Filesz
+		}
+	}
+
+	// bring the load commands in line with the new layout
+	nlistSize, modSize := 12, 52
+	if f.Magic == Magic64 {
+		nlistSize, modSize = 16, 56
+	}
+	for i, l := range f.Loads {
+		switch l := l.(type) {
+		case *Segment:
+			l.LoadBytes = f.encodeSegment(l, secs[l])
+		case *Symtab:
+			l.Nsyms = uint32(len(l.RawSymtab) / nlistSize)
+			l.Strsize = uint32(len(l.RawStringtab))
+			l.LoadBytes = f.patchCmd(l.LoadBytes, &l.SymtabCmd)
+		case *Dysymtab:
+			l.Nindirectsyms = uint32(len(l.RawDysymtab) / 4)
+			l.Ntoc = uint32(len(l.rawToc) / 8)
+			l.Nmodtab = uint32(len(l.rawModtab) / modSize)
+			l.Nextrefsyms = uint32(len(l.rawExtrefsyms) / 4)
+			l.Nextrel = uint32(len(l.rawExtrel) / 8)
+			l.Nlocrel = uint32(len(l.rawLocrel) / 8)
+			l.LoadBytes = f.patchCmd(l.LoadBytes, &l.DysymtabCmd)
+		case *LinkEditData:
+			l.LoadBytes = f.patchCmd(l.LoadBytes, &LinkEditDataCmd{l.Cmd, uint32(len(l.LoadBytes)), uint32(l.Offset), l.Len})
+		case LoadBytes:
+			if len(l) < 8 {
+				continue
+			}
+			switch cmd := LoadCmd(bo.Uint32(l)); cmd {
+			case LoadCmdSignature:
+				if f.SigBlock != nil {
+					f.Loads[i] = f.patchCmd(l, &SigBlockCmd{cmd, uint32(len(l)), uint32(f.SigBlock.Offset), f.SigBlock.Len})
+				}
+			case LoadCmdFuncStarts:
+				if f.FuncStarts != nil {
+					f.Loads[i] = f.patchCmd(l, &FuncStartsCmd{cmd, uint32(len(l)), uint32(f.FuncStarts.Offset), f.FuncStarts.Len})
+				}
+			case LoadCmdDataInCode:
+				if f.DataInCode != nil {
+					f.Loads[i] = f.patchCmd(l, &DataInCodeCmd{cmd, uint32(len(l)), uint32(f.DataInCode.Offset), f.DataInCode.Len})
+				}
+			case LoadCmdDylinkInfo, LoadCmdDyldInfo:
+				if di := f.DylinkInfo; di != nil {
+					f.Loads[i] = f.patchCmd(l, &DylinkInfoCmd{
+						cmd, uint32(len(l)),
+						uint32(di.RebaseOffset), di.RebaseLen,
+						uint32(di.BindingInfoOffset), di.BindingInfoLen,
+						uint32(di.WeakBindingOffset), di.WeakBindingLen,
+						uint32(di.LazyBindingOffset), di.LazyBindingLen,
+						uint32(di.ExportInfoOffset), di.ExportInfoLen,
+					})
+				}
+			}
+		}
+	}
+	return chunks, size, nil
+}
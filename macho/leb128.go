@@ -0,0 +1,66 @@
+package macho
+
+import "errors"
+
+var errLEB128 = errors.New("truncated or oversized LEB128 number")
+
+// readULEB128 decodes the unsigned LEB128 number at the start of b and returns
+// it with its encoded length.
+func readULEB128(b []byte) (uint64, int, error) {
+	var v uint64
+	for i, shift := 0, uint(0); i < len(b); i, shift = i+1, shift+7 {
+		if shift >= 64 && b[i] != 0 {
+			return 0, 0, errLEB128
+		}
+		v |= uint64(b[i]&0x7f) << shift
+		if b[i]&0x80 == 0 {
+			return v, i + 1, nil
+		}
+	}
+	return 0, 0, errLEB128
+}
+
+// readSLEB128 decodes the signed LEB128 number at the start of b and returns
+// it with its encoded length.
+func readSLEB128(b []byte) (int64, int, error) {
+	var v int64
+	shift := uint(0)
+	for i := 0; i < len(b); i++ {
+		if shift >= 64 {
+			return 0, 0, errLEB128
+		}
+		v |= int64(b[i]&0x7f) << shift
+		shift += 7
+		if b[i]&0x80 == 0 {
+			if shift < 64 && b[i]&0x40 != 0 {
+				v |= -1 << shift
+			}
+			return v, i + 1, nil
+		}
+	}
+	return 0, 0, errLEB128
+}
+
+// appendULEB128 appends the unsigned LEB128 encoding of v to b.
+func appendULEB128(b []byte, v uint64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v == 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// appendSLEB128 appends the signed LEB128 encoding of v to b.
+func appendSLEB128(b []byte, v int64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v == 0 && c&0x40 == 0 || v == -1 && c&0x40 != 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
@@ -0,0 +1,279 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// A UUID represents a Mach-O uuid command.
+type UUID struct {
+	LoadBytes
+	ID [16]byte
+
+	bo binary.ByteOrder
+}
+
+// A BuildVersion represents a Mach-O build version command.
+type BuildVersion struct {
+	LoadBytes
+	Platform uint32
+	Minos    uint32
+	Sdk      uint32
+	Tools    []BuildTool
+
+	bo binary.ByteOrder
+}
+
+// A VersionMin represents a Mach-O LC_VERSION_MIN_MACOSX, _IPHONEOS, _TVOS or
+// _WATCHOS command.
+type VersionMin struct {
+	LoadBytes
+	Cmd     LoadCmd
+	Version uint32
+	Sdk     uint32
+
+	bo binary.ByteOrder
+}
+
+// A SourceVersion represents a Mach-O source version command.
+type SourceVersion struct {
+	LoadBytes
+	Version uint64
+
+	bo binary.ByteOrder
+}
+
+// An EncryptionInfo represents a Mach-O LC_ENCRYPTION_INFO or
+// LC_ENCRYPTION_INFO_64 command. A Cryptid of 0 means the range is not encrypted.
+type EncryptionInfo struct {
+	LoadBytes
+	Cmd       LoadCmd
+	Cryptoff  uint32
+	Cryptsize uint32
+	Cryptid   uint32
+
+	bo binary.ByteOrder
+}
+
+// A LinkerOption represents a Mach-O linker option command.
+type LinkerOption struct {
+	LoadBytes
+	Options []string
+
+	bo binary.ByteOrder
+}
+
+// A Note represents a Mach-O note command, which points at data of the file
+// owned by some tool.
+type Note struct {
+	LoadBytes
+	DataOwner string
+	Offset    uint64
+	Size      uint64
+
+	bo binary.ByteOrder
+}
+
+// encodeLoad serializes a fixed command header and extra data, padding it to
+// the size of the command it was read from, if it still fits, or else to 8
+// bytes.
+func encodeLoad(bo binary.ByteOrder, orig []byte, hdr interface{}, extra []byte) []byte {
+	if bo == nil {
+		bo = binary.LittleEndian
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, bo, hdr)
+	buf.Write(extra)
+	size := uint64(len(orig))
+	if uint64(buf.Len()) > size {
+		size = alignUp(uint64(buf.Len()), 8)
+	}
+	buf.Write(make([]byte, size-uint64(buf.Len())))
+	raw := buf.Bytes()
+	bo.PutUint32(raw[4:], uint32(len(raw)))
+	return raw
+}
+
+func (u *UUID) Raw() []byte {
+	return encodeLoad(u.bo, u.LoadBytes, &UUIDCmd{Cmd: LoadCmdUUID, UUID: u.ID}, nil)
+}
+
+func (b *BuildVersion) Raw() []byte {
+	var tools bytes.Buffer
+	bo := b.bo
+	if bo == nil {
+		bo = binary.LittleEndian
+	}
+	binary.Write(&tools, bo, b.Tools)
+	hdr := BuildVersionCmd{Cmd: LoadCmdBuildVersion, Platform: b.Platform, Minos: b.Minos, Sdk: b.Sdk, Ntools: uint32(len(b.Tools))}
+	return encodeLoad(b.bo, b.LoadBytes, &hdr, tools.Bytes())
+}
+
+func (v *VersionMin) Raw() []byte {
+	return encodeLoad(v.bo, v.LoadBytes, &VersionMinCmd{Cmd: v.Cmd, Version: v.Version, Sdk: v.Sdk}, nil)
+}
+
+func (s *SourceVersion) Raw() []byte {
+	return encodeLoad(s.bo, s.LoadBytes, &SourceVersionCmd{Cmd: LoadCmdSourceVersion, Version: s.Version}, nil)
+}
+
+func (e *EncryptionInfo) Raw() []byte {
+	if e.Cmd == LoadCmdEncryptionInfo64 {
+		hdr := EncryptionInfo64Cmd{Cmd: e.Cmd, Cryptoff: e.Cryptoff, Cryptsize: e.Cryptsize, Cryptid: e.Cryptid}
+		return encodeLoad(e.bo, e.LoadBytes, &hdr, nil)
+	}
+	hdr := EncryptionInfoCmd{Cmd: e.Cmd, Cryptoff: e.Cryptoff, Cryptsize: e.Cryptsize, Cryptid: e.Cryptid}
+	return encodeLoad(e.bo, e.LoadBytes, &hdr, nil)
+}
+
+func (l *LinkerOption) Raw() []byte {
+	var opts []byte
+	for _, o := range l.Options {
+		opts = append(opts, o...)
+		opts = append(opts, 0)
+	}
+	return encodeLoad(l.bo, l.LoadBytes, &LinkerOptionCmd{Cmd: LoadCmdLinkerOption, Count: uint32(len(l.Options))}, opts)
+}
+
+func (n *Note) Raw() []byte {
+	hdr := NoteCmd{Cmd: LoadCmdNote, Offset: n.Offset, Size: n.Size}
+	copy(hdr.DataOwner[:], n.DataOwner)
+	return encodeLoad(n.bo, n.LoadBytes, &hdr, nil)
+}
+
+// decodeLoad decodes the commands that have a type of their own in this file.
+func decodeLoad(cmd LoadCmd, cmddat []byte, bo binary.ByteOrder) (Load, error) {
+	b := bytes.NewReader(cmddat)
+	read := func(hdr interface{}) error {
+		if err := binary.Read(b, bo, hdr); err != nil {
+			return fmt.Errorf("invalid %v command: %v", cmd, err)
+		}
+		return nil
+	}
+	raw := LoadBytes(cmddat)
+
+	switch cmd {
+	case LoadCmdUUID:
+		var hdr UUIDCmd
+		if err := read(&hdr); err != nil {
+			return nil, err
+		}
+		return &UUID{LoadBytes: raw, ID: hdr.UUID, bo: bo}, nil
+
+	case LoadCmdBuildVersion:
+		var hdr BuildVersionCmd
+		if err := read(&hdr); err != nil {
+			return nil, err
+		}
+		if uint64(hdr.Ntools)*8 > uint64(b.Len()) {
+			return nil, errors.New("build version tools extend past the command")
+		}
+		l := &BuildVersion{LoadBytes: raw, Platform: hdr.Platform, Minos: hdr.Minos, Sdk: hdr.Sdk, bo: bo}
+		l.Tools = make([]BuildTool, hdr.Ntools)
+		if err := read(l.Tools); err != nil {
+			return nil, err
+		}
+		return l, nil
+
+	case LoadCmdVersionMinMacosx, LoadCmdVersionMinIphoneos, LoadCmdVersionMinTvos, LoadCmdVersionMinWatchos:
+		var hdr VersionMinCmd
+		if err := read(&hdr); err != nil {
+			return nil, err
+		}
+		return &VersionMin{LoadBytes: raw, Cmd: cmd, Version: hdr.Version, Sdk: hdr.Sdk, bo: bo}, nil
+
+	case LoadCmdSourceVersion:
+		var hdr SourceVersionCmd
+		if err := read(&hdr); err != nil {
+			return nil, err
+		}
+		return &SourceVersion{LoadBytes: raw, Version: hdr.Version, bo: bo}, nil
+
+	case LoadCmdEncryptionInfo, LoadCmdEncryptionInfo64:
+		var hdr EncryptionInfoCmd
+		if err := read(&hdr); err != nil {
+			return nil, err
+		}
+		return &EncryptionInfo{LoadBytes: raw, Cmd: cmd, Cryptoff: hdr.Cryptoff, Cryptsize: hdr.Cryptsize, Cryptid: hdr.Cryptid, bo: bo}, nil
+
+	case LoadCmdLinkerOption:
+		var hdr LinkerOptionCmd
+		if err := read(&hdr); err != nil {
+			return nil, err
+		}
+		l := &LinkerOption{LoadBytes: raw, bo: bo}
+		opts := cmddat[binary.Size(hdr):]
+		for i := uint32(0); i < hdr.Count; i++ {
+			end := bytes.IndexByte(opts, 0)
+			if end < 0 {
+				return nil, errors.New("linker option is not terminated")
+			}
+			l.Options = append(l.Options, string(opts[:end]))
+			opts = opts[end+1:]
+		}
+		return l, nil
+
+	case LoadCmdNote:
+		var hdr NoteCmd
+		if err := read(&hdr); err != nil {
+			return nil, err
+		}
+		return &Note{LoadBytes: raw, DataOwner: cstring(hdr.DataOwner[:]), Offset: hdr.Offset, Size: hdr.Size, bo: bo}, nil
+	}
+	return raw, nil
+}
+
+// UUID returns the uuid command of the file, or nil if it has none.
+func (f *File) UUID() *UUID {
+	for _, l := range f.Loads {
+		if u, ok := l.(*UUID); ok {
+			return u
+		}
+	}
+	return nil
+}
+
+// BuildVersion returns the build version command of the file. Files built
+// for older systems only have a LC_VERSION_MIN_* command, which is then
+// converted, without tools. It returns nil if the file has neither.
+func (f *File) BuildVersion() *BuildVersion {
+	var min *VersionMin
+	for _, l := range f.Loads {
+		switch l := l.(type) {
+		case *BuildVersion:
+			return l
+		case *VersionMin:
+			if min == nil {
+				min = l
+			}
+		}
+	}
+	if min == nil {
+		return nil
+	}
+	platform := map[LoadCmd]uint32{
+		LoadCmdVersionMinMacosx:   PlatformMacOS,
+		LoadCmdVersionMinIphoneos: PlatformIOS,
+		LoadCmdVersionMinTvos:     PlatformTvOS,
+		LoadCmdVersionMinWatchos:  PlatformWatchOS,
+	}[min.Cmd]
+	return &BuildVersion{Platform: platform, Minos: min.Version, Sdk: min.Sdk, bo: f.ByteOrder}
+}
+
+// Encryption returns the encryption info command of the file, or nil if it has none.
+func (f *File) Encryption() *EncryptionInfo {
+	for _, l := range f.Loads {
+		if e, ok := l.(*EncryptionInfo); ok {
+			return e
+		}
+	}
+	return nil
+}
+
+// FormatVersion formats a version encoded in nibbles xxxx.yy.zz, as in
+// build version and dylib commands, as X.Y.Z.
+func FormatVersion(v uint32) string {
+	return fmt.Sprintf("%d.%d.%d", v>>16, v>>8&0xff, v&0xff)
+}
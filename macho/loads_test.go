@@ -0,0 +1,109 @@
+package macho
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestTypedLoads(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	u := f.UUID()
+	if u == nil {
+		t.Fatal("no uuid command")
+	}
+	if want := [16]byte{0x7f, 0x2c, 0x2e, 0xfa, 0x31, 0x1a, 0x3b, 0xd2, 0x8c, 0x49, 0xa9, 0xc9, 0x5d, 0x4d, 0xfa, 0x49}; u.ID != want {
+		t.Errorf("uuid is %x, want %x", u.ID, want)
+	}
+	bv := f.BuildVersion()
+	if bv == nil || bv.Platform != PlatformMacOS || FormatVersion(bv.Minos) != "10.12.0" || FormatVersion(bv.Sdk) != "10.12.0" {
+		t.Errorf("build version derived from LC_VERSION_MIN_MACOSX is %+v", bv)
+	}
+	if f.Encryption() != nil {
+		t.Error("unencrypted file has an encryption info command")
+	}
+
+	u.ID[0] = 0xff
+	added := []Load{
+		&BuildVersion{Platform: PlatformIOS, Minos: 0xe0000, Sdk: 0xe0200, Tools: []BuildTool{{ToolLD, 0x2610000}}},
+		&EncryptionInfo{Cmd: LoadCmdEncryptionInfo64, Cryptoff: 0x4000, Cryptsize: 0x1000, Cryptid: 1},
+		&LinkerOption{Options: []string{"-framework", "Foundation"}},
+		&Note{DataOwner: "com.example", Offset: 0x100, Size: 0x20},
+	}
+	for _, l := range added {
+		if err := f.insertLoad(len(f.Loads), l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.UUID().ID != u.ID {
+		t.Errorf("uuid is %x after rewriting, want %x", g.UUID().ID, u.ID)
+	}
+	gotBV := g.BuildVersion()
+	if gotBV == nil || gotBV.Platform != PlatformIOS || !reflect.DeepEqual(gotBV.Tools, added[0].(*BuildVersion).Tools) {
+		t.Errorf("build version is %+v after rewriting", gotBV)
+	}
+	if e := g.Encryption(); e == nil || e.Cmd != LoadCmdEncryptionInfo64 || e.Cryptoff != 0x4000 || e.Cryptsize != 0x1000 || e.Cryptid != 1 {
+		t.Errorf("encryption info is %+v after rewriting", e)
+	}
+	n := len(g.Loads)
+	if lo, ok := g.Loads[n-2].(*LinkerOption); !ok || !reflect.DeepEqual(lo.Options, []string{"-framework", "Foundation"}) {
+		t.Errorf("linker option is %+v after rewriting", g.Loads[n-2])
+	}
+	if note, ok := g.Loads[n-1].(*Note); !ok || note.DataOwner != "com.example" || note.Offset != 0x100 || note.Size != 0x20 {
+		t.Errorf("note is %+v after rewriting", g.Loads[n-1])
+	}
+	for i, l := range g.Loads {
+		if len(l.Raw())%8 != 0 {
+			t.Errorf("load command %d has size %d", i, len(l.Raw()))
+		}
+	}
+}
+
+func TestMalformedTypedLoad(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	off := fileHeaderSize64
+	idx := -1
+	for i, l := range f.Loads {
+		if _, ok := l.(*UUID); ok {
+			idx = i
+			break
+		}
+		off += len(l.Raw())
+	}
+	if idx < 0 {
+		t.Fatal("no uuid command")
+	}
+
+	// turn the uuid into a build version command with too many tools
+	f.ByteOrder.PutUint32(data[off:], uint32(LoadCmdBuildVersion))
+	f.ByteOrder.PutUint32(data[off+20:], 0xffffffff)
+	g, err := NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("malformed build version command: %v", err)
+	}
+	raw, ok := g.Loads[idx].(LoadBytes)
+	if !ok || !bytes.Equal(raw, data[off:off+24]) {
+		t.Errorf("malformed build version command was decoded as %#v, want its raw bytes", g.Loads[idx])
+	}
+}
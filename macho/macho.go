@@ -26,9 +26,10 @@ const (
 )
 
 const (
-	Magic32  uint32 = 0xfeedface
-	Magic64  uint32 = 0xfeedfacf
-	MagicFat uint32 = 0xcafebabe
+	Magic32    uint32 = 0xfeedface
+	Magic64    uint32 = 0xfeedfacf
+	MagicFat   uint32 = 0xcafebabe
+	MagicFat64 uint32 = 0xcafebabf // 64-bit offsets and sizes
 )
 
 // A Type is the Mach-O file type, e.g. an object file, executable, or dynamic library.
@@ -74,8 +75,6 @@ var cpuStrings = []intName{
 	{uint32(CpuPpc64), "CpuPpc64"},
 }
 
-var FinalSegEnd uint64
-
 func (i Cpu) String() string   { return stringName(uint32(i), cpuStrings, false) }
 func (i Cpu) GoString() string { return stringName(uint32(i), cpuStrings, true) }
 
@@ -83,22 +82,44 @@ func (i Cpu) GoString() string { return stringName(uint32(i), cpuStrings, true)
 type LoadCmd uint32
 
 const (
-	LoadCmdSegment    LoadCmd = 0x1
-	LoadCmdSymtab     LoadCmd = 0x2
-	LoadCmdThread     LoadCmd = 0x4
-	LoadCmdUnixThread LoadCmd = 0x5 // thread+stack
-	LoadCmdDysymtab   LoadCmd = 0xb
-	LoadCmdDylib      LoadCmd = 0xc // load dylib command
-	LoadCmdDylinker   LoadCmd = 0xf // id dylinker command (not load dylinker command)
-	LoadCmdSegment64  LoadCmd = 0x19
-	LoadCmdSignature  LoadCmd = 0x1d
-	LoadCmdFuncStarts LoadCmd = 0x26 // Function Starts
-	LoadCmdDataInCode LoadCmd = 0x29 // Data In Code
-
-	LoadReqDyld       LoadCmd = 0x80000000
-	LoadCmdMain       LoadCmd = (0x28 | LoadReqDyld) // replacement for LC_UNIXTHREAD
-	LoadCmdRpath      LoadCmd = 0x8000001c
-	LoadCmdDylinkInfo LoadCmd = 0x80000022 // Dynamic Linker Info Only
+	LoadCmdSegment            LoadCmd = 0x1
+	LoadCmdSymtab             LoadCmd = 0x2
+	LoadCmdThread             LoadCmd = 0x4
+	LoadCmdUnixThread         LoadCmd = 0x5 // thread+stack
+	LoadCmdDysymtab           LoadCmd = 0xb
+	LoadCmdDylib              LoadCmd = 0xc // load dylib command
+	LoadCmdIdDylib            LoadCmd = 0xd // dynamically linked shared lib ident
+	LoadCmdDylinker           LoadCmd = 0xf // id dylinker command (not load dylinker command)
+	LoadCmdSegment64          LoadCmd = 0x19
+	LoadCmdSignature          LoadCmd = 0x1d
+	LoadCmdUUID               LoadCmd = 0x1b // the uuid
+	LoadCmdSplitInfo          LoadCmd = 0x1e // Segment Split Info
+	LoadCmdDyldInfo           LoadCmd = 0x22 // Dynamic Linker Info
+	LoadCmdFuncStarts         LoadCmd = 0x26 // Function Starts
+	LoadCmdLazyDylib          LoadCmd = 0x20 // delay load of dylib until first use
+	LoadCmdEncryptionInfo     LoadCmd = 0x21 // encrypted segment information
+	LoadCmdVersionMinMacosx   LoadCmd = 0x24 // build for MacOSX min OS version
+	LoadCmdVersionMinIphoneos LoadCmd = 0x25 // build for iPhoneOS min OS version
+	LoadCmdDataInCode         LoadCmd = 0x29 // Data In Code
+	LoadCmdSourceVersion      LoadCmd = 0x2a // source version used to build binary
+	LoadCmdSignDrs            LoadCmd = 0x2b // Code Signing DRs copied from linked dylibs
+	LoadCmdEncryptionInfo64   LoadCmd = 0x2c // 64-bit encrypted segment information
+	LoadCmdLinkerOption       LoadCmd = 0x2d // linker options in MH_OBJECT files
+	LoadCmdOptHint            LoadCmd = 0x2e // Linker Optimization Hints
+	LoadCmdVersionMinTvos     LoadCmd = 0x2f // build for AppleTV min OS version
+	LoadCmdVersionMinWatchos  LoadCmd = 0x30 // build for Watch min OS version
+	LoadCmdNote               LoadCmd = 0x31 // arbitrary data included within a Mach-O file
+	LoadCmdBuildVersion       LoadCmd = 0x32 // build for platform min OS version
+
+	LoadReqDyld             LoadCmd = 0x80000000
+	LoadCmdMain             LoadCmd = (0x28 | LoadReqDyld) // replacement for LC_UNIXTHREAD
+	LoadCmdWeakDylib        LoadCmd = (0x18 | LoadReqDyld) // load a dylib that is allowed to be missing
+	LoadCmdRpath            LoadCmd = 0x8000001c
+	LoadCmdReexportDylib    LoadCmd = (0x1f | LoadReqDyld) // load and re-export dylib
+	LoadCmdDylinkInfo       LoadCmd = 0x80000022           // Dynamic Linker Info Only
+	LoadCmdUpwardDylib      LoadCmd = (0x23 | LoadReqDyld) // load upward dylib
+	LoadCmdDyldExportsTrie  LoadCmd = (0x33 | LoadReqDyld)
+	LoadCmdDyldChainedFixup LoadCmd = (0x34 | LoadReqDyld)
 )
 
 var cmdStrings = []intName{
@@ -112,6 +133,32 @@ var cmdStrings = []intName{
 	{uint32(LoadCmdFuncStarts), "LoadCmdFuncStarts"},
 	{uint32(LoadCmdDataInCode), "LoadCmdDataInCode"},
 	{uint32(LoadCmdDylinkInfo), "LoadCmdDylinkInfo"},
+	{uint32(LoadCmdIdDylib), "LoadCmdIdDylib"},
+	{uint32(LoadCmdLazyDylib), "LoadCmdLazyDylib"},
+	{uint32(LoadCmdWeakDylib), "LoadCmdWeakDylib"},
+	{uint32(LoadCmdReexportDylib), "LoadCmdReexportDylib"},
+	{uint32(LoadCmdUpwardDylib), "LoadCmdUpwardDylib"},
+	{uint32(LoadCmdSymtab), "LoadCmdSymtab"},
+	{uint32(LoadCmdDysymtab), "LoadCmdDysymtab"},
+	{uint32(LoadCmdDylinker), "LoadCmdDylinker"},
+	{uint32(LoadCmdMain), "LoadCmdMain"},
+	{uint32(LoadCmdSplitInfo), "LoadCmdSplitInfo"},
+	{uint32(LoadCmdDyldInfo), "LoadCmdDyldInfo"},
+	{uint32(LoadCmdSignDrs), "LoadCmdSignDrs"},
+	{uint32(LoadCmdOptHint), "LoadCmdOptHint"},
+	{uint32(LoadCmdDyldExportsTrie), "LoadCmdDyldExportsTrie"},
+	{uint32(LoadCmdDyldChainedFixup), "LoadCmdDyldChainedFixup"},
+	{uint32(LoadCmdUUID), "LoadCmdUUID"},
+	{uint32(LoadCmdEncryptionInfo), "LoadCmdEncryptionInfo"},
+	{uint32(LoadCmdEncryptionInfo64), "LoadCmdEncryptionInfo64"},
+	{uint32(LoadCmdVersionMinMacosx), "LoadCmdVersionMinMacosx"},
+	{uint32(LoadCmdVersionMinIphoneos), "LoadCmdVersionMinIphoneos"},
+	{uint32(LoadCmdVersionMinTvos), "LoadCmdVersionMinTvos"},
+	{uint32(LoadCmdVersionMinWatchos), "LoadCmdVersionMinWatchos"},
+	{uint32(LoadCmdSourceVersion), "LoadCmdSourceVersion"},
+	{uint32(LoadCmdLinkerOption), "LoadCmdLinkerOption"},
+	{uint32(LoadCmdNote), "LoadCmdNote"},
+	{uint32(LoadCmdBuildVersion), "LoadCmdBuildVersion"},
 }
 
 func (i LoadCmd) String() string   { return stringName(uint32(i), cmdStrings, false) }
@@ -225,6 +272,14 @@ type (
 		Datasize uint32
 	}
 
+	// A LinkEditDataCmd is a Mach-O load command referring to a blob of __LINKEDIT data
+	LinkEditDataCmd struct {
+		Cmd      LoadCmd
+		Len      uint32
+		Dataoff  uint32
+		Datasize uint32
+	}
+
 	// A DataInCodeCmd is a Mach-O load for Data In Code command
 	DataInCodeCmd struct {
 		Cmd      LoadCmd
@@ -271,6 +326,100 @@ type (
 		EntryOff  uint64 /* file (__TEXT) offset of main() */
 		StackSize uint64 /* if not zero, initial stack size */
 	}
+
+	// A UUIDCmd is a Mach-O uuid command.
+	UUIDCmd struct {
+		Cmd  LoadCmd
+		Len  uint32
+		UUID [16]byte
+	}
+
+	// A BuildVersionCmd is a Mach-O build version command, followed by Ntools BuildTool entries.
+	BuildVersionCmd struct {
+		Cmd      LoadCmd
+		Len      uint32
+		Platform uint32
+		Minos    uint32 // X.Y.Z is encoded in nibbles xxxx.yy.zz
+		Sdk      uint32 // X.Y.Z is encoded in nibbles xxxx.yy.zz
+		Ntools   uint32
+	}
+
+	// A BuildTool is a tool entry of a Mach-O build version command.
+	BuildTool struct {
+		Tool    uint32
+		Version uint32
+	}
+
+	// A VersionMinCmd is a Mach-O LC_VERSION_MIN_* command.
+	VersionMinCmd struct {
+		Cmd     LoadCmd
+		Len     uint32
+		Version uint32 // X.Y.Z is encoded in nibbles xxxx.yy.zz
+		Sdk     uint32
+	}
+
+	// A SourceVersionCmd is a Mach-O source version command.
+	SourceVersionCmd struct {
+		Cmd     LoadCmd
+		Len     uint32
+		Version uint64 // A.B.C.D.E packed as a24.b10.c10.d10.e10
+	}
+
+	// An EncryptionInfoCmd is a Mach-O 32-bit encryption info command.
+	EncryptionInfoCmd struct {
+		Cmd       LoadCmd
+		Len       uint32
+		Cryptoff  uint32
+		Cryptsize uint32
+		Cryptid   uint32
+	}
+
+	// An EncryptionInfo64Cmd is a Mach-O 64-bit encryption info command.
+	EncryptionInfo64Cmd struct {
+		Cmd       LoadCmd
+		Len       uint32
+		Cryptoff  uint32
+		Cryptsize uint32
+		Cryptid   uint32
+		Pad       uint32
+	}
+
+	// A LinkerOptionCmd is a Mach-O linker option command, followed by Count strings.
+	LinkerOptionCmd struct {
+		Cmd   LoadCmd
+		Len   uint32
+		Count uint32
+	}
+
+	// A NoteCmd is a Mach-O note command.
+	NoteCmd struct {
+		Cmd       LoadCmd
+		Len       uint32
+		DataOwner [16]byte
+		Offset    uint64
+		Size      uint64
+	}
+)
+
+// Platforms of a build version command
+const (
+	PlatformMacOS            = 1
+	PlatformIOS              = 2
+	PlatformTvOS             = 3
+	PlatformWatchOS          = 4
+	PlatformBridgeOS         = 5
+	PlatformMacCatalyst      = 6
+	PlatformIOSSimulator     = 7
+	PlatformTvOSSimulator    = 8
+	PlatformWatchOSSimulator = 9
+	PlatformDriverKit        = 10
+)
+
+// Tools of a build version command
+const (
+	ToolClang = 1
+	ToolSwift = 2
+	ToolLD    = 3
 )
 
 const (
@@ -302,6 +451,14 @@ const (
 	FlagAppExtensionSafe      uint32 = 0x2000000
 )
 
+// Section types (the low byte of the section Flags)
+const (
+	sectionTypeMask            = 0xff
+	SectionZerofill            = 0x1
+	SectionGBZerofill          = 0xc
+	SectionThreadLocalZerofill = 0x12
+)
+
 // A Section32 is a 32-bit Mach-O section header.
 type Section32 struct {
 	Name     [16]byte
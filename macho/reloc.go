@@ -0,0 +1,69 @@
+package macho
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// scatteredRelocs reports whether cpu has scattered relocations.
+func scatteredRelocs(cpu Cpu) bool {
+	switch cpu {
+	case CpuAmd64, CpuArm64:
+		return false
+	}
+	return true
+}
+
+// encodeReloc packs r as a relocation_info or scattered_relocation_info entry.
+func (f *File) encodeReloc(r *Reloc) ([2]uint32, error) {
+	// types are only checked to fit, as new ones, such as the arm64e
+	// authenticated pointers, keep being added
+	switch {
+	case r.Type > 15:
+		return [2]uint32{}, fmt.Errorf("type %d does not fit in 4 bits", r.Type)
+	case r.Len > 3:
+		return [2]uint32{}, fmt.Errorf("length %d does not fit in 2 bits", r.Len)
+	case r.Scattered && !scatteredRelocs(f.Cpu):
+		return [2]uint32{}, fmt.Errorf("cpu %v has no scattered relocations", f.Cpu)
+	}
+
+	var pcrel, extern uint32
+	if r.Pcrel {
+		pcrel = 1
+	}
+	if r.Extern {
+		extern = 1
+	}
+	if r.Scattered {
+		// the address is then only 24 bits, and the value takes the second word
+		if r.Addr >= 1<<24 {
+			return [2]uint32{}, fmt.Errorf("address 0x%x of scattered relocation does not fit in 24 bits", r.Addr)
+		}
+		return [2]uint32{1<<31 | pcrel<<30 | uint32(r.Len)<<28 | uint32(r.Type)<<24 | r.Addr, r.Value}, nil
+	}
+	if r.Addr&(1<<31) != 0 {
+		return [2]uint32{}, fmt.Errorf("address 0x%x of relocation would read as scattered", r.Addr)
+	}
+	if r.Value >= 1<<24 {
+		return [2]uint32{}, fmt.Errorf("symbol or section number %d does not fit in 24 bits", r.Value)
+	}
+	// the bit fields are laid out from the other end of the word on big endian cpus
+	if f.ByteOrder == binary.BigEndian {
+		return [2]uint32{r.Addr, r.Value<<8 | pcrel<<7 | uint32(r.Len)<<5 | extern<<4 | uint32(r.Type)}, nil
+	}
+	return [2]uint32{r.Addr, r.Value | pcrel<<24 | uint32(r.Len)<<25 | extern<<27 | uint32(r.Type)<<28}, nil
+}
+
+// encodeRelocs serializes the relocations of s.
+func (f *File) encodeRelocs(s *Section) ([]byte, error) {
+	dat := make([]byte, 8*len(s.Relocs))
+	for i := range s.Relocs {
+		w, err := f.encodeReloc(&s.Relocs[i])
+		if err != nil {
+			return nil, fmt.Errorf("relocation %d of section %s,%s: %v", i, s.Seg, s.Name, err)
+		}
+		f.ByteOrder.PutUint32(dat[8*i:], w[0])
+		f.ByteOrder.PutUint32(dat[8*i+4:], w[1])
+	}
+	return dat, nil
+}
@@ -0,0 +1,64 @@
+package macho
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestRelocWrite(t *testing.T) {
+	for _, name := range []string{"testdata/clang-386-darwin.obj", "testdata/clang-amd64-darwin.obj"} {
+		f, err := Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		text := f.Section("__text")
+		if len(text.Relocs) == 0 {
+			t.Fatalf("%s: no relocations in __text", name)
+		}
+		text.Relocs[0].Addr += 4
+		text.Relocs = append(text.Relocs, Reloc{Addr: 0x10, Value: 1, Type: 0, Len: 2, Extern: true})
+		want := append([]Reloc(nil), text.Relocs...)
+		dat, err := f.Bytes()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		f.Close()
+		g, err := NewFile(bytes.NewReader(dat))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if have := g.Section("__text").Relocs; !reflect.DeepEqual(have, want) {
+			t.Errorf("%s: relocations are\n\t%#v\nwant\n\t%#v", name, have, want)
+		}
+	}
+}
+
+func TestRelocWriteInvalid(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, r := range []Reloc{
+		{Addr: 0, Value: 1, Type: 16},
+		{Addr: 0, Value: 1, Len: 4},
+		{Addr: 0, Value: 1 << 24, Extern: true},
+		{Addr: 0, Value: 0x100, Scattered: true},
+	} {
+		if _, err := f.encodeReloc(&r); err == nil {
+			t.Errorf("relocation %+v was encoded", r)
+		}
+	}
+
+	// types without a constant, such as ARM64_RELOC_AUTHENTICATED_POINTER, are kept
+	f.Cpu = CpuArm64
+	r := Reloc{Addr: 0x10, Value: 1, Type: 11, Len: 3, Extern: true}
+	w, err := f.encodeReloc(&r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ := w[1] >> 28; typ != 11 {
+		t.Errorf("arm64e relocation type was encoded as %d", typ)
+	}
+}
@@ -0,0 +1,322 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const N_STAB = 0xE0
+const N_TYPE = 0x0E
+const N_UNDF = 0x00
+const N_ABS = 0x02
+const N_INDR = 0x0A
+const N_PBUD = 0x0C
+
+// Indirect symbol table entries that do not refer to a symbol
+const (
+	INDIRECT_SYMBOL_LOCAL = 0x80000000
+	INDIRECT_SYMBOL_ABS   = 0x40000000
+)
+
+// Symbol partitions of the dynamic symbol table, in the order they are laid out
+const (
+	symLocal = iota
+	symExtdef
+	symUndef
+)
+
+// symbolPartition returns the partition of the dynamic symbol table s belongs to.
+func symbolPartition(s *Symbol) int {
+	switch {
+	case s.Type&N_STAB != 0 || s.Type&N_EXT == 0:
+		return symLocal
+	case s.Type&N_TYPE == N_UNDF || s.Type&N_TYPE == N_PBUD:
+		return symUndef
+	}
+	return symExtdef
+}
+
+// symbolsChanged reports whether the symbols differ from the ones read from the file.
+func (st *Symtab) symbolsChanged() bool {
+	if st.ids != nil || len(st.Syms) != len(st.syms) {
+		return true
+	}
+	for i := range st.Syms {
+		if st.Syms[i] != st.syms[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveSymbol removes Syms[i]. Symbols must be removed this way rather than
+// by editing Syms, so that the remaining ones are still matched to the ones
+// read from the file. Writing the file fails if the removed symbol is still
+// referred to, by the indirect symbol table or a relocation.
+func (st *Symtab) RemoveSymbol(i int) error {
+	if i < 0 || i >= len(st.Syms) {
+		return fmt.Errorf("symbol %d does not exist", i)
+	}
+	ids := st.symbolIDs()
+	if len(ids) > len(st.Syms) {
+		return errors.New("symbols were removed from Syms directly")
+	}
+	if i < len(ids) {
+		ids = append(ids[:i], ids[i+1:]...)
+	}
+	st.ids = ids
+	st.Syms = append(st.Syms[:i], st.Syms[i+1:]...)
+	return nil
+}
+
+// symbolIDs returns the index in syms of each of Syms, up to the symbols
+// appended since, which have none.
+func (st *Symtab) symbolIDs() []int {
+	if st.ids != nil {
+		return append([]int(nil), st.ids...)
+	}
+	ids := make([]int, len(st.syms))
+	for i := range ids {
+		ids[i] = i
+	}
+	return ids
+}
+
+// removedSymbol marks the symbols of a remap that were removed
+const removedSymbol = ^uint32(0)
+
+// encodeSymtab re-serializes the symbol table and string table when
+// Symtab.Syms was edited. Symbols are matched to the ones read from the file
+// by index, except for the ones taken out by RemoveSymbol: the symbols kept in
+// place are edited, the ones appended are new. They are sorted into the local,
+// defined external and undefined external partitions of the dynamic symbol
+// table, the external ones by name as ld does, and every reference to a symbol
+// index is updated. The string table index of the symbol an N_INDR symbol
+// stands for, kept in its Value, is carried over to the new string table.
+func (f *File) encodeSymtab() error {
+	st := f.Symtab
+	if st == nil || !st.symbolsChanged() {
+		return f.encodeIndirectSyms()
+	}
+	ids := st.symbolIDs()
+	if len(ids) > len(st.Syms) {
+		return errors.New("symbols were removed from Syms directly rather than with RemoveSymbol")
+	}
+
+	order := make([]int, len(st.Syms))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := &st.Syms[order[i]], &st.Syms[order[j]]
+		pa, pb := symbolPartition(a), symbolPartition(b)
+		if pa != pb {
+			return pa < pb
+		}
+		return pa != symLocal && a.Name < b.Name
+	})
+	syms := make([]Symbol, len(order))
+	remap := make([]uint32, len(st.syms))
+	for i := range remap {
+		remap[i] = removedSymbol
+	}
+	var count [3]uint32
+	for i, pos := range order {
+		syms[i] = st.Syms[pos]
+		if pos < len(ids) {
+			remap[ids[pos]] = uint32(i)
+		}
+		count[symbolPartition(&syms[i])]++
+	}
+
+	if err := f.remapSymbols(remap); err != nil {
+		return err
+	}
+
+	// linked images start the string table with a space, so that index 1
+	// is the empty string
+	strtab := []byte{0}
+	if f.Type != TypeObj {
+		strtab = []byte{' ', 0}
+	}
+	strx := map[string]uint32{"": uint32(len(strtab) - 1)}
+	str := func(name string) uint32 {
+		x, ok := strx[name]
+		if !ok {
+			x = uint32(len(strtab))
+			strx[name] = x
+			strtab = append(strtab, name...)
+			strtab = append(strtab, 0)
+		}
+		return x
+	}
+	bo := f.ByteOrder
+	var symdat bytes.Buffer
+	for i := range syms {
+		s := &syms[i]
+		x := str(s.Name)
+		if s.Type&N_STAB == 0 && s.Type&N_TYPE == N_INDR {
+			if s.Value >= uint64(len(st.RawStringtab)) {
+				return fmt.Errorf("indirect symbol %s refers to string 0x%x, past the string table", s.Name, s.Value)
+			}
+			s.Value = uint64(str(cstring(st.RawStringtab[s.Value:])))
+		}
+		if f.Magic == Magic64 {
+			binary.Write(&symdat, bo, &Nlist64{Name: x, Type: s.Type, Sect: s.Sect, Desc: s.Desc, Value: s.Value})
+		} else {
+			if s.Value > 0xffffffff {
+				return fmt.Errorf("value 0x%x of symbol %s does not fit in 32 bits", s.Value, s.Name)
+			}
+			binary.Write(&symdat, bo, &Nlist32{Name: x, Type: s.Type, Sect: s.Sect, Desc: s.Desc, Value: uint32(s.Value)})
+		}
+	}
+	strtab = append(strtab, make([]byte, alignUp(uint64(len(strtab)), f.ptrSize())-uint64(len(strtab)))...)
+
+	st.Syms = syms
+	st.syms = append([]Symbol(nil), syms...)
+	st.ids = nil
+	st.RawSymtab = symdat.Bytes()
+	st.RawStringtab = strtab
+
+	if dst := f.Dysymtab; dst != nil {
+		dst.Ilocalsym, dst.Nlocalsym = 0, count[symLocal]
+		dst.Iextdefsym, dst.Nextdefsym = count[symLocal], count[symExtdef]
+		dst.Iundefsym, dst.Nundefsym = count[symLocal]+count[symExtdef], count[symUndef]
+	}
+	return f.encodeIndirectSyms()
+}
+
+// remapSymbols updates the references to symbol indices of the dynamic
+// symbol table and of the relocations, remap giving the new index of each old one.
+func (f *File) remapSymbols(remap []uint32) error {
+	moved := false
+	for i, n := range remap {
+		if uint32(i) != n {
+			moved = true
+			break
+		}
+	}
+	index := func(old uint32) (uint32, error) {
+		if old >= uint32(len(remap)) || remap[old] == removedSymbol {
+			return 0, fmt.Errorf("symbol %d is referred to but was removed", old)
+		}
+		return remap[old], nil
+	}
+
+	// the references are all mapped before any is replaced, so that f is
+	// left as it was if one of them was removed
+	var apply []func()
+	if dst := f.Dysymtab; dst != nil {
+		indirect := append([]uint32(nil), dst.IndirectSyms...)
+		for i, x := range indirect {
+			if x&(INDIRECT_SYMBOL_LOCAL|INDIRECT_SYMBOL_ABS) != 0 {
+				continue
+			}
+			n, err := index(x)
+			if err != nil {
+				return fmt.Errorf("indirect symbol %d: %v", i, err)
+			}
+			indirect[i] = n
+		}
+		if moved && (len(dst.rawModtab) > 0 || len(dst.rawExtrefsyms) > 0) {
+			return fmt.Errorf("cannot reorder the symbols of a file with a module table")
+		}
+		// a table of contents entry starts with the index of its symbol
+		toc := append([]byte(nil), dst.rawToc...)
+		for i := 0; i+8 <= len(toc); i += 8 {
+			n, err := index(f.ByteOrder.Uint32(toc[i:]))
+			if err != nil {
+				return fmt.Errorf("table of contents entry %d: %v", i/8, err)
+			}
+			f.ByteOrder.PutUint32(toc[i:], n)
+		}
+		extrel := append([]byte(nil), dst.rawExtrel...)
+		if err := f.remapRelocs(extrel, index); err != nil {
+			return fmt.Errorf("external relocation %v", err)
+		}
+		apply = append(apply, func() {
+			dst.IndirectSyms = indirect
+			if dst.rawToc != nil {
+				dst.rawToc = toc
+			}
+			if dst.rawExtrel != nil {
+				dst.rawExtrel = extrel
+			}
+		})
+	}
+
+	for _, s := range f.Sections {
+		if len(s.Relocs) == 0 {
+			continue
+		}
+		relocs := append([]Reloc(nil), s.Relocs...)
+		for i := range relocs {
+			r := &relocs[i]
+			if r.Scattered || !r.Extern {
+				continue
+			}
+			n, err := index(r.Value)
+			if err != nil {
+				return fmt.Errorf("relocation %d of section %s,%s: %v", i, s.Seg, s.Name, err)
+			}
+			r.Value = n
+		}
+		s := s
+		apply = append(apply, func() { s.Relocs = relocs })
+	}
+	for _, fn := range apply {
+		fn()
+	}
+	return nil
+}
+
+// remapRelocs updates the symbol numbers of the external relocations of dat
+// in place.
+func (f *File) remapRelocs(dat []byte, index func(uint32) (uint32, error)) error {
+	bo := f.ByteOrder
+	for i := 0; i+8 <= len(dat); i += 8 {
+		if bo.Uint32(dat[i:])&(1<<31) != 0 { // scattered
+			continue
+		}
+		w := bo.Uint32(dat[i+4:])
+		if bo == binary.BigEndian {
+			if w&(1<<4) == 0 {
+				continue
+			}
+			n, err := index(w >> 8)
+			if err != nil {
+				return fmt.Errorf("%d: %v", i/8, err)
+			}
+			w = w&0xff | n<<8
+		} else {
+			if w&(1<<27) == 0 {
+				continue
+			}
+			n, err := index(w & (1<<24 - 1))
+			if err != nil {
+				return fmt.Errorf("%d: %v", i/8, err)
+			}
+			w = w&^(1<<24-1) | n
+		}
+		bo.PutUint32(dat[i+4:], w)
+	}
+	return nil
+}
+
+// encodeIndirectSyms re-serializes the indirect symbol table from
+// Dysymtab.IndirectSyms.
+func (f *File) encodeIndirectSyms() error {
+	dst := f.Dysymtab
+	if dst == nil {
+		return nil
+	}
+	dat := make([]byte, 4*len(dst.IndirectSyms))
+	for i, x := range dst.IndirectSyms {
+		f.ByteOrder.PutUint32(dat[4*i:], x)
+	}
+	dst.RawDysymtab = dat
+	return nil
+}
@@ -0,0 +1,190 @@
+package macho
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestSymtabReencode(t *testing.T) {
+	for _, tt := range fileTests {
+		f, err := Open(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Symtab == nil {
+			f.Close()
+			continue
+		}
+		// encode the unchanged symbols again, as if they had been edited
+		f.Symtab.ids = f.Symtab.symbolIDs()
+		have, err := f.Bytes()
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+			continue
+		}
+		want, err := ioutil.ReadFile(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("%s: symbol table is not encoded as ld does", tt.file)
+		}
+		f.Close()
+	}
+}
+
+func TestSymtabEdit(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-darwin-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for i := range f.Symtab.Syms {
+		if f.Symtab.Syms[i].Name == "_main" {
+			f.Symtab.Syms[i].Name = "_zmain"
+		}
+	}
+	f.Symtab.Syms = append(f.Symtab.Syms,
+		Symbol{Name: "_abort", Type: N_UNDF | N_EXT, Desc: 1 << 8},
+		Symbol{Name: "_helper", Type: N_SECT, Sect: 1, Value: 0x100000f60},
+	)
+	dat, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(dat))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, s := range g.Symtab.Syms {
+		names = append(names, s.Name)
+	}
+	want := []string{
+		"dyld_stub_binding_helper", "__dyld_func_lookup", "_helper",
+		"_NXArgc", "_NXArgv", "___progname", "__mh_execute_header", "_environ", "_zmain", "start",
+		"_abort", "_exit", "_puts",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("symbols are %q, want %q", names, want)
+	}
+	dst := g.Dysymtab
+	if dst.Ilocalsym != 0 || dst.Nlocalsym != 3 || dst.Iextdefsym != 3 || dst.Nextdefsym != 7 || dst.Iundefsym != 10 || dst.Nundefsym != 3 {
+		t.Errorf("dynamic symbol table partitions are %+v", dst.DysymtabCmd)
+	}
+	if imports, _ := g.ImportedSymbols(); !reflect.DeepEqual(imports, []string{"_abort", "_exit", "_puts"}) {
+		t.Errorf("imported symbols are %q", imports)
+	}
+	var indirect []string
+	for _, x := range dst.IndirectSyms {
+		indirect = append(indirect, g.Symtab.Syms[x].Name)
+	}
+	if !reflect.DeepEqual(indirect, []string{"_exit", "_puts", "_exit", "_puts"}) {
+		t.Errorf("indirect symbols are %q", indirect)
+	}
+}
+
+func TestSymtabEditObject(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Symtab.Syms = append(f.Symtab.Syms, Symbol{Name: "l_str", Type: N_SECT, Sect: 2})
+	dat, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(dat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Symtab.Syms[0].Name != "l_str" {
+		t.Errorf("local symbol is not first: %+v", g.Symtab.Syms)
+	}
+	found := false
+	for _, s := range g.Sections {
+		for _, r := range s.Relocs {
+			if r.Scattered || !r.Extern {
+				continue
+			}
+			if name := g.Symtab.Syms[r.Value].Name; name == "_printf" {
+				found = true
+			} else {
+				t.Errorf("external relocation of %s at 0x%x refers to %s", s.Name, r.Addr, name)
+			}
+		}
+	}
+	if !found {
+		t.Error("no relocation refers to _printf")
+	}
+}
+
+func TestSymtabRemove(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-darwin-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	st := f.Symtab
+	index := func(name string) int {
+		for i, s := range st.Syms {
+			if s.Name == name {
+				return i
+			}
+		}
+		t.Fatalf("no symbol %s", name)
+		return -1
+	}
+
+	// _alias stands for _puts through the string table
+	puts := bytes.Index(st.RawStringtab, []byte("_puts\x00"))
+	st.Syms = append(st.Syms, Symbol{Name: "_alias", Type: N_INDR | N_EXT, Value: uint64(puts)})
+	if err := st.RemoveSymbol(index("dyld_stub_binding_helper")); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.RemoveSymbol(index("_NXArgc")); err != nil {
+		t.Fatal(err)
+	}
+	dat, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(dat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var indirect []string
+	for _, x := range g.Dysymtab.IndirectSyms {
+		indirect = append(indirect, g.Symtab.Syms[x].Name)
+	}
+	if !reflect.DeepEqual(indirect, []string{"_exit", "_puts", "_exit", "_puts"}) {
+		t.Errorf("indirect symbols are %q", indirect)
+	}
+	for _, s := range g.Symtab.Syms {
+		switch s.Name {
+		case "dyld_stub_binding_helper", "_NXArgc":
+			t.Errorf("removed symbol %s was written", s.Name)
+		case "_alias":
+			if s.Value >= uint64(len(g.Symtab.RawStringtab)) || cstring(g.Symtab.RawStringtab[s.Value:]) != "_puts" {
+				t.Errorf("indirect symbol _alias does not stand for _puts after rewriting")
+			}
+		}
+	}
+
+	// symbols still referred to cannot be removed
+	if err := st.RemoveSymbol(index("_puts")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Bytes(); err == nil {
+		t.Error("removed a symbol the indirect symbol table refers to")
+	}
+
+	g.Symtab.Syms = g.Symtab.Syms[1:]
+	if _, err := g.Bytes(); err == nil {
+		t.Error("symbols removed from Syms directly were matched by index")
+	}
+}
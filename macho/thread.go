@@ -0,0 +1,266 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Thread state flavors
+const (
+	X86_THREAD_STATE32   = 1
+	X86_THREAD_STATE64   = 4
+	X86_THREAD_STATE     = 7 // a flavor and count, then the 32-bit or 64-bit state
+	ARM_THREAD_STATE     = 1
+	ARM_THREAD_STATE64   = 6
+	x86StateHeaderLength = 2
+)
+
+// RegsARM is the Mach-O ARM register structure.
+type RegsARM struct {
+	R    [13]uint32
+	SP   uint32
+	LR   uint32
+	PC   uint32
+	CPSR uint32
+}
+
+// RegsARM64 is the Mach-O ARM64 register structure.
+type RegsARM64 struct {
+	X    [29]uint64
+	FP   uint64
+	LR   uint64
+	SP   uint64
+	PC   uint64
+	CPSR uint32
+	Pad  uint32
+}
+
+// A ThreadState is one flavor of register state of a thread command.
+type ThreadState struct {
+	Flavor uint32
+	Data   []uint32 // Count words of state
+}
+
+// A ThreadCommand represents a Mach-O LC_UNIXTHREAD or LC_THREAD command,
+// the initial state of the main thread of an executable.
+type ThreadCommand struct {
+	LoadBytes
+	Cmd    LoadCmd
+	States []ThreadState
+
+	bo binary.ByteOrder
+}
+
+// byteOrder returns the byte order of the command, little endian for
+// commands not read from a file.
+func (t *ThreadCommand) byteOrder() binary.ByteOrder {
+	if t.bo == nil {
+		return binary.LittleEndian
+	}
+	return t.bo
+}
+
+func (t *ThreadCommand) Raw() []byte {
+	bo := t.byteOrder()
+	var buf bytes.Buffer
+	binary.Write(&buf, bo, [2]uint32{uint32(t.Cmd), 0})
+	for _, s := range t.States {
+		binary.Write(&buf, bo, [2]uint32{s.Flavor, uint32(len(s.Data))})
+		binary.Write(&buf, bo, s.Data)
+	}
+	raw := buf.Bytes()
+	bo.PutUint32(raw[4:], uint32(len(raw)))
+	return raw
+}
+
+func decodeThread(cmd LoadCmd, cmddat []byte, bo binary.ByteOrder) (*ThreadCommand, error) {
+	t := &ThreadCommand{LoadBytes: LoadBytes(cmddat), Cmd: cmd, bo: bo}
+	for d := cmddat[8:]; len(d) >= 8; {
+		s := ThreadState{Flavor: bo.Uint32(d)}
+		count := uint64(bo.Uint32(d[4:]))
+		d = d[8:]
+		if count*4 > uint64(len(d)) {
+			return nil, fmt.Errorf("thread state flavor %d extends past the command", s.Flavor)
+		}
+		s.Data = make([]uint32, count)
+		for i := range s.Data {
+			s.Data[i] = bo.Uint32(d[i*4:])
+		}
+		d = d[count*4:]
+		t.States = append(t.States, s)
+	}
+	return t, nil
+}
+
+// regsFlavor returns the flavor and size in words of the register state of cpu.
+func regsFlavor(cpu Cpu) (flavor uint32, count int, regs interface{}, err error) {
+	switch cpu {
+	case Cpu386:
+		return X86_THREAD_STATE32, 16, new(Regs386), nil
+	case CpuAmd64:
+		return X86_THREAD_STATE64, 42, new(RegsAMD64), nil
+	case CpuArm:
+		return ARM_THREAD_STATE, 17, new(RegsARM), nil
+	case CpuArm64:
+		return ARM_THREAD_STATE64, 68, new(RegsARM64), nil
+	}
+	return 0, 0, nil, fmt.Errorf("no register state for cpu %v", cpu)
+}
+
+// regsState returns the state holding the general purpose registers of cpu,
+// and where they start in its data.
+func (t *ThreadCommand) regsState(cpu Cpu) (*ThreadState, int, error) {
+	flavor, count, _, err := regsFlavor(cpu)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range t.States {
+		s := &t.States[i]
+		start := 0
+		if (cpu == Cpu386 || cpu == CpuAmd64) && s.Flavor == X86_THREAD_STATE && len(s.Data) >= x86StateHeaderLength {
+			// the generic x86 state wraps the 32-bit or 64-bit one
+			if s.Data[0] != flavor {
+				continue
+			}
+			start = x86StateHeaderLength
+		} else if s.Flavor != flavor {
+			continue
+		}
+		if len(s.Data)-start < count {
+			return nil, 0, fmt.Errorf("thread state flavor %d is too short", s.Flavor)
+		}
+		return s, start, nil
+	}
+	return nil, 0, fmt.Errorf("no general purpose register state for cpu %v", cpu)
+}
+
+// Regs decodes the general purpose registers of cpu, which are returned as a
+// *Regs386, *RegsAMD64, *RegsARM or *RegsARM64.
+func (t *ThreadCommand) Regs(cpu Cpu) (interface{}, error) {
+	s, start, err := t.regsState(cpu)
+	if err != nil {
+		return nil, err
+	}
+	_, count, regs, _ := regsFlavor(cpu)
+	var buf bytes.Buffer
+	binary.Write(&buf, t.byteOrder(), s.Data[start:start+count])
+	if err := binary.Read(&buf, t.byteOrder(), regs); err != nil {
+		return nil, err
+	}
+	return regs, nil
+}
+
+// SetRegs replaces the general purpose registers of cpu, given as returned by Regs.
+func (t *ThreadCommand) SetRegs(cpu Cpu, regs interface{}) error {
+	s, start, err := t.regsState(cpu)
+	if err != nil {
+		return err
+	}
+	_, count, want, _ := regsFlavor(cpu)
+	if reflect.TypeOf(regs) != reflect.TypeOf(want) {
+		return fmt.Errorf("registers of cpu %v are %T, not %T", cpu, want, regs)
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, t.byteOrder(), regs)
+	words := make([]uint32, count)
+	if err := binary.Read(&buf, t.byteOrder(), words); err != nil {
+		return err
+	}
+	copy(s.Data[start:], words)
+	return nil
+}
+
+// PC returns the program counter of cpu.
+func (t *ThreadCommand) PC(cpu Cpu) (uint64, error) {
+	regs, err := t.Regs(cpu)
+	if err != nil {
+		return 0, err
+	}
+	switch r := regs.(type) {
+	case *Regs386:
+		return uint64(r.IP), nil
+	case *RegsAMD64:
+		return r.IP, nil
+	case *RegsARM:
+		return uint64(r.PC), nil
+	case *RegsARM64:
+		return r.PC, nil
+	}
+	panic("unreachable")
+}
+
+// SetPC sets the program counter of cpu.
+func (t *ThreadCommand) SetPC(cpu Cpu, pc uint64) error {
+	regs, err := t.Regs(cpu)
+	if err != nil {
+		return err
+	}
+	switch r := regs.(type) {
+	case *Regs386:
+		if pc > 0xffffffff {
+			return fmt.Errorf("pc 0x%x does not fit in 32 bits", pc)
+		}
+		r.IP = uint32(pc)
+	case *RegsAMD64:
+		r.IP = pc
+	case *RegsARM:
+		if pc > 0xffffffff {
+			return fmt.Errorf("pc 0x%x does not fit in 32 bits", pc)
+		}
+		r.PC = uint32(pc)
+	case *RegsARM64:
+		r.PC = pc
+	}
+	return t.SetRegs(cpu, regs)
+}
+
+// Thread returns the LC_UNIXTHREAD or, failing that, the first LC_THREAD
+// command of the file, or nil if it has none.
+func (f *File) Thread() *ThreadCommand {
+	var thread *ThreadCommand
+	for _, l := range f.Loads {
+		if t, ok := l.(*ThreadCommand); ok {
+			if t.Cmd == LoadCmdUnixThread {
+				return t
+			}
+			if thread == nil {
+				thread = t
+			}
+		}
+	}
+	return thread
+}
+
+// threadEntryPoint derives EntryPoint from the PC of the thread command, as
+// an offset from the start of __TEXT like the one of LC_MAIN.
+func (f *File) threadEntryPoint() (uint64, bool) {
+	t := f.Thread()
+	text := f.Segment("__TEXT")
+	if t == nil || text == nil {
+		return 0, false
+	}
+	pc, err := t.PC(f.Cpu)
+	if err != nil || pc < text.Addr {
+		return 0, false
+	}
+	return pc - text.Addr + text.Offset, true
+}
+
+// SetEntryPC rewrites the PC of the thread command to the address pc, and
+// updates EntryPoint accordingly.
+func (f *File) SetEntryPC(pc uint64) error {
+	t := f.Thread()
+	if t == nil {
+		return errors.New("file has no thread command")
+	}
+	if err := t.SetPC(f.Cpu, pc); err != nil {
+		return err
+	}
+	if ep, ok := f.threadEntryPoint(); ok {
+		f.EntryPoint = ep
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package macho
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestThreadEntryPoint(t *testing.T) {
+	for _, name := range []string{"testdata/gcc-386-darwin-exec", "testdata/gcc-amd64-darwin-exec"} {
+		f, err := Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		th := f.Thread()
+		if th == nil || th.Cmd != LoadCmdUnixThread {
+			t.Fatalf("%s: no LC_UNIXTHREAD command", name)
+		}
+		pc, err := th.PC(f.Cpu)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		text := f.Section("__text")
+		if pc != text.Addr {
+			t.Errorf("%s: pc is 0x%x, want the start of __text 0x%x", name, pc, text.Addr)
+		}
+		if want := uint64(text.Offset); f.EntryPoint != want {
+			t.Errorf("%s: entry point is 0x%x, want 0x%x", name, f.EntryPoint, want)
+		}
+		if !bytes.Equal(th.Raw(), th.LoadBytes) {
+			t.Errorf("%s: thread command does not re-encode to its bytes", name)
+		}
+
+		if err := f.SetEntryPC(pc + 0x10); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if want := uint64(text.Offset) + 0x10; f.EntryPoint != want {
+			t.Errorf("%s: entry point after SetEntryPC is 0x%x, want 0x%x", name, f.EntryPoint, want)
+		}
+		dat, err := f.Bytes()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		f.Close()
+		g, err := NewFile(bytes.NewReader(dat))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got, err := g.Thread().PC(g.Cpu); err != nil || got != pc+0x10 {
+			t.Errorf("%s: pc after rewrite is 0x%x, %v, want 0x%x", name, got, err, pc+0x10)
+		}
+		if g.EntryPoint != uint64(text.Offset)+0x10 {
+			t.Errorf("%s: entry point after rewrite is 0x%x", name, g.EntryPoint)
+		}
+	}
+}
+
+func TestThreadRegs(t *testing.T) {
+	th := &ThreadCommand{Cmd: LoadCmdUnixThread}
+	th.States = []ThreadState{{Flavor: ARM_THREAD_STATE64, Data: make([]uint32, 68)}}
+	if err := th.SetPC(CpuArm64, 0x100003f80); err != nil {
+		t.Fatal(err)
+	}
+	regs, err := th.Regs(CpuArm64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := regs.(*RegsARM64); r.PC != 0x100003f80 {
+		t.Errorf("arm64 pc is 0x%x", r.PC)
+	}
+	if _, err := th.Regs(CpuArm); err == nil {
+		t.Error("arm registers decoded from an arm64 state")
+	}
+
+	// the generic x86 state wraps the 64-bit one
+	th.States = []ThreadState{{Flavor: X86_THREAD_STATE, Data: append([]uint32{X86_THREAD_STATE64, 42}, make([]uint32, 42)...)}}
+	if err := th.SetPC(CpuAmd64, 0x1000); err != nil {
+		t.Fatal(err)
+	}
+	if pc, err := th.PC(CpuAmd64); err != nil || pc != 0x1000 {
+		t.Errorf("amd64 pc is 0x%x, %v", pc, err)
+	}
+	if th.States[0].Data[0] != X86_THREAD_STATE64 {
+		t.Error("generic x86 state header was overwritten")
+	}
+}
+
+func TestMalformedThread(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/gcc-amd64-darwin-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	off := fileHeaderSize64
+	idx := -1
+	for i, l := range f.Loads {
+		if _, ok := l.(*ThreadCommand); ok {
+			idx = i
+			break
+		}
+		off += len(l.Raw())
+	}
+	if idx < 0 {
+		t.Fatal("no thread command")
+	}
+
+	// the thread state claims more words than the command holds
+	f.ByteOrder.PutUint32(data[off+12:], 0xffffffff)
+	g, err := NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("malformed thread command: %v", err)
+	}
+	if _, ok := g.Loads[idx].(LoadBytes); !ok {
+		t.Errorf("malformed thread command was decoded as %T, want its raw bytes", g.Loads[idx])
+	}
+	if g.Thread() != nil || g.EntryPoint != 0 {
+		t.Errorf("malformed thread command gives entry point 0x%x", g.EntryPoint)
+	}
+}
@@ -0,0 +1,98 @@
+package macho
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestBytesRoundTrip(t *testing.T) {
+	for _, tt := range fileTests {
+		f, err := Open(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := f.Bytes()
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+			continue
+		}
+		want, err := ioutil.ReadFile(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("%s: unmodified file was not written back as it was read", tt.file)
+		}
+		f.Close()
+	}
+}
+
+func TestBytesRelayout(t *testing.T) {
+	f, err := Open("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	symoff := f.Symtab.Symoff
+	filesz := f.Segment("__LINKEDIT").Filesz
+
+	// grow the function starts, which precede the symbol table
+	f.FuncStarts.RawDat = append(f.FuncStarts.RawDat, make([]byte, 16)...)
+	data, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Symtab.Symoff != symoff+16 {
+		t.Errorf("symbol table is at 0x%x, want 0x%x", g.Symtab.Symoff, symoff+16)
+	}
+	if !reflect.DeepEqual(g.Symtab.Syms, f.Symtab.Syms) {
+		t.Errorf("symbols differ after the symbol table moved")
+	}
+	if !reflect.DeepEqual(g.FuncStarts.RawDat, f.FuncStarts.RawDat) {
+		t.Errorf("function starts differ after resizing")
+	}
+	if have := g.Segment("__LINKEDIT").Filesz; have != filesz+16 {
+		t.Errorf("__LINKEDIT is 0x%x bytes, want 0x%x", have, filesz+16)
+	}
+	if end := g.Segment("__LINKEDIT").Offset + g.Segment("__LINKEDIT").Filesz; uint64(len(data)) != end {
+		t.Errorf("file is 0x%x bytes, __LINKEDIT ends at 0x%x", len(data), end)
+	}
+	for _, s := range f.Sections {
+		want, _ := s.Data()
+		have, _ := g.Section(s.Name).Data()
+		if !bytes.Equal(have, want) {
+			t.Errorf("section %s differs after relayout", s.Name)
+		}
+	}
+}
+
+func TestBytesUnreadableTables(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/clang-amd64-darwin-exec-with-rpath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// point the external relocations past the end of the file
+	cmd := bytes.Index(data, f.Dysymtab.LoadBytes)
+	f.ByteOrder.PutUint32(data[cmd+64:], 0xfffffff0)
+	f.ByteOrder.PutUint32(data[cmd+68:], 0xffffffff)
+	g, err := NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Dysymtab.rawExtrel != nil {
+		t.Errorf("external relocations were read from outside of the file")
+	}
+	if _, err := g.Bytes(); err == nil {
+		t.Errorf("file with unread external relocations was written")
+	}
+}
@@ -0,0 +1,259 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BoundImportDescriptor - an entry of the bound import directory, recording
+// the timestamp of a DLL the IAT was prebound against
+type BoundImportDescriptor struct {
+	TimeDateStamp uint32
+	ModuleName    string
+	ForwarderRefs []BoundForwarderRef // DLLs the module forwards some of the bound imports to
+}
+
+// BoundForwarderRef - a forwarder reference following a bound import descriptor
+type BoundForwarderRef struct {
+	TimeDateStamp uint32
+	ModuleName    string
+}
+
+// readBoundImports decodes the bound import directory. It normally lives in
+// the headers, outside of any section, so it is read straight from r; its
+// address is then both an RVA and a file offset.
+func (f *File) readBoundImports(r io.ReaderAt) ([]BoundImportDescriptor, error) {
+	dd, ok := f.dataDirectory(IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT)
+	if !ok || dd.VirtualAddress == 0 || dd.Size == 0 {
+		return nil, nil
+	}
+	d := make([]byte, dd.Size)
+	if _, err := r.ReadAt(d, int64(dd.VirtualAddress)); err != nil {
+		return nil, err
+	}
+	name := func(offset uint16) (string, error) {
+		if int(offset) >= len(d) {
+			return "", fmt.Errorf("module name offset 0x%x is outside of the directory", offset)
+		}
+		s, _ := getString(d, int(offset))
+		return s, nil
+	}
+
+	var bids []BoundImportDescriptor
+	for i := 0; ; {
+		if i+8 > len(d) {
+			return nil, errors.New("bound import directory is not terminated")
+		}
+		timeDateStamp := binary.LittleEndian.Uint32(d[i:])
+		offsetModuleName := binary.LittleEndian.Uint16(d[i+4:])
+		numberOfForwarderRefs := int(binary.LittleEndian.Uint16(d[i+6:]))
+		i += 8
+		if timeDateStamp == 0 && offsetModuleName == 0 {
+			break
+		}
+		bid := BoundImportDescriptor{TimeDateStamp: timeDateStamp}
+		var err error
+		if bid.ModuleName, err = name(offsetModuleName); err != nil {
+			return nil, err
+		}
+		if i+numberOfForwarderRefs*8 > len(d) {
+			return nil, fmt.Errorf("forwarder references of %s extend past the directory", bid.ModuleName)
+		}
+		for j := 0; j < numberOfForwarderRefs; j, i = j+1, i+8 {
+			ref := BoundForwarderRef{TimeDateStamp: binary.LittleEndian.Uint32(d[i:])}
+			if ref.ModuleName, err = name(binary.LittleEndian.Uint16(d[i+4:])); err != nil {
+				return nil, err
+			}
+			bid.ForwarderRefs = append(bid.ForwarderRefs, ref)
+		}
+		bids = append(bids, bid)
+	}
+	return bids, nil
+}
+
+// encodeBoundImports serializes bound import descriptors: the descriptors and
+// their forwarder references, a null descriptor and then the module names.
+func encodeBoundImports(bids []BoundImportDescriptor) ([]byte, error) {
+	n := 1
+	for _, bid := range bids {
+		n += 1 + len(bid.ForwarderRefs)
+	}
+	var names bytes.Buffer
+	offsets := make(map[string]uint16)
+	nameOffset := func(s string) (uint16, error) {
+		if off, ok := offsets[s]; ok {
+			return off, nil
+		}
+		off := n*8 + names.Len()
+		if off > 0xffff {
+			return 0, errors.New("bound import directory is too large")
+		}
+		offsets[s] = uint16(off)
+		names.WriteString(s)
+		names.WriteByte(0)
+		return uint16(off), nil
+	}
+
+	var buf bytes.Buffer
+	w := func(timeDateStamp uint32, name string, refs int) error {
+		off, err := nameOffset(name)
+		if err != nil {
+			return err
+		}
+		if refs > 0xffff {
+			return fmt.Errorf("%s has too many forwarder references", name)
+		}
+		binary.Write(&buf, binary.LittleEndian, timeDateStamp)
+		binary.Write(&buf, binary.LittleEndian, off)
+		binary.Write(&buf, binary.LittleEndian, uint16(refs))
+		return nil
+	}
+	for _, bid := range bids {
+		if err := w(bid.TimeDateStamp, bid.ModuleName, len(bid.ForwarderRefs)); err != nil {
+			return nil, err
+		}
+		for _, ref := range bid.ForwarderRefs {
+			// forwarder references have a reserved field where descriptors keep their count
+			if err := w(ref.TimeDateStamp, ref.ModuleName, 0); err != nil {
+				return nil, err
+			}
+		}
+	}
+	buf.Write(make([]byte, 8))
+	buf.Write(names.Bytes())
+	return buf.Bytes(), nil
+}
+
+// StripBoundImports removes the bound import directory and unbinds the
+// imports, so that the loader resolves them again: the IAT is reset to the
+// import lookup table and the binding timestamps are cleared.
+//
+// A bound descriptor without an import lookup table (OriginalFirstThunk of
+// zero) cannot be unbound: binding overwrote the IAT, its only copy of the
+// hint/name and ordinal entries, with addresses. StripBoundImports returns
+// an error for such a descriptor instead of guessing the imports.
+func (f *File) StripBoundImports() error {
+	ida, _, _, err := f.ImportDirectoryTable()
+	if err != nil {
+		return err
+	}
+	idd, _ := f.dataDirectory(IMAGE_DIRECTORY_ENTRY_IMPORT)
+
+	// ImportDirectoryTable stops at the first descriptor without an import
+	// lookup table, so check that the one it stopped at is not a bound one
+	if s := f.sectionByRVA(idd.VirtualAddress); s != nil {
+		d, err := s.Data()
+		if err != nil {
+			return err
+		}
+		off := uint64(idd.VirtualAddress-s.VirtualAddress) + uint64(len(ida))*20
+		if off+20 <= uint64(len(d)) {
+			nameRVA := binary.LittleEndian.Uint32(d[off+12:])
+			if nameRVA != 0 && binary.LittleEndian.Uint32(d[off+4:]) != 0 {
+				name, _ := getString(d, int(nameRVA-s.VirtualAddress))
+				return fmt.Errorf("cannot unbind %s: it has no import lookup table to restore the IAT from", name)
+			}
+		}
+	}
+
+	// patch copies of the sections, so that nothing changes unless every
+	// descriptor can be unbound
+	data := make(map[*Section][]byte)
+	for i, dt := range ida {
+		if dt.TimeDateStamp == 0 {
+			continue
+		}
+		thunks, err := f.thunkArray(dt.OriginalFirstThunk)
+		if err != nil {
+			return fmt.Errorf("fail to read import lookup table of %s: %v", dt.DllName, err)
+		}
+		if err := f.stageRVA(data, dt.FirstThunk, thunks); err != nil {
+			return fmt.Errorf("fail to reset IAT of %s: %v", dt.DllName, err)
+		}
+		// clear TimeDateStamp and ForwarderChain of the descriptor
+		if err := f.stageRVA(data, idd.VirtualAddress+uint32(i)*20+4, make([]byte, 8)); err != nil {
+			return fmt.Errorf("fail to unbind %s: %v", dt.DllName, err)
+		}
+	}
+	for s, d := range data {
+		s.Replace(bytes.NewReader(d), int64(len(d)))
+	}
+
+	f.BoundImports = nil
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		if oh.NumberOfRvaAndSizes > IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT {
+			oh.DataDirectory[IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT] = DataDirectory{}
+		}
+	case *OptionalHeader64:
+		if oh.NumberOfRvaAndSizes > IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT {
+			oh.DataDirectory[IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT] = DataDirectory{}
+		}
+	}
+	return nil
+}
+
+// thunkArray returns the thunk array at rva, including its null terminator.
+func (f *File) thunkArray(rva uint32) ([]byte, error) {
+	ptrSize := uint32(4)
+	if f.is64() {
+		ptrSize = 8
+	}
+	s := f.sectionByRVA(rva)
+	if s == nil {
+		return nil, fmt.Errorf("RVA 0x%x is not inside any section", rva)
+	}
+	d, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+	start := rva - s.VirtualAddress
+	null := make([]byte, ptrSize)
+	for end := start; uint64(end)+uint64(ptrSize) <= uint64(len(d)); end += ptrSize {
+		if bytes.Equal(d[end:end+ptrSize], null) {
+			return d[start : end+ptrSize], nil
+		}
+	}
+	return nil, fmt.Errorf("thunk array at RVA 0x%x is not terminated", rva)
+}
+
+// ValidateIAT checks that the IAT directory covers the FirstThunk array of
+// every import descriptor returned by ImportDirectoryTable.
+func (f *File) ValidateIAT() error {
+	ida, _, _, err := f.ImportDirectoryTable()
+	if err != nil {
+		return err
+	}
+	if len(ida) == 0 {
+		return nil
+	}
+	iat := f.IAT()
+	if iat == nil || iat.VirtualAddress == 0 {
+		return errors.New("image has imports but no IAT directory")
+	}
+	ptrSize := uint32(4)
+	if f.is64() {
+		ptrSize = 8
+	}
+	for _, dt := range ida {
+		// the IAT may still be bound, so count the entries of the lookup table
+		lookup := dt.OriginalFirstThunk
+		if lookup == 0 {
+			lookup = dt.FirstThunk
+		}
+		thunks, err := f.thunkArray(lookup)
+		if err != nil {
+			return fmt.Errorf("fail to read import lookup table of %s: %v", dt.DllName, err)
+		}
+		start := uint64(dt.FirstThunk)
+		end := start + uint64(len(thunks)) - uint64(ptrSize) // the terminator need not be covered
+		if start < uint64(iat.VirtualAddress) || end > uint64(iat.VirtualAddress)+uint64(iat.Size) {
+			return fmt.Errorf("IAT of %s at RVA 0x%x-0x%x is outside of the IAT directory 0x%x-0x%x",
+				dt.DllName, start, end, iat.VirtualAddress, uint64(iat.VirtualAddress)+uint64(iat.Size))
+		}
+	}
+	return nil
+}
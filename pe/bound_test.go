@@ -0,0 +1,171 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestBoundImports(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.ValidateIAT(); err != nil {
+		t.Fatal(err)
+	}
+
+	// place a bound import directory in the padding after the section headers
+	oh := f.OptionalHeader.(*OptionalHeader64)
+	headersEnd := f.OptionalHeaderOffset + int64(f.FileHeader.SizeOfOptionalHeader) + int64(len(f.Sections)*40)
+	oh.DataDirectory[IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT].VirtualAddress = uint32(headersEnd+7) &^ 7
+	f.BoundImports = []BoundImportDescriptor{
+		{TimeDateStamp: 0x4a5bc60f, ModuleName: "KERNEL32.dll", ForwarderRefs: []BoundForwarderRef{
+			{TimeDateStamp: 0x4a5bc60e, ModuleName: "NTDLL.DLL"},
+		}},
+		{TimeDateStamp: 0x4a5bc60f, ModuleName: "msvcrt.dll"},
+	}
+
+	// bind the imports of the first DLL
+	ida, _, _, err := f.ImportDirectoryTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idd, _ := f.dataDirectory(IMAGE_DIRECTORY_ENTRY_IMPORT)
+	if err := f.patchRVA(idd.VirtualAddress+4, []byte{0xff, 0xff, 0xff, 0xff}); err != nil {
+		t.Fatal(err)
+	}
+	bound := make([]byte, 8)
+	binary.LittleEndian.PutUint64(bound, 0x7ff812345678)
+	if err := f.patchRVA(ida[0].FirstThunk, bound); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(g.BoundImports, f.BoundImports) {
+		t.Fatalf("bound imports are %+v, want %+v", g.BoundImports, f.BoundImports)
+	}
+
+	if err := g.StripBoundImports(); err != nil {
+		t.Fatal(err)
+	}
+	if dd, _ := g.dataDirectory(IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT); dd != (DataDirectory{}) || g.BoundImports != nil {
+		t.Errorf("bound import directory was not cleared")
+	}
+	ida, _, _, err = g.ImportDirectoryTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ida[0].TimeDateStamp != 0 {
+		t.Errorf("import descriptor of %s is still bound", ida[0].DllName)
+	}
+	lookup, _ := g.thunkArray(ida[0].OriginalFirstThunk)
+	iat, _ := g.thunkArray(ida[0].FirstThunk)
+	if !bytes.Equal(iat, lookup) {
+		t.Errorf("IAT of %s was not reset to the import lookup table", ida[0].DllName)
+	}
+	if err := g.ValidateIAT(); err != nil {
+		t.Error(err)
+	}
+
+	// an IAT directory that misses a thunk array is reported
+	g.OptionalHeader.(*OptionalHeader64).DataDirectory[IMAGE_DIRECTORY_ENTRY_IAT].Size = 8
+	if err := g.ValidateIAT(); err == nil {
+		t.Error("ValidateIAT accepted a truncated IAT directory")
+	}
+}
+
+func TestBoundImportsMalformed(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// an unterminated bound import directory is recorded, not fatal
+	oh := f.OptionalHeader.(*OptionalHeader64)
+	headersEnd := f.OptionalHeaderOffset + int64(f.FileHeader.SizeOfOptionalHeader) + int64(len(f.Sections)*40)
+	oh.DataDirectory[IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT].VirtualAddress = uint32(headersEnd+7) &^ 7
+	f.BoundImports = []BoundImportDescriptor{{TimeDateStamp: 0x4a5bc60f, ModuleName: "KERNEL32.dll"}}
+	data, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := f.DosHeader.AddressOfNewExeHeader + 4 + 20 + 112 + IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT*8
+	binary.LittleEndian.PutUint32(data[dir+4:], 8)
+	g, err := NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewFile failed on a malformed bound import directory: %v", err)
+	}
+	if g.BoundImportsErr == nil || g.BoundImports != nil {
+		t.Errorf("bound imports are %+v with error %v, want an error", g.BoundImports, g.BoundImportsErr)
+	}
+
+	// a bound descriptor without an import lookup table cannot be unbound
+	idd, _ := g.dataDirectory(IMAGE_DIRECTORY_ENTRY_IMPORT)
+	if err := g.patchRVA(idd.VirtualAddress, make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.patchRVA(idd.VirtualAddress+4, []byte{0xff, 0xff, 0xff, 0xff}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.StripBoundImports(); err == nil {
+		t.Error("StripBoundImports unbound a descriptor without an import lookup table")
+	}
+}
+
+func TestStripBoundImportsFailure(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// bind the first DLL, and the second to an IAT outside of the image
+	ida, _, _, err := f.ImportDirectoryTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ida) < 2 {
+		t.Fatalf("%d import descriptors, want at least 2", len(ida))
+	}
+	idd, _ := f.dataDirectory(IMAGE_DIRECTORY_ENTRY_IMPORT)
+	bound := make([]byte, 8)
+	binary.LittleEndian.PutUint64(bound, 0x7ff812345678)
+	for _, p := range []struct {
+		rva uint32
+		b   []byte
+	}{
+		{idd.VirtualAddress + 4, []byte{0xff, 0xff, 0xff, 0xff}},
+		{ida[0].FirstThunk, bound},
+		{idd.VirtualAddress + 20 + 4, []byte{0xff, 0xff, 0xff, 0xff}},
+		{idd.VirtualAddress + 20 + 16, []byte{0xf0, 0xff, 0xff, 0x7f}},
+	} {
+		if err := f.patchRVA(p.rva, p.b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := f.StripBoundImports(); err == nil {
+		t.Fatal("StripBoundImports reset an IAT outside of the image")
+	}
+	ida, _, _, err = f.ImportDirectoryTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ida[0].TimeDateStamp == 0 {
+		t.Errorf("import descriptor of %s was unbound by a failed StripBoundImports", ida[0].DllName)
+	}
+	if iat, _ := f.thunkArray(ida[0].FirstThunk); !bytes.HasPrefix(iat, bound) {
+		t.Errorf("IAT of %s was reset by a failed StripBoundImports", ida[0].DllName)
+	}
+}
@@ -1,7 +1,6 @@
 package pe
 
 import (
-	"errors"
 	"fmt"
 	"io"
 )
@@ -15,18 +14,12 @@ func readCertTable(f *File, r io.ReadSeeker) ([]byte, error) {
 		return nil, nil
 	}
 
-	var certTableOffset, certTableSize uint32
-
-	switch f.FileHeader.Machine {
-	case IMAGE_FILE_MACHINE_I386:
-		certTableOffset = f.OptionalHeader.(*OptionalHeader32).DataDirectory[CERTIFICATE_TABLE].VirtualAddress
-		certTableSize = f.OptionalHeader.(*OptionalHeader32).DataDirectory[CERTIFICATE_TABLE].Size
-	case IMAGE_FILE_MACHINE_AMD64:
-		certTableOffset = f.OptionalHeader.(*OptionalHeader64).DataDirectory[CERTIFICATE_TABLE].VirtualAddress
-		certTableSize = f.OptionalHeader.(*OptionalHeader64).DataDirectory[CERTIFICATE_TABLE].Size
-	default:
-		return nil, errors.New("architecture not supported")
+	dd, ok := f.dataDirectory(CERTIFICATE_TABLE)
+	if !ok {
+		return nil, nil
 	}
+	// unlike other data directories, the certificate table is located by file offset
+	certTableOffset, certTableSize := dd.VirtualAddress, dd.Size
 
 	// check if certificate table exists
 	if certTableOffset == 0 || certTableSize == 0 {
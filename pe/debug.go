@@ -0,0 +1,333 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// IMAGE_DEBUG_TYPE constants (Type field of a debug directory entry)
+const (
+	IMAGE_DEBUG_TYPE_UNKNOWN               = 0
+	IMAGE_DEBUG_TYPE_COFF                  = 1
+	IMAGE_DEBUG_TYPE_CODEVIEW              = 2
+	IMAGE_DEBUG_TYPE_FPO                   = 3
+	IMAGE_DEBUG_TYPE_MISC                  = 4
+	IMAGE_DEBUG_TYPE_EXCEPTION             = 5
+	IMAGE_DEBUG_TYPE_FIXUP                 = 6
+	IMAGE_DEBUG_TYPE_OMAP_TO_SRC           = 7
+	IMAGE_DEBUG_TYPE_OMAP_FROM_SRC         = 8
+	IMAGE_DEBUG_TYPE_BORLAND               = 9
+	IMAGE_DEBUG_TYPE_RESERVED10            = 10
+	IMAGE_DEBUG_TYPE_CLSID                 = 11
+	IMAGE_DEBUG_TYPE_VC_FEATURE            = 12
+	IMAGE_DEBUG_TYPE_POGO                  = 13
+	IMAGE_DEBUG_TYPE_ILTCG                 = 14
+	IMAGE_DEBUG_TYPE_MPX                   = 15
+	IMAGE_DEBUG_TYPE_REPRO                 = 16
+	IMAGE_DEBUG_TYPE_EX_DLLCHARACTERISTICS = 20
+)
+
+// CodeView signatures
+const (
+	CODEVIEW_SIGNATURE_RSDS = 0x53445352 // "RSDS", PDB 7.0
+	CODEVIEW_SIGNATURE_NB10 = 0x3031424e // "NB10", PDB 2.0
+)
+
+const sizeofDebugDirectory = 28
+
+// DebugDirectoryEntry - a single IMAGE_DEBUG_DIRECTORY entry and its decoded data
+type DebugDirectoryEntry struct {
+	Characteristics  uint32 // reserved, must be zero
+	TimeDateStamp    uint32
+	MajorVersion     uint16
+	MinorVersion     uint16
+	Type             uint32
+	SizeOfData       uint32 // size of the debug data, not including the directory itself
+	AddressOfRawData uint32 // RVA of the debug data when loaded
+	PointerToRawData uint32 // file offset of the debug data
+
+	Data []byte      // raw debug data, nil if it could not be located
+	Info interface{} // *CodeViewRSDS, *CodeViewNB10, *POGOInfo, *ReproInfo, *VCFeatureInfo or nil
+	Err  error       // why Data could not be decoded into Info, if it could not
+}
+
+// GUID - a Windows GUID as laid out in memory
+type GUID struct {
+	Data1 uint32
+	Data2 uint16
+	Data3 uint16
+	Data4 [8]byte
+}
+
+// String returns the GUID in registry format, e.g. {12345678-ABCD-EF01-2345-6789ABCDEF01}
+func (g GUID) String() string {
+	return fmt.Sprintf("{%08X-%04X-%04X-%X-%X}", g.Data1, g.Data2, g.Data3, g.Data4[:2], g.Data4[2:])
+}
+
+// CodeViewRSDS - CodeView PDB 7.0 information
+type CodeViewRSDS struct {
+	Signature uint32 // CODEVIEW_SIGNATURE_RSDS
+	GUID      GUID
+	Age       uint32
+	PDBPath   string
+}
+
+// SymbolServerID returns the identifier used by symbol servers to index this PDB,
+// the GUID without separators followed by the age in hex.
+func (cv *CodeViewRSDS) SymbolServerID() string {
+	g := cv.GUID
+	return fmt.Sprintf("%08X%04X%04X%X%X", g.Data1, g.Data2, g.Data3, g.Data4[:], cv.Age)
+}
+
+// SymbolServerPath returns the relative path of the PDB on a symbol server,
+// in the form name.pdb/ID/name.pdb.
+func (cv *CodeViewRSDS) SymbolServerPath() string {
+	name := pdbBaseName(cv.PDBPath)
+	return name + "/" + cv.SymbolServerID() + "/" + name
+}
+
+// CodeViewNB10 - CodeView PDB 2.0 information
+type CodeViewNB10 struct {
+	Signature uint32 // CODEVIEW_SIGNATURE_NB10
+	Offset    uint32
+	Timestamp uint32
+	Age       uint32
+	PDBPath   string
+}
+
+// SymbolServerID returns the identifier used by symbol servers to index this PDB,
+// the timestamp followed by the age in hex.
+func (cv *CodeViewNB10) SymbolServerID() string {
+	return fmt.Sprintf("%08X%X", cv.Timestamp, cv.Age)
+}
+
+// SymbolServerPath returns the relative path of the PDB on a symbol server,
+// in the form name.pdb/ID/name.pdb.
+func (cv *CodeViewNB10) SymbolServerPath() string {
+	name := pdbBaseName(cv.PDBPath)
+	return name + "/" + cv.SymbolServerID() + "/" + name
+}
+
+// pdbBaseName strips any Windows or Unix directory from a PDB path
+func pdbBaseName(path string) string {
+	if i := strings.LastIndexAny(path, `\/`); i != -1 {
+		return path[i+1:]
+	}
+	return path
+}
+
+// POGOEntry - a single profile guided optimization record
+type POGOEntry struct {
+	RVA  uint32
+	Size uint32
+	Name string
+}
+
+// POGOInfo - profile guided optimization information emitted by the MSVC linker
+type POGOInfo struct {
+	Signature uint32 // e.g. "LTCG", "PGU"
+	Entries   []POGOEntry
+}
+
+// ReproInfo - reproducible build information. Hash is empty when the
+// linker only flagged the build as deterministic.
+type ReproInfo struct {
+	Hash []byte
+}
+
+// VCFeatureInfo - counts of objects built with various MSVC features
+type VCFeatureInfo struct {
+	PreVC11 uint32
+	CCpp    uint32
+	Gs      uint32
+	Sdl     uint32
+	GuardN  uint32
+}
+
+// DebugDirectory returns the entries of the debug data directory, with the
+// data of well known entry types decoded into Info. An entry whose data cannot
+// be decoded is kept with a nil Info and the reason in Err.
+func (f *File) DebugDirectory() ([]DebugDirectoryEntry, error) {
+	dd, ok := f.dataDirectory(IMAGE_DIRECTORY_ENTRY_DEBUG)
+	if !ok {
+		return nil, nil
+	}
+	if dd.VirtualAddress == 0 || dd.Size == 0 {
+		return nil, nil
+	}
+
+	d, err := f.rvaData(dd.VirtualAddress, dd.Size)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read debug directory: %v", err)
+	}
+
+	var entries []DebugDirectoryEntry
+	for len(d) >= sizeofDebugDirectory {
+		var e DebugDirectoryEntry
+		e.Characteristics = binary.LittleEndian.Uint32(d[0:4])
+		e.TimeDateStamp = binary.LittleEndian.Uint32(d[4:8])
+		e.MajorVersion = binary.LittleEndian.Uint16(d[8:10])
+		e.MinorVersion = binary.LittleEndian.Uint16(d[10:12])
+		e.Type = binary.LittleEndian.Uint32(d[12:16])
+		e.SizeOfData = binary.LittleEndian.Uint32(d[16:20])
+		e.AddressOfRawData = binary.LittleEndian.Uint32(d[20:24])
+		e.PointerToRawData = binary.LittleEndian.Uint32(d[24:28])
+		d = d[sizeofDebugDirectory:]
+
+		e.Data = f.debugData(&e)
+		if e.Data != nil {
+			e.Info, err = decodeDebugInfo(e.Type, e.Data)
+			if err != nil {
+				e.Info = nil
+				e.Err = fmt.Errorf("fail to decode debug directory entry of type %d: %v", e.Type, err)
+			}
+		} else if e.Type == IMAGE_DEBUG_TYPE_REPRO {
+			e.Info = &ReproInfo{}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// CodeView returns the CodeView RSDS record of the first debug directory entry
+// that has one, or nil if there is none.
+func (f *File) CodeView() (*CodeViewRSDS, error) {
+	entries, err := f.DebugDirectory()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if cv, ok := e.Info.(*CodeViewRSDS); ok {
+			return cv, nil
+		}
+	}
+	return nil, nil
+}
+
+// debugData locates the data of a debug directory entry, preferring its RVA
+// and falling back to the file offset for data that is not mapped.
+func (f *File) debugData(e *DebugDirectoryEntry) []byte {
+	if e.SizeOfData == 0 {
+		return nil
+	}
+	if e.AddressOfRawData != 0 {
+		if b, err := f.rvaData(e.AddressOfRawData, e.SizeOfData); err == nil {
+			return b
+		}
+	}
+	for _, s := range f.Sections {
+		// compare in 64 bits, the sums can overflow for crafted entries
+		if s.Offset <= e.PointerToRawData && uint64(e.PointerToRawData)+uint64(e.SizeOfData) <= uint64(s.Offset)+uint64(s.Size) {
+			sectionData, err := s.Data()
+			if err != nil {
+				return nil
+			}
+			start := uint64(e.PointerToRawData - s.Offset)
+			if start+uint64(e.SizeOfData) > uint64(len(sectionData)) {
+				return nil
+			}
+			return sectionData[start : start+uint64(e.SizeOfData)]
+		}
+	}
+	return nil
+}
+
+func decodeDebugInfo(typ uint32, d []byte) (interface{}, error) {
+	switch typ {
+	case IMAGE_DEBUG_TYPE_CODEVIEW:
+		return decodeCodeView(d)
+	case IMAGE_DEBUG_TYPE_POGO:
+		return decodePOGO(d)
+	case IMAGE_DEBUG_TYPE_REPRO:
+		return decodeRepro(d)
+	case IMAGE_DEBUG_TYPE_VC_FEATURE:
+		return decodeVCFeature(d)
+	}
+	return nil, nil
+}
+
+func decodeCodeView(d []byte) (interface{}, error) {
+	if len(d) < 4 {
+		return nil, fmt.Errorf("codeview data too short: %d bytes", len(d))
+	}
+	switch sig := binary.LittleEndian.Uint32(d[0:4]); sig {
+	case CODEVIEW_SIGNATURE_RSDS:
+		if len(d) < 24 {
+			return nil, fmt.Errorf("RSDS data too short: %d bytes", len(d))
+		}
+		cv := &CodeViewRSDS{Signature: sig}
+		cv.GUID.Data1 = binary.LittleEndian.Uint32(d[4:8])
+		cv.GUID.Data2 = binary.LittleEndian.Uint16(d[8:10])
+		cv.GUID.Data3 = binary.LittleEndian.Uint16(d[10:12])
+		copy(cv.GUID.Data4[:], d[12:20])
+		cv.Age = binary.LittleEndian.Uint32(d[20:24])
+		cv.PDBPath = cstring(d[24:])
+		return cv, nil
+	case CODEVIEW_SIGNATURE_NB10:
+		if len(d) < 16 {
+			return nil, fmt.Errorf("NB10 data too short: %d bytes", len(d))
+		}
+		return &CodeViewNB10{
+			Signature: sig,
+			Offset:    binary.LittleEndian.Uint32(d[4:8]),
+			Timestamp: binary.LittleEndian.Uint32(d[8:12]),
+			Age:       binary.LittleEndian.Uint32(d[12:16]),
+			PDBPath:   cstring(d[16:]),
+		}, nil
+	}
+	// unknown CodeView formats are left undecoded
+	return nil, nil
+}
+
+func decodePOGO(d []byte) (interface{}, error) {
+	if len(d) < 4 {
+		return nil, fmt.Errorf("POGO data too short: %d bytes", len(d))
+	}
+	p := &POGOInfo{Signature: binary.LittleEndian.Uint32(d[0:4])}
+	d = d[4:]
+	for len(d) >= 8 {
+		var e POGOEntry
+		e.RVA = binary.LittleEndian.Uint32(d[0:4])
+		e.Size = binary.LittleEndian.Uint32(d[4:8])
+		d = d[8:]
+		end := bytes.IndexByte(d, 0)
+		if end == -1 {
+			return nil, fmt.Errorf("unterminated POGO entry name")
+		}
+		e.Name = string(d[:end])
+		// names are null terminated and padded to a 4 byte boundary
+		next := (end + 4) &^ 3
+		if next > len(d) {
+			next = len(d)
+		}
+		d = d[next:]
+		p.Entries = append(p.Entries, e)
+	}
+	return p, nil
+}
+
+func decodeRepro(d []byte) (interface{}, error) {
+	if len(d) < 4 {
+		return &ReproInfo{}, nil
+	}
+	l := binary.LittleEndian.Uint32(d[0:4])
+	if uint64(l) > uint64(len(d)-4) {
+		return nil, fmt.Errorf("REPRO hash length %d exceeds data size %d", l, len(d)-4)
+	}
+	return &ReproInfo{Hash: d[4 : 4+l]}, nil
+}
+
+func decodeVCFeature(d []byte) (interface{}, error) {
+	if len(d) < 20 {
+		return nil, fmt.Errorf("VC_FEATURE data too short: %d bytes", len(d))
+	}
+	return &VCFeatureInfo{
+		PreVC11: binary.LittleEndian.Uint32(d[0:4]),
+		CCpp:    binary.LittleEndian.Uint32(d[4:8]),
+		Gs:      binary.LittleEndian.Uint32(d[8:12]),
+		Sdl:     binary.LittleEndian.Uint32(d[12:16]),
+		GuardN:  binary.LittleEndian.Uint32(d[16:20]),
+	}, nil
+}
@@ -0,0 +1,178 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestDebugDirectoryCodeView(t *testing.T) {
+	const (
+		sectionRVA = 0x2000
+		cvOffset   = sizeofDebugDirectory * 2
+	)
+	var data bytes.Buffer
+	pdb := `C:\build\out\hello.pdb`
+	cvSize := uint32(24 + len(pdb) + 1)
+	entries := []struct {
+		typ, size, rva uint32
+	}{
+		{IMAGE_DEBUG_TYPE_CODEVIEW, cvSize, sectionRVA + cvOffset},
+		{IMAGE_DEBUG_TYPE_REPRO, 0, 0},
+	}
+	for _, e := range entries {
+		binary.Write(&data, binary.LittleEndian, [3]uint32{0, 0, 0})
+		binary.Write(&data, binary.LittleEndian, [4]uint32{e.typ, e.size, e.rva, 0})
+	}
+	binary.Write(&data, binary.LittleEndian, uint32(CODEVIEW_SIGNATURE_RSDS))
+	binary.Write(&data, binary.LittleEndian, GUID{0x12345678, 0x9abc, 0xdef0, [8]byte{1, 2, 3, 4, 5, 6, 7, 8}})
+	binary.Write(&data, binary.LittleEndian, uint32(3))
+	data.WriteString(pdb)
+	data.WriteByte(0)
+
+	s := &Section{SectionHeader: SectionHeader{
+		Name:           ".rdata",
+		VirtualAddress: sectionRVA,
+		VirtualSize:    uint32(data.Len()),
+		Size:           uint32(data.Len()),
+	}}
+	s.Replace(bytes.NewReader(data.Bytes()), int64(data.Len()))
+
+	var oh OptionalHeader64
+	oh.NumberOfRvaAndSizes = 16
+	oh.DataDirectory[IMAGE_DIRECTORY_ENTRY_DEBUG] = DataDirectory{sectionRVA, sizeofDebugDirectory * 2}
+	f := &File{OptionalHeader: &oh, Sections: []*Section{s}}
+
+	dd, err := f.DebugDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dd) != 2 {
+		t.Fatalf("got %d debug directory entries, want 2", len(dd))
+	}
+	if _, ok := dd[1].Info.(*ReproInfo); !ok {
+		t.Errorf("second entry has Info %T, want *ReproInfo", dd[1].Info)
+	}
+
+	cv, err := f.CodeView()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cv == nil {
+		t.Fatal("no CodeView record found")
+	}
+	if cv.PDBPath != pdb {
+		t.Errorf("PDBPath = %q, want %q", cv.PDBPath, pdb)
+	}
+	if want := "{12345678-9ABC-DEF0-0102-030405060708}"; cv.GUID.String() != want {
+		t.Errorf("GUID = %s, want %s", cv.GUID, want)
+	}
+	if want := "hello.pdb/123456789ABCDEF001020304050607083/hello.pdb"; cv.SymbolServerPath() != want {
+		t.Errorf("SymbolServerPath = %s, want %s", cv.SymbolServerPath(), want)
+	}
+}
+
+func TestDecodeDebugInfo(t *testing.T) {
+	le := func(vs ...uint32) []byte {
+		var b bytes.Buffer
+		binary.Write(&b, binary.LittleEndian, vs)
+		return b.Bytes()
+	}
+	nb10 := append(le(CODEVIEW_SIGNATURE_NB10, 0, 0x5e0f1a2b, 2), "old.pdb\x00"...)
+	pogo := append(le(0x4c544347, 0x1000, 0x20), ".text$mn\x00\x00\x00\x00"...)
+	pogo = append(append(pogo, le(0x2000, 0x8)...), ".rdata\x00\x00"...)
+
+	tests := []struct {
+		typ  uint32
+		data []byte
+		want interface{}
+	}{
+		{
+			IMAGE_DEBUG_TYPE_CODEVIEW, nb10,
+			&CodeViewNB10{Signature: CODEVIEW_SIGNATURE_NB10, Timestamp: 0x5e0f1a2b, Age: 2, PDBPath: "old.pdb"},
+		},
+		{
+			IMAGE_DEBUG_TYPE_POGO, pogo,
+			&POGOInfo{Signature: 0x4c544347, Entries: []POGOEntry{
+				{RVA: 0x1000, Size: 0x20, Name: ".text$mn"},
+				{RVA: 0x2000, Size: 0x8, Name: ".rdata"},
+			}},
+		},
+		{
+			IMAGE_DEBUG_TYPE_VC_FEATURE, le(1, 20, 18, 3, 0),
+			&VCFeatureInfo{PreVC11: 1, CCpp: 20, Gs: 18, Sdl: 3},
+		},
+	}
+	for _, tt := range tests {
+		got, err := decodeDebugInfo(tt.typ, tt.data)
+		if err != nil {
+			t.Errorf("type %d: %v", tt.typ, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("type %d: got %+v, want %+v", tt.typ, got, tt.want)
+		}
+	}
+
+	if sv := tests[0].want.(*CodeViewNB10).SymbolServerID(); sv != "5E0F1A2B2" {
+		t.Errorf("NB10 SymbolServerID = %s, want 5E0F1A2B2", sv)
+	}
+}
+
+func TestDebugDataOverflow(t *testing.T) {
+	s := &Section{SectionHeader: SectionHeader{Name: ".rdata", Offset: 0x400, Size: 0x100}}
+	s.Replace(bytes.NewReader(make([]byte, 0x100)), 0x100)
+	f := &File{Sections: []*Section{s}}
+
+	// PointerToRawData+SizeOfData wraps around to within the section
+	e := &DebugDirectoryEntry{PointerToRawData: 0x410, SizeOfData: 0xfffffff8}
+	if d := f.debugData(e); d != nil {
+		t.Errorf("got %d bytes of debug data for an entry past the end of its section", len(d))
+	}
+}
+
+func TestDebugDirectoryBadEntry(t *testing.T) {
+	const sectionRVA = 0x2000
+	var data bytes.Buffer
+	rsds := []byte("RSDS0123456789abcdef\x01\x00\x00\x00a.pdb\x00")
+	bad := []byte("RSDS0123") // truncated
+	offset := uint32(sizeofDebugDirectory * 2)
+	for _, e := range [][]byte{bad, rsds} {
+		binary.Write(&data, binary.LittleEndian, [3]uint32{0, 0, 0})
+		binary.Write(&data, binary.LittleEndian, [4]uint32{IMAGE_DEBUG_TYPE_CODEVIEW, uint32(len(e)), sectionRVA + offset, 0})
+		offset += uint32(len(e))
+	}
+	data.Write(bad)
+	data.Write(rsds)
+
+	s := &Section{SectionHeader: SectionHeader{
+		Name:           ".rdata",
+		VirtualAddress: sectionRVA,
+		VirtualSize:    uint32(data.Len()),
+		Size:           uint32(data.Len()),
+	}}
+	s.Replace(bytes.NewReader(data.Bytes()), int64(data.Len()))
+	var oh OptionalHeader64
+	oh.NumberOfRvaAndSizes = 16
+	oh.DataDirectory[IMAGE_DIRECTORY_ENTRY_DEBUG] = DataDirectory{sectionRVA, sizeofDebugDirectory * 2}
+	f := &File{OptionalHeader: &oh, Sections: []*Section{s}}
+
+	dd, err := f.DebugDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dd) != 2 {
+		t.Fatalf("got %d debug directory entries, want 2", len(dd))
+	}
+	if dd[0].Err == nil || dd[0].Info != nil {
+		t.Errorf("truncated CodeView entry has Info %+v and error %v", dd[0].Info, dd[0].Err)
+	}
+	cv, err := f.CodeView()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cv == nil || cv.PDBPath != "a.pdb" || cv.Age != 1 {
+		t.Errorf("CodeView record is %+v, want the one of the second entry", cv)
+	}
+}
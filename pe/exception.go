@@ -0,0 +1,176 @@
+package pe
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// RuntimeFunction - an entry of the exception directory (.pdata)
+type RuntimeFunction struct {
+	BeginAddress uint32
+	EndAddress   uint32 // for ARM64 entries this is derived from the function length
+	UnwindData   uint32 // RVA of the unwind information, or the packed unwind data itself when Flag is non-zero
+	Flag         uint8  // ARM64 only: 0 for an .xdata record, 1 or 2 for packed unwind data
+}
+
+// ARM64 .pdata Flag values
+const (
+	ARM64_UNWIND_XDATA           = 0 // UnwindData is the RVA of an .xdata record
+	ARM64_UNWIND_PACKED          = 1 // UnwindData holds packed unwind data for a single prolog and epilog
+	ARM64_UNWIND_PACKED_FRAGMENT = 2 // packed unwind data for a function fragment without a prolog
+)
+
+// ExceptionTable returns the entries of the exception directory. AMD64 entries
+// are 12 bytes long; ARM64 and ARMNT entries are 8 bytes long.
+func (f *File) ExceptionTable() ([]RuntimeFunction, error) {
+	dd, ok := f.dataDirectory(IMAGE_DIRECTORY_ENTRY_EXCEPTION)
+	if !ok || dd.VirtualAddress == 0 || dd.Size == 0 {
+		return nil, nil
+	}
+	d, err := f.rvaData(dd.VirtualAddress, dd.Size)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read exception directory: %v", err)
+	}
+
+	var rfs []RuntimeFunction
+	switch f.FileHeader.Machine {
+	case IMAGE_FILE_MACHINE_AMD64, IMAGE_FILE_MACHINE_ARM64EC:
+		for ; len(d) >= 12; d = d[12:] {
+			rfs = append(rfs, RuntimeFunction{
+				BeginAddress: binary.LittleEndian.Uint32(d[0:4]),
+				EndAddress:   binary.LittleEndian.Uint32(d[4:8]),
+				UnwindData:   binary.LittleEndian.Uint32(d[8:12]),
+			})
+		}
+	case IMAGE_FILE_MACHINE_ARM64, IMAGE_FILE_MACHINE_ARM64X, IMAGE_FILE_MACHINE_ARMNT:
+		for ; len(d) >= 8; d = d[8:] {
+			rf := RuntimeFunction{
+				BeginAddress: binary.LittleEndian.Uint32(d[0:4]),
+				UnwindData:   binary.LittleEndian.Uint32(d[4:8]),
+			}
+			rf.Flag = uint8(rf.UnwindData & 3)
+			if rf.Flag != ARM64_UNWIND_XDATA {
+				// packed entries carry the function length in units of 4 bytes (ARM64) or 2 bytes (ARMNT)
+				length := (rf.UnwindData >> 2) & 0x7ff
+				if f.FileHeader.Machine == IMAGE_FILE_MACHINE_ARMNT {
+					rf.EndAddress = rf.BeginAddress + length*2
+				} else {
+					rf.EndAddress = rf.BeginAddress + length*4
+				}
+			} else if f.FileHeader.Machine != IMAGE_FILE_MACHINE_ARMNT {
+				if x, err := f.rvaData(rf.UnwindData, 4); err == nil {
+					rf.EndAddress = rf.BeginAddress + (binary.LittleEndian.Uint32(x)&0x3ffff)*4
+				}
+			}
+			rfs = append(rfs, rf)
+		}
+	default:
+		return nil, fmt.Errorf("exception directory of machine 0x%x is not supported", f.FileHeader.Machine)
+	}
+	return rfs, nil
+}
+
+// ARM64PackedUnwind - the fields of packed ARM64 unwind data
+type ARM64PackedUnwind struct {
+	FunctionLength uint32 // in bytes
+	RegF           uint8  // number of non-volatile FP registers saved, minus one (d8-d15)
+	RegI           uint8  // number of non-volatile integer registers saved (x19-x28)
+	H              bool   // x0-x7 are homed at the very start of the function
+	CR             uint8  // 0: unchained, 1: unchained with lr saved, 2: chained with pac, 3: chained
+	FrameSize      uint32 // in bytes
+}
+
+// ARM64EpilogScope - describes one epilog of an ARM64 function
+type ARM64EpilogScope struct {
+	StartOffset uint32 // offset of the epilog from the start of the function, in bytes
+	StartIndex  uint16 // index of the first unwind code byte describing the epilog
+}
+
+// ARM64UnwindInfo - decoded ARM64 unwind information, either from an .xdata
+// record or from packed unwind data
+type ARM64UnwindInfo struct {
+	FunctionLength   uint32 // in bytes
+	Version          uint8
+	HasExceptionData bool // X bit
+	SingleEpilog     bool // E bit, the epilog is described by EpilogStartIndex
+	EpilogStartIndex uint16
+	EpilogScopes     []ARM64EpilogScope
+	UnwindCodes      []byte
+
+	ExceptionHandler uint32 // RVA of the language specific handler, if HasExceptionData
+	ExceptionData    uint32 // RVA of the data following the handler RVA, if HasExceptionData
+
+	Packed *ARM64PackedUnwind // set instead of the fields above for packed unwind data
+}
+
+// ARM64UnwindInfo decodes the unwind information of an ARM64 runtime function
+// returned by ExceptionTable.
+func (f *File) ARM64UnwindInfo(rf RuntimeFunction) (*ARM64UnwindInfo, error) {
+	if rf.Flag != ARM64_UNWIND_XDATA {
+		p := &ARM64PackedUnwind{
+			FunctionLength: ((rf.UnwindData >> 2) & 0x7ff) * 4,
+			RegF:           uint8((rf.UnwindData >> 13) & 0x7),
+			RegI:           uint8((rf.UnwindData >> 16) & 0xf),
+			H:              (rf.UnwindData>>20)&1 != 0,
+			CR:             uint8((rf.UnwindData >> 21) & 0x3),
+			FrameSize:      ((rf.UnwindData >> 23) & 0x1ff) * 16,
+		}
+		return &ARM64UnwindInfo{FunctionLength: p.FunctionLength, Packed: p}, nil
+	}
+
+	// read the header words first to learn the size of the record
+	hdr, err := f.rvaData(rf.UnwindData, 4)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read unwind data: %v", err)
+	}
+	h := binary.LittleEndian.Uint32(hdr)
+	u := &ARM64UnwindInfo{
+		FunctionLength:   (h & 0x3ffff) * 4,
+		Version:          uint8((h >> 18) & 0x3),
+		HasExceptionData: (h>>20)&1 != 0,
+		SingleEpilog:     (h>>21)&1 != 0,
+	}
+	epilogCount := (h >> 22) & 0x1f
+	codeWords := (h >> 27) & 0x1f
+	hdrSize := uint32(4)
+	if epilogCount == 0 && codeWords == 0 {
+		ext, err := f.rvaData(rf.UnwindData+4, 4)
+		if err != nil {
+			return nil, fmt.Errorf("fail to read extended unwind header: %v", err)
+		}
+		e := binary.LittleEndian.Uint32(ext)
+		epilogCount = e & 0xffff
+		codeWords = (e >> 16) & 0xff
+		hdrSize += 4
+	}
+	if u.SingleEpilog {
+		// the epilog count field holds the index of the single epilog's unwind codes instead
+		u.EpilogStartIndex = uint16(epilogCount)
+		epilogCount = 0
+	}
+	size := hdrSize + epilogCount*4 + codeWords*4
+	if u.HasExceptionData {
+		size += 4
+	}
+
+	d, err := f.rvaData(rf.UnwindData, size)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read unwind data: %v", err)
+	}
+	d = d[hdrSize:]
+	for i := uint32(0); i < epilogCount; i++ {
+		s := binary.LittleEndian.Uint32(d[i*4:])
+		u.EpilogScopes = append(u.EpilogScopes, ARM64EpilogScope{
+			StartOffset: (s & 0x3ffff) * 4,
+			StartIndex:  uint16(s >> 22),
+		})
+	}
+	d = d[epilogCount*4:]
+	u.UnwindCodes = d[:codeWords*4]
+	d = d[codeWords*4:]
+	if u.HasExceptionData {
+		u.ExceptionHandler = binary.LittleEndian.Uint32(d)
+		u.ExceptionData = rf.UnwindData + size
+	}
+	return u, nil
+}
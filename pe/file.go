@@ -7,13 +7,12 @@ package pe
 
 import (
 	"bytes"
-	"compress/zlib"
-	"debug/dwarf"
 	"encoding/binary"
 	"fmt"
 	"io"
 	"os"
-	"strings"
+
+	"github.com/lesnuages/debug/dwarf"
 )
 
 // Avoid use of post-Go 1.4 io features, to make safe for toolchain bootstrap.
@@ -26,16 +25,24 @@ const (
 type File struct {
 	DosHeader
 	DosExists  bool
-	DosStub    [64]byte // TODO(capnspacehook) make slice and correctly parse any DOS stub
-	RichHeader []byte
+	DosStub    []byte      // bytes between the DOS header and the Rich or PE header
+	RichHeader []byte      // raw bytes following the DOS stub, up to and including the "Rich" marker and key
+	Rich       *RichHeader // decoded Rich header, re-encoded by Bytes when set
 	FileHeader
 	OptionalHeader      interface{} // of type *OptionalHeader32 or *OptionalHeader64
 	Sections            []*Section
 	BaseRelocationTable *[]RelocationTableEntry
-	Symbols             []*Symbol    // COFF symbols with auxiliary symbol records removed
-	COFFSymbols         []COFFSymbol // all COFF symbols (including auxiliary symbol records)
+	BoundImports        []BoundImportDescriptor // re-encoded into the headers by Bytes
+	BoundImportsErr     error                   // why the bound import directory could not be decoded, if it could not
+	Symbols             []*Symbol               // COFF symbols with auxiliary symbol records removed
+	COFFSymbols         []COFFSymbol            // all COFF symbols (including auxiliary symbol records)
 	StringTable         StringTable
-	CertificateTable    []byte
+	CertificateTable    []byte // written by Bytes at the first 8-byte boundary after the image
+	Overlay             []byte // data appended after the image, excluding the certificate table
+
+	// OverlayAfterCertificate is the number of trailing Overlay bytes that are
+	// stored after the certificate table rather than before it.
+	OverlayAfterCertificate int
 
 	OptionalHeaderOffset int64 // offset of the start of the Optional Header
 	InsertionAddr        uint32
@@ -43,7 +50,10 @@ type File struct {
 
 	Net Net //If a managed executable, Net provides an interface to some of the metadata
 
-	closer io.Closer
+	r                 io.ReaderAt // the reader the file was decoded from
+	optionalHeaderEnd []byte      // optional header bytes past the end of OptionalHeader
+	certOverlapsImage bool        // the certificate table starts before the end of the image
+	closer            io.Closer
 }
 
 // Open opens the named file using os.Open and prepares it for use as a PE binary.
@@ -73,11 +83,6 @@ func (f *File) Close() error {
 	return err
 }
 
-var (
-	sizeofOptionalHeader32 = uint16(binary.Size(OptionalHeader32{}))
-	sizeofOptionalHeader64 = uint16(binary.Size(OptionalHeader64{}))
-)
-
 // TODO(brainman): add Load function, as a replacement for NewFile, that does not call removeAuxSymbols (for performance)
 
 // NewFile creates a new pe.File for accessing a PE binary file in an underlying reader.
@@ -93,29 +98,30 @@ func NewFileFromMemory(r io.ReaderAt) (*File, error) {
 // NewFile creates a new File for accessing a PE binary in an underlying reader.
 func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 
-	f := new(File)
+	f := &File{r: r}
 	sr := io.NewSectionReader(r, 0, 1<<63-1)
 
 	binary.Read(sr, binary.LittleEndian, &f.DosHeader)
 	dosHeaderSize := binary.Size(f.DosHeader)
-	if dosHeaderSize > int(f.DosHeader.AddressOfNewExeHeader) {
-		binary.Read(sr, binary.LittleEndian, &f.DosStub)
-		f.DosExists = true
-	} else {
-		f.DosExists = false
-	}
 
-	possibleRichHeaderStart := dosHeaderSize
-	if f.DosExists {
-		possibleRichHeaderStart += binary.Size(f.DosStub)
-	}
-	possibleRichHeaderEnd := int(f.DosHeader.AddressOfNewExeHeader)
-	if possibleRichHeaderEnd > possibleRichHeaderStart {
-		richHeader := make([]byte, possibleRichHeaderEnd-possibleRichHeaderStart)
-		binary.Read(sr, binary.LittleEndian, richHeader)
+	// everything between the DOS header and the PE header is DOS stub, apart from the Rich header
+	if f.DosHeader.MZSignature == 0x5a4d && int(f.DosHeader.AddressOfNewExeHeader) > dosHeaderSize {
+		stub := make([]byte, int(f.DosHeader.AddressOfNewExeHeader)-dosHeaderSize)
+		if _, err := io.ReadFull(sr, stub); err != nil {
+			return nil, fmt.Errorf("fail to read DOS stub: %v", err)
+		}
+		f.DosStub = stub
+		f.DosExists = true
 
-		if richIndex := bytes.Index(richHeader, []byte("Rich")); richIndex != -1 {
-			f.RichHeader = richHeader[:richIndex+8]
+		if richIndex := bytes.Index(stub, []byte("Rich")); richIndex != -1 && richIndex+8 <= len(stub) {
+			// a Rich header that can't be decoded is left in the stub
+			if rh, err := decodeRichHeader(stub[:richIndex+8]); err == nil {
+				// the bytes before the DanS marker stay in the stub
+				f.DosStub = stub[:rh.start]
+				f.RichHeader = stub[rh.start : richIndex+8]
+				rh.start = 0
+				f.Rich = rh
+			}
 		}
 	}
 
@@ -137,7 +143,8 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 		return nil, err
 	}
 	switch f.FileHeader.Machine {
-	case IMAGE_FILE_MACHINE_UNKNOWN, IMAGE_FILE_MACHINE_ARMNT, IMAGE_FILE_MACHINE_AMD64, IMAGE_FILE_MACHINE_I386:
+	case IMAGE_FILE_MACHINE_UNKNOWN, IMAGE_FILE_MACHINE_ARMNT, IMAGE_FILE_MACHINE_AMD64, IMAGE_FILE_MACHINE_I386,
+		IMAGE_FILE_MACHINE_ARM64, IMAGE_FILE_MACHINE_ARM64EC, IMAGE_FILE_MACHINE_ARM64X:
 	default:
 		return nil, fmt.Errorf("Unrecognised COFF file header machine value of 0x%x", f.FileHeader.Machine)
 	}
@@ -188,26 +195,39 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 	f.OptionalHeaderOffset = peHeaderOffset + int64(binary.Size(f.FileHeader))
 	sr.Seek(f.OptionalHeaderOffset, seekStart)
 
-	var oh32 OptionalHeader32
-	var oh64 OptionalHeader64
-	switch f.FileHeader.SizeOfOptionalHeader {
-	case sizeofOptionalHeader32:
-		if err := binary.Read(sr, binary.LittleEndian, &oh32); err != nil {
-			return nil, err
-		}
-		if oh32.Magic != 0x10b { // PE32
-			return nil, fmt.Errorf("pe32 optional header has unexpected Magic of 0x%x", oh32.Magic)
-		}
-		f.OptionalHeader = &oh32
-	case sizeofOptionalHeader64:
-		if err := binary.Read(sr, binary.LittleEndian, &oh64); err != nil {
-			return nil, err
-		}
-		if oh64.Magic != 0x20b { // PE32+
-			return nil, fmt.Errorf("pe32+ optional header has unexpected Magic of 0x%x", oh64.Magic)
+	// The optional header type is picked by its Magic, not by the machine. Headers
+	// shorter than ours leave the trailing data directories zeroed.
+	if f.FileHeader.SizeOfOptionalHeader >= 2 {
+		ohData := make([]byte, f.FileHeader.SizeOfOptionalHeader)
+		if _, err := io.ReadFull(sr, ohData); err != nil {
+			return nil, fmt.Errorf("fail to read optional header: %v", err)
+		}
+		switch magic := binary.LittleEndian.Uint16(ohData); magic {
+		case 0x10b: // PE32
+			var oh32 OptionalHeader32
+			if n := binary.Size(oh32); len(ohData) > n {
+				f.optionalHeaderEnd = ohData[n:]
+			}
+			ohData = append(ohData, make([]byte, binary.Size(oh32))...)
+			if err := binary.Read(bytes.NewReader(ohData), binary.LittleEndian, &oh32); err != nil {
+				return nil, err
+			}
+			f.OptionalHeader = &oh32
+		case 0x20b: // PE32+
+			var oh64 OptionalHeader64
+			if n := binary.Size(oh64); len(ohData) > n {
+				f.optionalHeaderEnd = ohData[n:]
+			}
+			ohData = append(ohData, make([]byte, binary.Size(oh64))...)
+			if err := binary.Read(bytes.NewReader(ohData), binary.LittleEndian, &oh64); err != nil {
+				return nil, err
+			}
+			f.OptionalHeader = &oh64
+		default:
+			return nil, fmt.Errorf("optional header has unexpected Magic of 0x%x", magic)
 		}
-		f.OptionalHeader = &oh64
 	}
+	sr.Seek(f.OptionalHeaderOffset+int64(f.FileHeader.SizeOfOptionalHeader), seekStart)
 
 	// Process sections.
 	f.Sections = make([]*Section, f.FileHeader.NumberOfSections)
@@ -260,49 +280,30 @@ func newFileInternal(r io.ReaderAt, memoryMode bool) (*File, error) {
 		return nil, err
 	}
 
+	// a malformed bound import directory only costs the loader a rebind,
+	// so it is recorded rather than making the file unreadable
+	f.BoundImports, err = f.readBoundImports(r)
+	if err != nil {
+		f.BoundImportsErr = fmt.Errorf("fail to read bound import directory: %v", err)
+	}
+
 	// Read certificate table (only in disk mode)
 	if !memoryMode {
 		f.CertificateTable, err = readCertTable(f, sr)
 		if err != nil {
 			return nil, err
 		}
+		f.Overlay, f.OverlayAfterCertificate, err = readOverlay(f, sr)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	//fill net info
 	if f.IsManaged() {
-		var va, size uint32
-
-		//determine location of the COM descriptor directory
-		switch v := f.OptionalHeader.(type) {
-		case *OptionalHeader32:
-			va = v.DataDirectory[IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR].VirtualAddress
-			size = v.DataDirectory[IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR].Size
-		case *OptionalHeader64:
-			va = v.DataDirectory[IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR].VirtualAddress
-			size = v.DataDirectory[IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR].Size
+		if err := f.readNet(r, memoryMode); err != nil {
+			f.Net.Err = fmt.Errorf("fail to read .NET metadata: %v", err)
 		}
-
-		//I'm unsure how to get a reader (not a readerat) for a particular thing, so copying buffers around.. this could be more optimal
-		buff := make([]byte, size)
-
-		//none of these reads have errors being caught either, which is probably not ideal
-		if !memoryMode {
-			r.ReadAt(buff, int64(f.RVAToFileOffset(va)))
-		} else {
-			r.ReadAt(buff, int64(va))
-		}
-		binary.Read(bytes.NewReader(buff), binary.LittleEndian, &f.Net.NetDirectory)
-
-		//Now that we have the COR20 header (COM descriptor directory header), we can get the metadata section header, which has the version
-		buff = make([]byte, f.Net.NetDirectory.MetaDataSize)
-		//again, none of the reads are error checked :shrug:
-		if !memoryMode {
-			r.ReadAt(buff, int64(f.RVAToFileOffset(f.Net.NetDirectory.MetaDataRVA)))
-		} else {
-			r.ReadAt(buff, int64(f.Net.NetDirectory.MetaDataRVA))
-		}
-		f.Net.MetaData, _ = newMetadataHeader(bytes.NewReader(buff))
-
 	}
 
 	return f, nil
@@ -345,111 +346,131 @@ func (f *File) Section(name string) *Section {
 }
 
 func (f *File) DWARF() (*dwarf.Data, error) {
-	dwarfSuffix := func(s *Section) string {
-		switch {
-		case strings.HasPrefix(s.Name, ".debug_"):
-			return s.Name[7:]
-		case strings.HasPrefix(s.Name, ".zdebug_"):
-			return s.Name[8:]
-		default:
-			return ""
-		}
-
+	sections := make([]dwarf.Section, len(f.Sections))
+	for i, s := range f.Sections {
+		s := s
+		sections[i] = dwarf.Section{Name: s.Name, Data: func() ([]byte, error) {
+			b, err := s.Data()
+			if err != nil && uint32(len(b)) < s.Size {
+				return nil, err
+			}
+			if 0 < s.VirtualSize && s.VirtualSize < s.Size {
+				b = b[:s.VirtualSize]
+			}
+			return b, nil
+		}}
 	}
+	return dwarf.Load(sections)
+}
 
-	// sectionData gets the data for s and checks its size.
-	sectionData := func(s *Section) ([]byte, error) {
-		b, err := s.Data()
-		if err != nil && uint32(len(b)) < s.Size {
-			return nil, err
-		}
+// FormatError is unused.
+// The type is retained for compatibility.
+type FormatError struct {
+}
 
-		if 0 < s.VirtualSize && s.VirtualSize < s.Size {
-			b = b[:s.VirtualSize]
-		}
+func (e *FormatError) Error() string {
+	return "unknown error"
+}
 
-		if len(b) >= 12 && string(b[:4]) == "ZLIB" {
-			dlen := binary.BigEndian.Uint64(b[4:12])
-			dbuf := make([]byte, dlen)
-			r, err := zlib.NewReader(bytes.NewBuffer(b[12:]))
-			if err != nil {
-				return nil, err
-			}
-			if _, err := io.ReadFull(r, dbuf); err != nil {
-				return nil, err
-			}
-			if err := r.Close(); err != nil {
-				return nil, err
-			}
-			b = dbuf
+//RVAToFileOffset Converts a Relative offset to the actual offset in the file.
+func (f *File) RVAToFileOffset(rva uint32) uint32 {
+	var offset uint32
+	for _, section := range f.Sections {
+		if rva >= section.SectionHeader.VirtualAddress && rva <= section.SectionHeader.VirtualAddress+section.SectionHeader.Size {
+			offset = section.SectionHeader.Offset + (rva - section.SectionHeader.VirtualAddress)
 		}
-		return b, nil
 	}
+	return offset
+}
 
-	// There are many other DWARF sections, but these
-	// are the ones the debug/dwarf package uses.
-	// Don't bother loading others.
-	var dat = map[string][]byte{"abbrev": nil, "info": nil, "str": nil, "line": nil, "ranges": nil}
+// sectionByRVA returns the section whose virtual range contains rva, or nil.
+func (f *File) sectionByRVA(rva uint32) *Section {
 	for _, s := range f.Sections {
-		suffix := dwarfSuffix(s)
-		if suffix == "" {
-			continue
+		size := s.VirtualSize
+		if size == 0 {
+			size = s.Size
 		}
-		if _, ok := dat[suffix]; !ok {
-			continue
-		}
-
-		b, err := sectionData(s)
-		if err != nil {
-			return nil, err
+		if s.VirtualAddress <= rva && rva < s.VirtualAddress+size {
+			return s
 		}
-		dat[suffix] = b
 	}
+	return nil
+}
 
-	d, err := dwarf.New(dat["abbrev"], nil, nil, dat["info"], dat["line"], nil, dat["ranges"], dat["str"])
+// rvaData returns size bytes of section data starting at rva.
+func (f *File) rvaData(rva, size uint32) ([]byte, error) {
+	s := f.sectionByRVA(rva)
+	if s == nil {
+		return nil, fmt.Errorf("RVA 0x%x is not inside any section", rva)
+	}
+	d, err := s.Data()
 	if err != nil {
 		return nil, err
 	}
+	start := rva - s.VirtualAddress
+	if uint64(start)+uint64(size) > uint64(len(d)) {
+		return nil, fmt.Errorf("RVA range 0x%x+0x%x extends past the end of section %s", rva, size, s.Name)
+	}
+	return d[start : start+size], nil
+}
 
-	// Look for DWARF4 .debug_types sections.
-	for i, s := range f.Sections {
-		suffix := dwarfSuffix(s)
-		if suffix != "types" {
-			continue
-		}
-
-		b, err := sectionData(s)
-		if err != nil {
-			return nil, err
-		}
+// patchRVA overwrites the section data at rva with b.
+func (f *File) patchRVA(rva uint32, b []byte) error {
+	data := make(map[*Section][]byte)
+	if err := f.stageRVA(data, rva, b); err != nil {
+		return err
+	}
+	for s, d := range data {
+		s.Replace(bytes.NewReader(d), int64(len(d)))
+	}
+	return nil
+}
 
-		err = d.AddTypes(fmt.Sprintf("types-%d", i), b)
+// stageRVA overwrites the data at rva with b in data, which holds copies of
+// the sections patched so far. The sections themselves are left unchanged.
+func (f *File) stageRVA(data map[*Section][]byte, rva uint32, b []byte) error {
+	s := f.sectionByRVA(rva)
+	if s == nil {
+		return fmt.Errorf("RVA 0x%x is not inside any section", rva)
+	}
+	d, ok := data[s]
+	if !ok {
+		orig, err := s.Data()
 		if err != nil {
-			return nil, err
+			return err
 		}
+		d = append([]byte(nil), orig...)
 	}
-
-	return d, nil
-}
-
-// FormatError is unused.
-// The type is retained for compatibility.
-type FormatError struct {
+	start := rva - s.VirtualAddress
+	if uint64(start)+uint64(len(b)) > uint64(len(d)) {
+		return fmt.Errorf("RVA range 0x%x+0x%x extends past the end of section %s", rva, len(b), s.Name)
+	}
+	copy(d[start:], b)
+	data[s] = d
+	return nil
 }
 
-func (e *FormatError) Error() string {
-	return "unknown error"
+// is64 reports whether the optional header is PE32+. The header type follows
+// its Magic field, so this holds whatever the machine is.
+func (f *File) is64() bool {
+	_, ok := f.OptionalHeader.(*OptionalHeader64)
+	return ok
 }
 
-//RVAToFileOffset Converts a Relative offset to the actual offset in the file.
-func (f *File) RVAToFileOffset(rva uint32) uint32 {
-	var offset uint32
-	for _, section := range f.Sections {
-		if rva >= section.SectionHeader.VirtualAddress && rva <= section.SectionHeader.VirtualAddress+section.SectionHeader.Size {
-			offset = section.SectionHeader.Offset + (rva - section.SectionHeader.VirtualAddress)
+// dataDirectory returns the data directory entry idx, and false if there is no
+// optional header or it has too few entries to include it.
+func (f *File) dataDirectory(idx int) (DataDirectory, bool) {
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		if uint32(idx) < oh.NumberOfRvaAndSizes && idx < len(oh.DataDirectory) {
+			return oh.DataDirectory[idx], true
+		}
+	case *OptionalHeader64:
+		if uint32(idx) < oh.NumberOfRvaAndSizes && idx < len(oh.DataDirectory) {
+			return oh.DataDirectory[idx], true
 		}
 	}
-	return offset
+	return DataDirectory{}, false
 }
 
 //IsManaged returns true if the loaded PE file references the CLR header (aka is a .net exe)
@@ -5,7 +5,6 @@
 package pe
 
 import (
-	"debug/dwarf"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -16,6 +15,8 @@ import (
 	"strconv"
 	"testing"
 	"text/template"
+
+	"github.com/lesnuages/debug/dwarf"
 )
 
 type fileTest struct {
@@ -0,0 +1,165 @@
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ImportResolver returns the address an import should be bound to. For imports
+// by ordinal name is empty; for imports by name ordinal is the hint.
+type ImportResolver func(dll, name string, ordinal uint16) (uint64, error)
+
+// MapImage lays the image out as the Windows loader would for base: sections
+// are copied to their RVAs in a SizeOfImage buffer, uninitialized data is
+// zero-filled and base relocations are applied. The IAT is left as on disk.
+func (f *File) MapImage(base uint64) ([]byte, error) {
+	return f.MapImageWithImports(base, nil)
+}
+
+// MapImageWithImports is like MapImage, but also fills in the IAT with the
+// addresses returned by resolve, if it is not nil.
+func (f *File) MapImageWithImports(base uint64, resolve ImportResolver) ([]byte, error) {
+	var imageBase uint64
+	var sizeOfImage, sizeOfHeaders uint32
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		imageBase, sizeOfImage, sizeOfHeaders = uint64(oh.ImageBase), oh.SizeOfImage, oh.SizeOfHeaders
+	case *OptionalHeader64:
+		imageBase, sizeOfImage, sizeOfHeaders = oh.ImageBase, oh.SizeOfImage, oh.SizeOfHeaders
+	default:
+		return nil, errors.New("image has no optional header")
+	}
+	if base != imageBase && f.FileHeader.Characteristics&IMAGE_FILE_RELOCS_STRIPPED != 0 {
+		return nil, fmt.Errorf("image has no relocations and can't be mapped at 0x%x", base)
+	}
+
+	if sizeOfHeaders > sizeOfImage {
+		return nil, fmt.Errorf("SizeOfHeaders 0x%x is larger than the image", sizeOfHeaders)
+	}
+	// the ImageBase field is rewritten below
+	if uint64(sizeOfHeaders) < uint64(f.OptionalHeaderOffset)+32 {
+		return nil, fmt.Errorf("SizeOfHeaders 0x%x does not cover the optional header", sizeOfHeaders)
+	}
+	if f.r == nil {
+		return nil, errors.New("image was not read from a reader")
+	}
+
+	// headers are mapped at the start of the image, as they were read
+	image := make([]byte, sizeOfImage)
+	if n, err := f.r.ReadAt(image[:sizeOfHeaders], 0); n != int(sizeOfHeaders) {
+		return nil, fmt.Errorf("fail to read headers: %v", err)
+	}
+
+	for _, s := range f.Sections {
+		data, err := s.Data()
+		if err != nil {
+			return nil, fmt.Errorf("fail to read section %s: %v", s.Name, err)
+		}
+		// raw data is padded to the file alignment, only VirtualSize bytes of it are mapped
+		if s.VirtualSize != 0 && s.VirtualSize < uint32(len(data)) {
+			data = data[:s.VirtualSize]
+		}
+		if uint64(s.VirtualAddress)+uint64(len(data)) > uint64(sizeOfImage) {
+			return nil, fmt.Errorf("section %s extends past SizeOfImage", s.Name)
+		}
+		// whatever is left up to VirtualSize stays zero, as for .bss
+		copy(image[s.VirtualAddress:], data)
+	}
+
+	rva := func(rva uint32) uint32 { return rva }
+	if err := f.applyBaseRelocations(image, rva, base-imageBase); err != nil {
+		return nil, err
+	}
+	if f.is64() {
+		binary.LittleEndian.PutUint64(image[f.OptionalHeaderOffset+24:], base)
+	} else {
+		binary.LittleEndian.PutUint32(image[f.OptionalHeaderOffset+28:], uint32(base))
+	}
+
+	if resolve != nil {
+		if err := f.bindImports(image, resolve); err != nil {
+			return nil, err
+		}
+	}
+	return image, nil
+}
+
+// bindImports walks the import descriptors of a mapped image and writes the
+// resolved address of every import into its IAT slot.
+func (f *File) bindImports(image []byte, resolve ImportResolver) error {
+	idd, ok := f.dataDirectory(IMAGE_DIRECTORY_ENTRY_IMPORT)
+	if !ok || idd.VirtualAddress == 0 {
+		return nil
+	}
+	ptrSize := uint32(4)
+	ordinalFlag := uint64(0x80000000)
+	if f.is64() {
+		ptrSize = 8
+		ordinalFlag = 0x8000000000000000
+	}
+	readPtr := func(rva uint32) (uint64, error) {
+		if uint64(rva)+uint64(ptrSize) > uint64(len(image)) {
+			return 0, fmt.Errorf("thunk at RVA 0x%x is outside of the image", rva)
+		}
+		if ptrSize == 8 {
+			return binary.LittleEndian.Uint64(image[rva:]), nil
+		}
+		return uint64(binary.LittleEndian.Uint32(image[rva:])), nil
+	}
+
+	for desc := idd.VirtualAddress; ; desc += 20 {
+		if uint64(desc)+20 > uint64(len(image)) {
+			return errors.New("import directory extends past the end of the image")
+		}
+		d := image[desc : desc+20]
+		originalFirstThunk := binary.LittleEndian.Uint32(d[0:4])
+		nameRVA := binary.LittleEndian.Uint32(d[12:16])
+		firstThunk := binary.LittleEndian.Uint32(d[16:20])
+		if nameRVA == 0 && firstThunk == 0 {
+			break
+		}
+		dll, _ := getString(image, int(nameRVA))
+
+		// the lookup table may be missing, in which case the IAT itself holds the lookup entries
+		lookup := originalFirstThunk
+		if lookup == 0 {
+			lookup = firstThunk
+		}
+		for i := uint32(0); ; i++ {
+			entry, err := readPtr(lookup + i*ptrSize)
+			if err != nil {
+				return err
+			}
+			if entry == 0 {
+				break
+			}
+			var name string
+			var ordinal uint16
+			if entry&ordinalFlag != 0 {
+				ordinal = uint16(entry)
+			} else {
+				hintRVA := uint32(entry & 0x7fffffff)
+				if uint64(hintRVA)+2 > uint64(len(image)) {
+					return fmt.Errorf("import name of %s at RVA 0x%x is outside of the image", dll, hintRVA)
+				}
+				ordinal = binary.LittleEndian.Uint16(image[hintRVA:])
+				name, _ = getString(image, int(hintRVA+2))
+			}
+			addr, err := resolve(dll, name, ordinal)
+			if err != nil {
+				return fmt.Errorf("fail to resolve import %s!%s: %v", dll, name, err)
+			}
+			slot := firstThunk + i*ptrSize
+			if _, err := readPtr(slot); err != nil {
+				return err
+			}
+			if ptrSize == 8 {
+				binary.LittleEndian.PutUint64(image[slot:], addr)
+			} else {
+				binary.LittleEndian.PutUint32(image[slot:], uint32(addr))
+			}
+		}
+	}
+	return nil
+}
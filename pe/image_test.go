@@ -0,0 +1,199 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestMapImage(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	oh := f.OptionalHeader.(*OptionalHeader64)
+
+	fh := f.FileHeader
+
+	resolved := make(map[string]uint64)
+	next := uint64(0x7ff000000000)
+	image, err := f.MapImageWithImports(oh.ImageBase, func(dll, name string, ordinal uint16) (uint64, error) {
+		next += 0x10
+		resolved[name+":"+dll] = next
+		return next, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(image) != int(oh.SizeOfImage) {
+		t.Fatalf("mapped image is %d bytes, want %d", len(image), oh.SizeOfImage)
+	}
+	if f.FileHeader != fh {
+		t.Errorf("mapping the image changed its file header to %+v", f.FileHeader)
+	}
+
+	for _, s := range f.Sections {
+		data, err := s.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.VirtualSize < uint32(len(data)) {
+			data = data[:s.VirtualSize]
+		}
+		if s.Name == ".idata" {
+			continue // the IAT has been bound
+		}
+		mapped := image[s.VirtualAddress : s.VirtualAddress+s.VirtualSize]
+		if !bytes.Equal(mapped[:len(data)], data) {
+			t.Errorf("section %s is not mapped at its RVA", s.Name)
+		}
+		for _, b := range mapped[len(data):] {
+			if b != 0 {
+				t.Errorf("section %s is not zero-filled past its raw data", s.Name)
+				break
+			}
+		}
+	}
+
+	symbols, err := f.ImportedSymbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resolved) != len(symbols) {
+		t.Errorf("resolver was called for %d imports, want %d", len(resolved), len(symbols))
+	}
+	ida, _, _, err := f.ImportDirectoryTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dt := range ida {
+		if addr := binary.LittleEndian.Uint64(image[dt.FirstThunk:]); addr < 0x7ff000000000 {
+			t.Errorf("first IAT slot of %s holds 0x%x, which was not returned by the resolver", dt.DllName, addr)
+		}
+	}
+
+	// headers too small to hold ImageBase are rejected
+	oh.SizeOfHeaders = uint32(f.OptionalHeaderOffset) + 16
+	if _, err := f.MapImage(oh.ImageBase); err == nil {
+		t.Error("mapped an image whose headers do not hold the optional header")
+	}
+}
+
+func TestRelocateUnsupported(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.BaseRelocationTable = &[]RelocationTableEntry{{
+		RelocationBlock: RelocationBlock{VirtualAddress: f.Sections[0].VirtualAddress, SizeOfBlock: 12},
+		BlockItems:      []BlockItem{{Type: IMAGE_REL_BASED_DIR64, Offset: 0}, {Type: 9, Offset: 8}},
+	}}
+
+	image := append([]byte(nil), b...)
+	if err := f.Relocate(0x10000000, &image); err == nil {
+		t.Fatal("Relocate accepted an unsupported base relocation type")
+	}
+	if !bytes.Equal(image, b) {
+		t.Error("Relocate modified the image before failing")
+	}
+}
+
+func TestMapImageRelocated(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		typ   byte
+		size  int
+		field int64 // offset of ImageBase in the optional header
+	}{
+		{"testdata/gcc-amd64-mingw-exec", IMAGE_REL_BASED_DIR64, 8, 24},
+		{"testdata/gcc-386-mingw-exec", IMAGE_REL_BASED_HIGHLOW, 4, 28},
+	} {
+		f, err := Open(tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var imageBase uint64
+		switch oh := f.OptionalHeader.(type) {
+		case *OptionalHeader32:
+			imageBase = uint64(oh.ImageBase)
+		case *OptionalHeader64:
+			imageBase = oh.ImageBase
+		}
+		if _, err := f.MapImage(imageBase + 0x10000); err == nil {
+			t.Errorf("%s: image with stripped relocations was mapped at another base", tt.name)
+		}
+
+		// relocate a slot of the data section
+		data := f.Section(".data")
+		f.FileHeader.Characteristics &^= IMAGE_FILE_RELOCS_STRIPPED
+		f.BaseRelocationTable = &[]RelocationTableEntry{{
+			RelocationBlock: RelocationBlock{VirtualAddress: data.VirtualAddress, SizeOfBlock: 12},
+			BlockItems:      []BlockItem{{Type: tt.typ, Offset: 0x10}, {Type: IMAGE_REL_BASED_ABSOLUTE}},
+		}}
+		orig, err := f.MapImage(imageBase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		const delta = 0x10000
+		moved, err := f.MapImage(imageBase + delta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		slot := data.VirtualAddress + 0x10
+		read := func(b []byte) uint64 {
+			if tt.size == 8 {
+				return binary.LittleEndian.Uint64(b)
+			}
+			return uint64(binary.LittleEndian.Uint32(b))
+		}
+		if have, want := read(moved[slot:]), read(orig[slot:])+delta; have != want {
+			t.Errorf("%s: relocated slot holds 0x%x, want 0x%x", tt.name, have, want)
+		}
+		field := f.OptionalHeaderOffset + tt.field
+		if have := read(moved[field:]); have != imageBase+delta {
+			t.Errorf("%s: ImageBase of the mapped image is 0x%x, want 0x%x", tt.name, have, imageBase+delta)
+		}
+		orig[slot], moved[slot] = 0, 0
+		for i := 1; i < tt.size; i++ {
+			orig[int(slot)+i], moved[int(slot)+i] = 0, 0
+		}
+		copy(moved[field:field+int64(tt.size)], orig[field:])
+		if !bytes.Equal(orig, moved) {
+			t.Errorf("%s: mapping at another base changed more than the relocated slot", tt.name)
+		}
+	}
+}
+
+func TestApplyBaseRelocationsHighAdj(t *testing.T) {
+	// the low half 0x9000 is negative, so the value is 0x1234<<16 - 0x7000
+	f := &File{BaseRelocationTable: &[]RelocationTableEntry{{
+		RelocationBlock: RelocationBlock{VirtualAddress: 0, SizeOfBlock: 12},
+		BlockItems:      []BlockItem{{Type: IMAGE_REL_BASED_HIGHADJ, Offset: 0}, {Type: 0x9, Offset: 0x000}},
+	}}}
+	rva := func(rva uint32) uint32 { return rva }
+	for _, tt := range []struct {
+		delta uint64
+		want  uint16
+	}{
+		{0, 0x1234},
+		{0x10000, 0x1235},
+		{0x8000, 0x1234},
+		{0xf000, 0x1235},
+	} {
+		image := []byte{0x34, 0x12}
+		if err := f.applyBaseRelocations(image, rva, tt.delta); err != nil {
+			t.Fatal(err)
+		}
+		if have := binary.LittleEndian.Uint16(image); have != tt.want {
+			t.Errorf("delta 0x%x: high half is 0x%x, want 0x%x", tt.delta, have, tt.want)
+		}
+	}
+}
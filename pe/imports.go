@@ -18,59 +18,23 @@ type ImportDirectory struct {
 
 // IAT returns the DataDirectory for the IAT
 func (f *File) IAT() *DataDirectory {
-	pe64 := f.Machine == IMAGE_FILE_MACHINE_AMD64
-
-	// grab the number of data directory entries
-	var ddLength uint32
-	if pe64 {
-		ddLength = f.OptionalHeader.(*OptionalHeader64).NumberOfRvaAndSizes
-	} else {
-		ddLength = f.OptionalHeader.(*OptionalHeader32).NumberOfRvaAndSizes
-	}
-
-	// check that the length of data directory entries is large
-	// enough to include the imports directory.
-	if ddLength < IMAGE_DIRECTORY_ENTRY_IAT+1 {
+	// grab the IAT entry, if the data directory is large enough to include it
+	idd, ok := f.dataDirectory(IMAGE_DIRECTORY_ENTRY_IAT)
+	if !ok {
 		return nil
 	}
-
-	// grab the IAT entry
-	var idd DataDirectory
-	if pe64 {
-		idd = f.OptionalHeader.(*OptionalHeader64).DataDirectory[IMAGE_DIRECTORY_ENTRY_IAT]
-	} else {
-		idd = f.OptionalHeader.(*OptionalHeader32).DataDirectory[IMAGE_DIRECTORY_ENTRY_IAT]
-	}
 	return &idd
 }
 
 // ImportDirectoryTable - returns the Import Directory Table, a pointer to the section, and the section raw data
 func (f *File) ImportDirectoryTable() ([]ImportDirectory, *Section, *[]byte, error) {
 
-	pe64 := f.Machine == IMAGE_FILE_MACHINE_AMD64
-
-	// grab the number of data directory entries
-	var ddLength uint32
-	if pe64 {
-		ddLength = f.OptionalHeader.(*OptionalHeader64).NumberOfRvaAndSizes
-	} else {
-		ddLength = f.OptionalHeader.(*OptionalHeader32).NumberOfRvaAndSizes
-	}
-
-	// check that the length of data directory entries is large
-	// enough to include the imports directory.
-	if ddLength < IMAGE_DIRECTORY_ENTRY_IMPORT+1 {
+	// grab the import data directory entry, if the data directory is large enough to include it
+	idd, ok := f.dataDirectory(IMAGE_DIRECTORY_ENTRY_IMPORT)
+	if !ok {
 		return nil, nil, nil, nil
 	}
 
-	// grab the import data directory entry
-	var idd DataDirectory
-	if pe64 {
-		idd = f.OptionalHeader.(*OptionalHeader64).DataDirectory[IMAGE_DIRECTORY_ENTRY_IMPORT]
-	} else {
-		idd = f.OptionalHeader.(*OptionalHeader32).DataDirectory[IMAGE_DIRECTORY_ENTRY_IMPORT]
-	}
-
 	// figure out which section contains the import directory table
 	var ds *Section
 	ds = nil
@@ -118,7 +82,7 @@ func (f *File) ImportDirectoryTable() ([]ImportDirectory, *Section, *[]byte, err
 // satisfied by other libraries at dynamic load time.
 // It does not return weak symbols.
 func (f *File) ImportedSymbols() ([]string, error) {
-	pe64 := f.Machine == IMAGE_FILE_MACHINE_AMD64
+	pe64 := f.is64()
 
 	ida, ds, sectionData, err := f.ImportDirectoryTable()
 	if err != nil {
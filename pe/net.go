@@ -1,8 +1,12 @@
 package pe
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
+	"unicode/utf16"
 )
 
 type IMAGE_COR20_HEADER struct {
@@ -20,14 +24,29 @@ type IMAGE_COR20_HEADER struct {
 	ManagedNativeHeaderRVA, ManagedNativeHeaderSize uint32
 }
 
-//Net provides a public interface for getting at some net info.
+// Net provides a public interface for getting at some net info.
 type Net struct {
 	NetDirectory IMAGE_COR20_HEADER //Net directory information
 	MetaData     NetMetaData        //MetaData Header
+
+	Tables *NetTables // decoded #~ stream, nil if the metadata has none
+
+	StringsHeap []byte // #Strings heap
+	USHeap      []byte // #US (user strings) heap
+	GUIDHeap    []byte // #GUID heap
+	BlobHeap    []byte // #Blob heap
+
+	// Err records why the metadata could not be read, if it could not.
+	// NewFile still succeeds for such files; the fields above hold
+	// whatever was decoded before the failure.
+	Err error
 }
 
+// metadataSignature is "BSJB", the magic number of the metadata root
+const metadataSignature = 0x424a5342
+
 type NetMetaData struct {
-	Signature       [4]byte //should be 0x424a4542
+	Signature       [4]byte //should be 0x424a5342
 	MajorVersion    uint16
 	MinorVersion    uint16
 	Reserved        uint32
@@ -35,28 +54,234 @@ type NetMetaData struct {
 	VersionString   []byte
 	Flags           uint16 //todo: define flags betterer
 	NumberOfStreams uint16
+	StreamHeaders   []NetStreamHeader
+}
+
+// NetStreamHeader describes where a metadata stream lives, relative to the metadata root
+type NetStreamHeader struct {
+	Offset uint32
+	Size   uint32
+	Name   string
 }
 
 func newMetadataHeader(i io.Reader) (NetMetaData, error) {
 	r := NetMetaData{}
 
-	//todo: error checks/sanity checks
-	binary.Read(i, binary.LittleEndian, &r.Signature)
-	binary.Read(i, binary.LittleEndian, &r.MajorVersion)
-	binary.Read(i, binary.LittleEndian, &r.MinorVersion)
-	binary.Read(i, binary.LittleEndian, &r.Reserved)
+	if err := binary.Read(i, binary.LittleEndian, &r.Signature); err != nil {
+		return r, err
+	}
+	if binary.LittleEndian.Uint32(r.Signature[:]) != metadataSignature {
+		return r, fmt.Errorf("bad metadata signature %x", r.Signature)
+	}
+	if err := binary.Read(i, binary.LittleEndian, &r.MajorVersion); err != nil {
+		return r, err
+	}
+	if err := binary.Read(i, binary.LittleEndian, &r.MinorVersion); err != nil {
+		return r, err
+	}
+	if err := binary.Read(i, binary.LittleEndian, &r.Reserved); err != nil {
+		return r, err
+	}
 
-	// it appears that this value is terminated by two nulls.. that might be important at some point
-	binary.Read(i, binary.LittleEndian, &r.VersionLength)
+	// the version string is null padded to a multiple of four bytes, VersionLength includes the padding
+	if err := binary.Read(i, binary.LittleEndian, &r.VersionLength); err != nil {
+		return r, err
+	}
+	if r.VersionLength > 255 {
+		return r, fmt.Errorf("metadata version length %d is too large", r.VersionLength)
+	}
 	r.VersionString = make([]byte, r.VersionLength)
-	i.Read(r.VersionString)
+	if _, err := io.ReadFull(i, r.VersionString); err != nil {
+		return r, err
+	}
+
+	if err := binary.Read(i, binary.LittleEndian, &r.Flags); err != nil {
+		return r, err
+	}
+	if err := binary.Read(i, binary.LittleEndian, &r.NumberOfStreams); err != nil {
+		return r, err
+	}
 
-	binary.Read(i, binary.LittleEndian, r.Flags)
+	for n := uint16(0); n < r.NumberOfStreams; n++ {
+		var sh NetStreamHeader
+		if err := binary.Read(i, binary.LittleEndian, &sh.Offset); err != nil {
+			return r, err
+		}
+		if err := binary.Read(i, binary.LittleEndian, &sh.Size); err != nil {
+			return r, err
+		}
+		// names are null terminated and padded to a multiple of four bytes, at most 32 bytes long
+		var name []byte
+		for len(name) < 32 {
+			var chunk [4]byte
+			if _, err := io.ReadFull(i, chunk[:]); err != nil {
+				return r, err
+			}
+			name = append(name, chunk[:]...)
+			if bytes.IndexByte(chunk[:], 0) != -1 {
+				break
+			}
+		}
+		sh.Name = cstring(name)
+		r.StreamHeaders = append(r.StreamHeaders, sh)
+	}
 
 	return r, nil
 }
 
-//NetCLRVersion returns the CLR version specified by the binary. Returns an empty string if not a net binary. String has had trailing nulls stripped.
+// readMetadata parses the metadata root and its streams from metadata, the raw bytes at MetaDataRVA
+func (n *Net) readMetadata(metadata []byte) error {
+	var err error
+	n.MetaData, err = newMetadataHeader(bytes.NewReader(metadata))
+	if err != nil {
+		return err
+	}
+
+	var tables []byte
+	for _, sh := range n.MetaData.StreamHeaders {
+		if uint64(sh.Offset)+uint64(sh.Size) > uint64(len(metadata)) {
+			return fmt.Errorf("stream %s extends past the end of the metadata", sh.Name)
+		}
+		stream := metadata[sh.Offset : sh.Offset+sh.Size]
+		switch sh.Name {
+		case "#~", "#-":
+			tables = stream
+		case "#Strings":
+			n.StringsHeap = stream
+		case "#US":
+			n.USHeap = stream
+		case "#GUID":
+			n.GUIDHeap = stream
+		case "#Blob":
+			n.BlobHeap = stream
+		}
+	}
+
+	if tables != nil {
+		n.Tables, err = n.readTables(tables)
+		if err != nil {
+			return fmt.Errorf("fail to read metadata tables: %v", err)
+		}
+	}
+	return nil
+}
+
+// String returns the string at offset idx of the #Strings heap
+func (n *Net) String(idx uint32) string {
+	s, _ := getString(n.StringsHeap, int(idx))
+	return s
+}
+
+// GUID returns the GUID at the 1-based index idx of the #GUID heap
+func (n *Net) GUID(idx uint32) (GUID, bool) {
+	var g GUID
+	if idx == 0 || uint64(idx)*16 > uint64(len(n.GUIDHeap)) {
+		return g, false
+	}
+	b := n.GUIDHeap[(idx-1)*16 : idx*16]
+	g.Data1 = binary.LittleEndian.Uint32(b[0:4])
+	g.Data2 = binary.LittleEndian.Uint16(b[4:6])
+	g.Data3 = binary.LittleEndian.Uint16(b[6:8])
+	copy(g.Data4[:], b[8:16])
+	return g, true
+}
+
+// Blob returns the blob at offset idx of the #Blob heap
+func (n *Net) Blob(idx uint32) []byte {
+	b, _ := readBlob(n.BlobHeap, idx)
+	return b
+}
+
+// UserString returns the string literal at offset idx of the #US heap
+func (n *Net) UserString(idx uint32) string {
+	b, ok := readBlob(n.USHeap, idx)
+	if !ok || len(b) < 2 {
+		return ""
+	}
+	// the trailing byte flags strings that need special handling, it is not part of the text
+	b = b[:len(b)-1]
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(u))
+}
+
+// readBlob reads a length prefixed blob, the length being in ECMA-335 compressed integer format
+func readBlob(heap []byte, idx uint32) ([]byte, bool) {
+	if int(idx) >= len(heap) {
+		return nil, false
+	}
+	b := heap[idx:]
+	var l, hdr uint32
+	switch {
+	case b[0]&0x80 == 0:
+		l, hdr = uint32(b[0]), 1
+	case b[0]&0xc0 == 0x80 && len(b) >= 2:
+		l, hdr = uint32(b[0]&0x3f)<<8|uint32(b[1]), 2
+	case b[0]&0xe0 == 0xc0 && len(b) >= 4:
+		l, hdr = uint32(b[0]&0x1f)<<24|uint32(b[1])<<16|uint32(b[2])<<8|uint32(b[3]), 4
+	default:
+		return nil, false
+	}
+	if uint64(hdr)+uint64(l) > uint64(len(b)) {
+		return nil, false
+	}
+	return b[hdr : hdr+l], true
+}
+
+// readNet reads the COR20 header and metadata of a managed executable
+func (f *File) readNet(r io.ReaderAt, memoryMode bool) error {
+	var va, size uint32
+
+	//determine location of the COM descriptor directory
+	switch v := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		va = v.DataDirectory[IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR].VirtualAddress
+		size = v.DataDirectory[IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR].Size
+	case *OptionalHeader64:
+		va = v.DataDirectory[IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR].VirtualAddress
+		size = v.DataDirectory[IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR].Size
+	}
+	if size < uint32(binary.Size(f.Net.NetDirectory)) {
+		return fmt.Errorf("COR20 header size %d is too small", size)
+	}
+
+	readAt := func(buff []byte, rva uint32) error {
+		off := int64(rva)
+		if !memoryMode {
+			off = int64(f.RVAToFileOffset(rva))
+		}
+		n, err := r.ReadAt(buff, off)
+		if n == len(buff) {
+			return nil
+		}
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	buff := make([]byte, size)
+	if err := readAt(buff, va); err != nil {
+		return fmt.Errorf("fail to read COR20 header: %v", err)
+	}
+	if err := binary.Read(bytes.NewReader(buff), binary.LittleEndian, &f.Net.NetDirectory); err != nil {
+		return fmt.Errorf("fail to read COR20 header: %v", err)
+	}
+
+	//Now that we have the COR20 header (COM descriptor directory header), we can get the metadata section header, which has the version
+	if f.Net.NetDirectory.MetaDataSize == 0 {
+		return errors.New("COR20 header has no metadata")
+	}
+	buff = make([]byte, f.Net.NetDirectory.MetaDataSize)
+	if err := readAt(buff, f.Net.NetDirectory.MetaDataRVA); err != nil {
+		return fmt.Errorf("fail to read metadata: %v", err)
+	}
+	return f.Net.readMetadata(buff)
+}
+
+// NetCLRVersion returns the CLR version specified by the binary. Returns an empty string if not a net binary. String has had trailing nulls stripped.
 func (f File) NetCLRVersion() string {
 	b := f.Net.MetaData.VersionString
 	for i, x := range b {
@@ -67,3 +292,70 @@ func (f File) NetCLRVersion() string {
 	}
 	return string(b)
 }
+
+// NetAssemblyReference - an assembly referenced by a managed binary
+type NetAssemblyReference struct {
+	Name             string
+	Culture          string
+	Version          [4]uint16 // major, minor, build, revision
+	PublicKeyOrToken []byte
+}
+
+// String returns the reference in the usual "Name, Version=..., Culture=..." form
+func (a NetAssemblyReference) String() string {
+	culture := a.Culture
+	if culture == "" {
+		culture = "neutral"
+	}
+	return fmt.Sprintf("%s, Version=%d.%d.%d.%d, Culture=%s", a.Name, a.Version[0], a.Version[1], a.Version[2], a.Version[3], culture)
+}
+
+// NetReferencedAssemblies returns the assemblies listed in the AssemblyRef table.
+// Returns nil if not a net binary.
+func (f *File) NetReferencedAssemblies() []NetAssemblyReference {
+	if f.Net.Tables == nil {
+		return nil
+	}
+	var refs []NetAssemblyReference
+	for _, a := range f.Net.Tables.AssemblyRefs {
+		refs = append(refs, NetAssemblyReference{
+			Name:             a.Name,
+			Culture:          a.Culture,
+			Version:          [4]uint16{a.MajorVersion, a.MinorVersion, a.BuildNumber, a.RevisionNumber},
+			PublicKeyOrToken: a.PublicKeyOrToken,
+		})
+	}
+	return refs
+}
+
+// NetPInvokeImport - a native function imported through P/Invoke
+type NetPInvokeImport struct {
+	Module       string // the native library, as given to DllImport
+	Name         string // the name of the native entry point
+	Method       string // the managed method the import is bound to
+	MappingFlags uint16
+}
+
+// NetPInvokeImports returns the native functions imported through the ImplMap table.
+// Returns nil if not a net binary.
+func (f *File) NetPInvokeImports() []NetPInvokeImport {
+	t := f.Net.Tables
+	if t == nil {
+		return nil
+	}
+	var imports []NetPInvokeImport
+	for _, im := range t.ImplMaps {
+		imp := NetPInvokeImport{
+			Name:         im.ImportName,
+			MappingFlags: im.MappingFlags,
+		}
+		if im.ImportScope >= 1 && int(im.ImportScope) <= len(t.ModuleRefs) {
+			imp.Module = t.ModuleRefs[im.ImportScope-1]
+		}
+		if table, row := TokenTable(im.MemberForwarded), TokenRow(im.MemberForwarded); table == NetTableMethodDef && row >= 1 && int(row) <= len(t.MethodDefs) {
+			imp.Method = t.MethodDefs[row-1].Name
+		}
+		imports = append(imports, imp)
+	}
+	return imports
+}
@@ -0,0 +1,120 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+)
+
+// buildMetadata assembles a metadata root holding the given streams
+func buildMetadata(streams []NetStreamHeader, data [][]byte) []byte {
+	var hdr bytes.Buffer
+	w := func(v interface{}) { binary.Write(&hdr, binary.LittleEndian, v) }
+	version := []byte("v4.0.30319\x00\x00")
+	w(uint32(metadataSignature))
+	w([2]uint16{1, 1})
+	w(uint32(0))
+	w(uint32(len(version)))
+	hdr.Write(version)
+	w([2]uint16{0, uint16(len(streams))})
+
+	headerSize := hdr.Len()
+	for _, sh := range streams {
+		headerSize += 8 + (len(sh.Name)+4)&^3
+	}
+	offset := uint32(headerSize)
+	for i := range streams {
+		streams[i].Offset = offset
+		streams[i].Size = uint32(len(data[i]))
+		offset += streams[i].Size
+	}
+	for _, sh := range streams {
+		w([2]uint32{sh.Offset, sh.Size})
+		name := make([]byte, (len(sh.Name)+4)&^3)
+		copy(name, sh.Name)
+		hdr.Write(name)
+	}
+	for _, d := range data {
+		hdr.Write(d)
+	}
+	return hdr.Bytes()
+}
+
+func TestNetMetadataTables(t *testing.T) {
+	strings := []byte("\x00mscorlib\x00kernel32.dll\x00Beep\x00NativeBeep\x00")
+	blob := []byte{0, 8, 0xb7, 0x7a, 0x5c, 0x56, 0x19, 0x34, 0xe0, 0x89}
+
+	var tables bytes.Buffer
+	w := func(v interface{}) { binary.Write(&tables, binary.LittleEndian, v) }
+	w(uint32(0))
+	w([4]uint8{2, 0, 0, 1})
+	valid := uint64(1)<<NetTableMethodDef | 1<<NetTableModuleRef | 1<<NetTableImplMap | 1<<NetTableAssemblyRef
+	w(valid)
+	w(uint64(0))
+	w([4]uint32{1, 1, 1, 1}) // row counts, in table order
+	// MethodDef: RVA, ImplFlags, Flags, Name, Signature, ParamList
+	w(uint32(0))
+	w([5]uint16{0x80, 0x2096, 28, 0, 1})
+	// ModuleRef: Name
+	w(uint16(10))
+	// ImplMap: MappingFlags, MemberForwarded (MethodDef 1), ImportName, ImportScope
+	w([4]uint16{0x100, 1<<1 | 1, 23, 1})
+	// AssemblyRef: version, Flags, PublicKeyOrToken, Name, Culture, HashValue
+	w([4]uint16{4, 0, 0, 0})
+	w(uint32(0))
+	w([4]uint16{1, 1, 0, 0})
+
+	md := buildMetadata([]NetStreamHeader{{Name: "#~"}, {Name: "#Strings"}, {Name: "#Blob"}},
+		[][]byte{tables.Bytes(), strings, blob})
+
+	var f File
+	if err := f.Net.readMetadata(md); err != nil {
+		t.Fatal(err)
+	}
+	if v := f.NetCLRVersion(); v != "v4.0.30319" {
+		t.Errorf("NetCLRVersion = %q, want v4.0.30319", v)
+	}
+	if f.Net.MetaData.NumberOfStreams != 3 {
+		t.Errorf("NumberOfStreams = %d, want 3", f.Net.MetaData.NumberOfStreams)
+	}
+
+	refs := f.NetReferencedAssemblies()
+	if len(refs) != 1 {
+		t.Fatalf("got %d assembly references, want 1", len(refs))
+	}
+	if want := "mscorlib, Version=4.0.0.0, Culture=neutral"; refs[0].String() != want {
+		t.Errorf("assembly reference = %q, want %q", refs[0], want)
+	}
+	if !bytes.Equal(refs[0].PublicKeyOrToken, blob[2:]) {
+		t.Errorf("PublicKeyOrToken = %x, want %x", refs[0].PublicKeyOrToken, blob[2:])
+	}
+
+	imports := f.NetPInvokeImports()
+	want := NetPInvokeImport{Module: "kernel32.dll", Name: "Beep", Method: "NativeBeep", MappingFlags: 0x100}
+	if len(imports) != 1 || imports[0] != want {
+		t.Errorf("NetPInvokeImports = %+v, want [%+v]", imports, want)
+	}
+}
+
+func TestNetMetadataBestEffort(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/gcc-386-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// point the COM descriptor at a directory too small for a COR20 header
+	dir := binary.LittleEndian.Uint32(b[0x3c:]) + 4 + 20 + 96 + IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR*8
+	binary.LittleEndian.PutUint32(b[dir:], 0x1000)
+	binary.LittleEndian.PutUint32(b[dir+4:], 8)
+
+	f, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("NewFile failed on unreadable .NET metadata: %v", err)
+	}
+	if !f.IsManaged() {
+		t.Fatal("file is not reported as managed")
+	}
+	if f.Net.Err == nil {
+		t.Error("Net.Err is nil for unreadable .NET metadata")
+	}
+}
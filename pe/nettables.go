@@ -0,0 +1,433 @@
+package pe
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Metadata table numbers, as used in the Valid bitmask of the #~ stream and in metadata tokens
+const (
+	NetTableModule                 = 0x00
+	NetTableTypeRef                = 0x01
+	NetTableTypeDef                = 0x02
+	NetTableFieldPtr               = 0x03
+	NetTableField                  = 0x04
+	NetTableMethodPtr              = 0x05
+	NetTableMethodDef              = 0x06
+	NetTableParamPtr               = 0x07
+	NetTableParam                  = 0x08
+	NetTableInterfaceImpl          = 0x09
+	NetTableMemberRef              = 0x0a
+	NetTableConstant               = 0x0b
+	NetTableCustomAttribute        = 0x0c
+	NetTableFieldMarshal           = 0x0d
+	NetTableDeclSecurity           = 0x0e
+	NetTableClassLayout            = 0x0f
+	NetTableFieldLayout            = 0x10
+	NetTableStandAloneSig          = 0x11
+	NetTableEventMap               = 0x12
+	NetTableEventPtr               = 0x13
+	NetTableEvent                  = 0x14
+	NetTablePropertyMap            = 0x15
+	NetTablePropertyPtr            = 0x16
+	NetTableProperty               = 0x17
+	NetTableMethodSemantics        = 0x18
+	NetTableMethodImpl             = 0x19
+	NetTableModuleRef              = 0x1a
+	NetTableTypeSpec               = 0x1b
+	NetTableImplMap                = 0x1c
+	NetTableFieldRVA               = 0x1d
+	NetTableEncLog                 = 0x1e
+	NetTableEncMap                 = 0x1f
+	NetTableAssembly               = 0x20
+	NetTableAssemblyProcessor      = 0x21
+	NetTableAssemblyOS             = 0x22
+	NetTableAssemblyRef            = 0x23
+	NetTableAssemblyRefProcessor   = 0x24
+	NetTableAssemblyRefOS          = 0x25
+	NetTableFile                   = 0x26
+	NetTableExportedType           = 0x27
+	NetTableManifestResource       = 0x28
+	NetTableNestedClass            = 0x29
+	NetTableGenericParam           = 0x2a
+	NetTableMethodSpec             = 0x2b
+	NetTableGenericParamConstraint = 0x2c
+)
+
+// TokenTable returns the table number of a metadata token
+func TokenTable(token uint32) uint32 { return token >> 24 }
+
+// TokenRow returns the 1-based row number of a metadata token
+func TokenRow(token uint32) uint32 { return token & 0x00ffffff }
+
+// HeapSizes bits of the #~ stream header
+const (
+	heapSizeStrings = 0x01
+	heapSizeGUID    = 0x02
+	heapSizeBlob    = 0x04
+	heapExtraData   = 0x40
+)
+
+// column kinds of a metadata table schema
+const (
+	colU16 = iota
+	colU32
+	colString
+	colGUID
+	colBlob
+	colIndex // simple index into the table given by netColumn.ref
+	colCoded // coded index of the kind given by netColumn.ref
+)
+
+type netColumn struct {
+	kind uint8
+	ref  uint8
+}
+
+// coded index kinds
+const (
+	codedTypeDefOrRef = iota
+	codedHasConstant
+	codedHasCustomAttribute
+	codedHasFieldMarshal
+	codedHasDeclSecurity
+	codedMemberRefParent
+	codedHasSemantics
+	codedMethodDefOrRef
+	codedMemberForwarded
+	codedImplementation
+	codedCustomAttributeType
+	codedResolutionScope
+	codedTypeOrMethodDef
+)
+
+// noTable marks a coded index tag that does not refer to any table
+const noTable = 0xff
+
+// codedIndexTables lists, for each coded index kind, the tables selected by its tag bits
+var codedIndexTables = [...][]uint8{
+	codedTypeDefOrRef:        {NetTableTypeDef, NetTableTypeRef, NetTableTypeSpec},
+	codedHasConstant:         {NetTableField, NetTableParam, NetTableProperty},
+	codedHasCustomAttribute:  {NetTableMethodDef, NetTableField, NetTableTypeRef, NetTableTypeDef, NetTableParam, NetTableInterfaceImpl, NetTableMemberRef, NetTableModule, NetTableDeclSecurity, NetTableProperty, NetTableEvent, NetTableStandAloneSig, NetTableModuleRef, NetTableTypeSpec, NetTableAssembly, NetTableAssemblyRef, NetTableFile, NetTableExportedType, NetTableManifestResource, NetTableGenericParam, NetTableGenericParamConstraint, NetTableMethodSpec},
+	codedHasFieldMarshal:     {NetTableField, NetTableParam},
+	codedHasDeclSecurity:     {NetTableTypeDef, NetTableMethodDef, NetTableAssembly},
+	codedMemberRefParent:     {NetTableTypeDef, NetTableTypeRef, NetTableModuleRef, NetTableMethodDef, NetTableTypeSpec},
+	codedHasSemantics:        {NetTableEvent, NetTableProperty},
+	codedMethodDefOrRef:      {NetTableMethodDef, NetTableMemberRef},
+	codedMemberForwarded:     {NetTableField, NetTableMethodDef},
+	codedImplementation:      {NetTableFile, NetTableAssemblyRef, NetTableExportedType},
+	codedCustomAttributeType: {noTable, noTable, NetTableMethodDef, NetTableMemberRef, noTable},
+	codedResolutionScope:     {NetTableModule, NetTableModuleRef, NetTableAssemblyRef, NetTableTypeRef},
+	codedTypeOrMethodDef:     {NetTableTypeDef, NetTableMethodDef},
+}
+
+// codedIndexBits returns the number of tag bits of a coded index kind
+func codedIndexBits(kind uint8) uint {
+	bits := uint(0)
+	for 1<<bits < len(codedIndexTables[kind]) {
+		bits++
+	}
+	return bits
+}
+
+var (
+	ncU16     = netColumn{kind: colU16}
+	ncU32     = netColumn{kind: colU32}
+	ncString  = netColumn{kind: colString}
+	ncGUID    = netColumn{kind: colGUID}
+	ncBlob    = netColumn{kind: colBlob}
+	ncIndex   = func(table uint8) netColumn { return netColumn{colIndex, table} }
+	ncCoded   = func(kind uint8) netColumn { return netColumn{colCoded, kind} }
+	netSchema = [...][]netColumn{
+		NetTableModule:                 {ncU16, ncString, ncGUID, ncGUID, ncGUID},
+		NetTableTypeRef:                {ncCoded(codedResolutionScope), ncString, ncString},
+		NetTableTypeDef:                {ncU32, ncString, ncString, ncCoded(codedTypeDefOrRef), ncIndex(NetTableField), ncIndex(NetTableMethodDef)},
+		NetTableFieldPtr:               {ncIndex(NetTableField)},
+		NetTableField:                  {ncU16, ncString, ncBlob},
+		NetTableMethodPtr:              {ncIndex(NetTableMethodDef)},
+		NetTableMethodDef:              {ncU32, ncU16, ncU16, ncString, ncBlob, ncIndex(NetTableParam)},
+		NetTableParamPtr:               {ncIndex(NetTableParam)},
+		NetTableParam:                  {ncU16, ncU16, ncString},
+		NetTableInterfaceImpl:          {ncIndex(NetTableTypeDef), ncCoded(codedTypeDefOrRef)},
+		NetTableMemberRef:              {ncCoded(codedMemberRefParent), ncString, ncBlob},
+		NetTableConstant:               {ncU16, ncCoded(codedHasConstant), ncBlob},
+		NetTableCustomAttribute:        {ncCoded(codedHasCustomAttribute), ncCoded(codedCustomAttributeType), ncBlob},
+		NetTableFieldMarshal:           {ncCoded(codedHasFieldMarshal), ncBlob},
+		NetTableDeclSecurity:           {ncU16, ncCoded(codedHasDeclSecurity), ncBlob},
+		NetTableClassLayout:            {ncU16, ncU32, ncIndex(NetTableTypeDef)},
+		NetTableFieldLayout:            {ncU32, ncIndex(NetTableField)},
+		NetTableStandAloneSig:          {ncBlob},
+		NetTableEventMap:               {ncIndex(NetTableTypeDef), ncIndex(NetTableEvent)},
+		NetTableEventPtr:               {ncIndex(NetTableEvent)},
+		NetTableEvent:                  {ncU16, ncString, ncCoded(codedTypeDefOrRef)},
+		NetTablePropertyMap:            {ncIndex(NetTableTypeDef), ncIndex(NetTableProperty)},
+		NetTablePropertyPtr:            {ncIndex(NetTableProperty)},
+		NetTableProperty:               {ncU16, ncString, ncBlob},
+		NetTableMethodSemantics:        {ncU16, ncIndex(NetTableMethodDef), ncCoded(codedHasSemantics)},
+		NetTableMethodImpl:             {ncIndex(NetTableTypeDef), ncCoded(codedMethodDefOrRef), ncCoded(codedMethodDefOrRef)},
+		NetTableModuleRef:              {ncString},
+		NetTableTypeSpec:               {ncBlob},
+		NetTableImplMap:                {ncU16, ncCoded(codedMemberForwarded), ncString, ncIndex(NetTableModuleRef)},
+		NetTableFieldRVA:               {ncU32, ncIndex(NetTableField)},
+		NetTableEncLog:                 {ncU32, ncU32},
+		NetTableEncMap:                 {ncU32},
+		NetTableAssembly:               {ncU32, ncU16, ncU16, ncU16, ncU16, ncU32, ncBlob, ncString, ncString},
+		NetTableAssemblyProcessor:      {ncU32},
+		NetTableAssemblyOS:             {ncU32, ncU32, ncU32},
+		NetTableAssemblyRef:            {ncU16, ncU16, ncU16, ncU16, ncU32, ncBlob, ncString, ncString, ncBlob},
+		NetTableAssemblyRefProcessor:   {ncU32, ncIndex(NetTableAssemblyRef)},
+		NetTableAssemblyRefOS:          {ncU32, ncU32, ncU32, ncIndex(NetTableAssemblyRef)},
+		NetTableFile:                   {ncU32, ncString, ncBlob},
+		NetTableExportedType:           {ncU32, ncU32, ncString, ncString, ncCoded(codedImplementation)},
+		NetTableManifestResource:       {ncU32, ncU32, ncString, ncCoded(codedImplementation)},
+		NetTableNestedClass:            {ncIndex(NetTableTypeDef), ncIndex(NetTableTypeDef)},
+		NetTableGenericParam:           {ncU16, ncU16, ncCoded(codedTypeOrMethodDef), ncString},
+		NetTableMethodSpec:             {ncCoded(codedMethodDefOrRef), ncBlob},
+		NetTableGenericParamConstraint: {ncIndex(NetTableGenericParam), ncCoded(codedTypeDefOrRef)},
+	}
+)
+
+// NetTables holds the decoded contents of the #~ metadata stream
+type NetTables struct {
+	MajorVersion uint8
+	MinorVersion uint8
+	HeapSizes    uint8
+	Valid        uint64 // bitmask of present tables
+	Sorted       uint64 // bitmask of sorted tables
+
+	RowCounts [64]uint32
+	// Rows holds the column values of every row of every known table. Strings,
+	// GUIDs and blobs are heap indexes and coded indexes are converted to metadata tokens.
+	Rows [64][][]uint32
+
+	TypeDefs         []NetTypeDef
+	MethodDefs       []NetMethodDef
+	MemberRefs       []NetMemberRef
+	CustomAttributes []NetCustomAttribute
+	AssemblyRefs     []NetAssemblyRef
+	ModuleRefs       []string
+	ImplMaps         []NetImplMap
+}
+
+// NetTypeDef - a row of the TypeDef table
+type NetTypeDef struct {
+	Flags         uint32
+	TypeName      string
+	TypeNamespace string
+	Extends       uint32 // TypeDefOrRef token
+	FieldList     uint32 // first row of the Field table owned by this type
+	MethodList    uint32 // first row of the MethodDef table owned by this type
+}
+
+// NetMethodDef - a row of the MethodDef table
+type NetMethodDef struct {
+	RVA       uint32
+	ImplFlags uint16
+	Flags     uint16
+	Name      string
+	Signature []byte
+	ParamList uint32 // first row of the Param table owned by this method
+}
+
+// NetMemberRef - a row of the MemberRef table
+type NetMemberRef struct {
+	Class     uint32 // MemberRefParent token
+	Name      string
+	Signature []byte
+}
+
+// NetCustomAttribute - a row of the CustomAttribute table
+type NetCustomAttribute struct {
+	Parent uint32 // HasCustomAttribute token
+	Type   uint32 // MethodDef or MemberRef token of the attribute constructor
+	Value  []byte
+}
+
+// NetAssemblyRef - a row of the AssemblyRef table
+type NetAssemblyRef struct {
+	MajorVersion     uint16
+	MinorVersion     uint16
+	BuildNumber      uint16
+	RevisionNumber   uint16
+	Flags            uint32
+	PublicKeyOrToken []byte
+	Name             string
+	Culture          string
+	HashValue        []byte
+}
+
+// NetImplMap - a row of the ImplMap table, describing a P/Invoke import
+type NetImplMap struct {
+	MappingFlags    uint16
+	MemberForwarded uint32 // Field or MethodDef token
+	ImportName      string
+	ImportScope     uint32 // row of the ModuleRef table
+}
+
+// readTables decodes the #~ stream using the heaps already read into n
+func (n *Net) readTables(d []byte) (*NetTables, error) {
+	if len(d) < 24 {
+		return nil, fmt.Errorf("#~ stream too short: %d bytes", len(d))
+	}
+	t := new(NetTables)
+	t.MajorVersion = d[4]
+	t.MinorVersion = d[5]
+	t.HeapSizes = d[6]
+	t.Valid = binary.LittleEndian.Uint64(d[8:16])
+	t.Sorted = binary.LittleEndian.Uint64(d[16:24])
+	d = d[24:]
+
+	for i := uint(0); i < 64; i++ {
+		if t.Valid&(1<<i) == 0 {
+			continue
+		}
+		if len(d) < 4 {
+			return nil, fmt.Errorf("truncated row count of table 0x%x", i)
+		}
+		t.RowCounts[i] = binary.LittleEndian.Uint32(d[0:4])
+		d = d[4:]
+	}
+	if t.HeapSizes&heapExtraData != 0 {
+		if len(d) < 4 {
+			return nil, fmt.Errorf("truncated extra data")
+		}
+		d = d[4:]
+	}
+
+	// column widths depend on heap sizes and on the row counts of referenced tables
+	width := func(c netColumn) int {
+		switch c.kind {
+		case colU16:
+			return 2
+		case colU32:
+			return 4
+		case colString:
+			if t.HeapSizes&heapSizeStrings != 0 {
+				return 4
+			}
+		case colGUID:
+			if t.HeapSizes&heapSizeGUID != 0 {
+				return 4
+			}
+		case colBlob:
+			if t.HeapSizes&heapSizeBlob != 0 {
+				return 4
+			}
+		case colIndex:
+			if t.RowCounts[c.ref] > 0xffff {
+				return 4
+			}
+		case colCoded:
+			limit := uint32(1) << (16 - codedIndexBits(c.ref))
+			for _, table := range codedIndexTables[c.ref] {
+				if table != noTable && t.RowCounts[table] >= limit {
+					return 4
+				}
+			}
+		}
+		return 2
+	}
+
+	for i := range netSchema {
+		if t.RowCounts[i] == 0 {
+			continue
+		}
+		schema := netSchema[i]
+		rowSize := 0
+		for _, c := range schema {
+			rowSize += width(c)
+		}
+		if uint64(rowSize)*uint64(t.RowCounts[i]) > uint64(len(d)) {
+			return nil, fmt.Errorf("table 0x%x extends past the end of the #~ stream", i)
+		}
+		rows := make([][]uint32, t.RowCounts[i])
+		for r := range rows {
+			row := make([]uint32, len(schema))
+			for ci, c := range schema {
+				if width(c) == 4 {
+					row[ci] = binary.LittleEndian.Uint32(d)
+					d = d[4:]
+				} else {
+					row[ci] = uint32(binary.LittleEndian.Uint16(d))
+					d = d[2:]
+				}
+				if c.kind == colCoded {
+					row[ci] = codedIndexToken(c.ref, row[ci])
+				}
+			}
+			rows[r] = row
+		}
+		t.Rows[i] = rows
+	}
+
+	for _, row := range t.Rows[NetTableTypeDef] {
+		t.TypeDefs = append(t.TypeDefs, NetTypeDef{
+			Flags:         row[0],
+			TypeName:      n.String(row[1]),
+			TypeNamespace: n.String(row[2]),
+			Extends:       row[3],
+			FieldList:     row[4],
+			MethodList:    row[5],
+		})
+	}
+	for _, row := range t.Rows[NetTableMethodDef] {
+		t.MethodDefs = append(t.MethodDefs, NetMethodDef{
+			RVA:       row[0],
+			ImplFlags: uint16(row[1]),
+			Flags:     uint16(row[2]),
+			Name:      n.String(row[3]),
+			Signature: n.Blob(row[4]),
+			ParamList: row[5],
+		})
+	}
+	for _, row := range t.Rows[NetTableMemberRef] {
+		t.MemberRefs = append(t.MemberRefs, NetMemberRef{
+			Class:     row[0],
+			Name:      n.String(row[1]),
+			Signature: n.Blob(row[2]),
+		})
+	}
+	for _, row := range t.Rows[NetTableCustomAttribute] {
+		t.CustomAttributes = append(t.CustomAttributes, NetCustomAttribute{
+			Parent: row[0],
+			Type:   row[1],
+			Value:  n.Blob(row[2]),
+		})
+	}
+	for _, row := range t.Rows[NetTableAssemblyRef] {
+		t.AssemblyRefs = append(t.AssemblyRefs, NetAssemblyRef{
+			MajorVersion:     uint16(row[0]),
+			MinorVersion:     uint16(row[1]),
+			BuildNumber:      uint16(row[2]),
+			RevisionNumber:   uint16(row[3]),
+			Flags:            row[4],
+			PublicKeyOrToken: n.Blob(row[5]),
+			Name:             n.String(row[6]),
+			Culture:          n.String(row[7]),
+			HashValue:        n.Blob(row[8]),
+		})
+	}
+	for _, row := range t.Rows[NetTableModuleRef] {
+		t.ModuleRefs = append(t.ModuleRefs, n.String(row[0]))
+	}
+	for _, row := range t.Rows[NetTableImplMap] {
+		t.ImplMaps = append(t.ImplMaps, NetImplMap{
+			MappingFlags:    uint16(row[0]),
+			MemberForwarded: row[1],
+			ImportName:      n.String(row[2]),
+			ImportScope:     row[3],
+		})
+	}
+	return t, nil
+}
+
+// codedIndexToken converts a coded index value into a metadata token
+func codedIndexToken(kind uint8, v uint32) uint32 {
+	bits := codedIndexBits(kind)
+	tables := codedIndexTables[kind]
+	tag := v & (1<<bits - 1)
+	if int(tag) >= len(tables) || tables[tag] == noTable {
+		return 0
+	}
+	return uint32(tables[tag])<<24 | v>>bits
+}
@@ -0,0 +1,108 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+const sizeofReloc = 10
+
+// objectBytes serializes a COFF object file, which has no DOS header, no
+// optional header and keeps relocations for each section. The layout is
+// recomputed: section data and relocations follow the section headers, then
+// come the symbol table and the string table.
+func (peFile *File) objectBytes() ([]byte, error) {
+	stringTable := append(StringTable(nil), peFile.StringTable...)
+
+	fileHeader := peFile.FileHeader
+	fileHeader.NumberOfSections = uint16(len(peFile.Sections))
+	fileHeader.SizeOfOptionalHeader = 0
+	if len(peFile.Sections) > 0xffff {
+		return nil, fmt.Errorf("too many sections: %d", len(peFile.Sections))
+	}
+
+	offset := uint32(binary.Size(fileHeader)) + uint32(len(peFile.Sections)*binary.Size(SectionHeader32{}))
+
+	sectionHeaders := make([]SectionHeader32, len(peFile.Sections))
+	sectionData := make([][]byte, len(peFile.Sections))
+	for idx, section := range peFile.Sections {
+		sh := SectionHeader32{
+			Name:            section.OriginalName,
+			VirtualSize:     section.VirtualSize,
+			VirtualAddress:  section.VirtualAddress,
+			SizeOfRawData:   section.Size,
+			Characteristics: section.Characteristics &^ IMAGE_SCN_LNK_NRELOC_OVFL,
+		}
+		if sh.Name == [8]uint8{} {
+			if len(section.Name) <= len(sh.Name) {
+				copy(sh.Name[:], section.Name)
+			} else {
+				// long section names are stored as "/offset" into the string table
+				name := "/" + strconv.Itoa(int(stringTable.add(section.Name)))
+				if len(name) > len(sh.Name) {
+					return nil, fmt.Errorf("string table offset of section %s is too large", section.Name)
+				}
+				copy(sh.Name[:], name)
+			}
+		}
+
+		if section.Characteristics&IMAGE_SCN_CNT_UNINITIALIZED_DATA == 0 {
+			data, err := section.Data()
+			if err != nil {
+				return nil, fmt.Errorf("fail to read section %s: %v", section.Name, err)
+			}
+			sh.SizeOfRawData = uint32(len(data))
+			if len(data) > 0 {
+				sh.PointerToRawData = offset
+				offset += uint32(len(data))
+			}
+			sectionData[idx] = data
+		}
+
+		if n := len(section.Relocs); n > 0 {
+			sh.PointerToRelocations = offset
+			if n < 0xffff {
+				sh.NumberOfRelocations = uint16(n)
+			} else {
+				// the real count, including this extra entry, is kept in the first relocation
+				sh.NumberOfRelocations = 0xffff
+				sh.Characteristics |= IMAGE_SCN_LNK_NRELOC_OVFL
+				n++
+			}
+			offset += uint32(n * sizeofReloc)
+		}
+		sectionHeaders[idx] = sh
+	}
+
+	fileHeader.PointerToSymbolTable = 0
+	fileHeader.NumberOfSymbols = uint32(len(peFile.COFFSymbols))
+	if len(peFile.COFFSymbols) > 0 || len(stringTable) > 4 {
+		fileHeader.PointerToSymbolTable = offset
+	}
+
+	peBuf := bytes.NewBuffer(nil)
+	binary.Write(peBuf, binary.LittleEndian, fileHeader)
+	binary.Write(peBuf, binary.LittleEndian, sectionHeaders)
+	for idx, sh := range sectionHeaders {
+		peBuf.Write(sectionData[idx])
+		if sh.Characteristics&IMAGE_SCN_LNK_NRELOC_OVFL != 0 {
+			binary.Write(peBuf, binary.LittleEndian, Reloc{VirtualAddress: uint32(len(peFile.Sections[idx].Relocs) + 1)})
+		}
+		binary.Write(peBuf, binary.LittleEndian, peFile.Sections[idx].Relocs)
+	}
+
+	// write symbols
+	binary.Write(peBuf, binary.LittleEndian, peFile.COFFSymbols)
+
+	// write the string table, which always starts with its length
+	if len(stringTable) < 4 {
+		stringTable = StringTable{4, 0, 0, 0}
+	}
+	if fileHeader.PointerToSymbolTable != 0 {
+		peBuf.Write(stringTable)
+	}
+
+	return peBuf.Bytes(), nil
+}
@@ -0,0 +1,105 @@
+package pe
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestObjectRoundTrip(t *testing.T) {
+	for _, name := range []string{"testdata/gcc-amd64-mingw-obj", "testdata/gcc-386-mingw-obj"} {
+		f, err := Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := f.Bytes()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		g, err := NewFile(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: fail to read written object: %v", name, err)
+		}
+
+		if len(g.Sections) != len(f.Sections) {
+			t.Fatalf("%s: got %d sections, want %d", name, len(g.Sections), len(f.Sections))
+		}
+		for i, s := range f.Sections {
+			want, _ := s.Data()
+			got, _ := g.Sections[i].Data()
+			if g.Sections[i].Name != s.Name || !bytes.Equal(got, want) {
+				t.Errorf("%s: section %s differs after round trip", name, s.Name)
+			}
+			if !reflect.DeepEqual(g.Sections[i].Relocs, s.Relocs) {
+				t.Errorf("%s: relocations of section %s differ after round trip", name, s.Name)
+			}
+		}
+		if !reflect.DeepEqual(g.COFFSymbols, f.COFFSymbols) {
+			t.Errorf("%s: symbols differ after round trip", name)
+		}
+		if !reflect.DeepEqual(g.Symbols, f.Symbols) {
+			t.Errorf("%s: symbol names differ after round trip", name)
+		}
+		f.Close()
+	}
+}
+
+func TestObjectBuild(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	longName := ".debug_" + strings.Repeat("x", 12)
+	relocs := make([]Reloc, 0x10005)
+	for i := range relocs {
+		relocs[i] = Reloc{VirtualAddress: uint32(i * 4), Type: 3} // IMAGE_REL_AMD64_ADDR32NB
+	}
+	s := &Section{
+		SectionHeader: SectionHeader{
+			Name:            longName,
+			Characteristics: IMAGE_SCN_CNT_INITIALIZED_DATA | IMAGE_SCN_MEM_DISCARDABLE,
+		},
+		Relocs: relocs,
+	}
+	content := bytes.Repeat([]byte{0xcc}, 16)
+	s.Replace(bytes.NewReader(content), int64(len(content)))
+	f.Sections = append(f.Sections, s)
+
+	aux := COFFSymbolAuxFormat5{Size: uint32(len(content)), NumRelocs: 0xffff, SecNum: uint16(len(f.Sections))}
+	idx, err := f.AddCOFFSymbol(longName, 0, int16(len(f.Sections)), 0, IMAGE_SYM_CLASS_STATIC, aux.Record())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := g.Section(longName)
+	if gs == nil {
+		t.Fatalf("section %s not found", longName)
+	}
+	if got, _ := gs.Data(); !bytes.Equal(got, content) {
+		t.Errorf("section %s has data %x, want %x", longName, got, content)
+	}
+	if !reflect.DeepEqual(gs.Relocs, relocs) {
+		t.Errorf("section %s has %d relocations, want %d", longName, len(gs.Relocs), len(relocs))
+	}
+	if g.Symbols[len(g.Symbols)-1].Name != longName {
+		t.Errorf("last symbol is %q, want %q", g.Symbols[len(g.Symbols)-1].Name, longName)
+	}
+	gaux, err := g.COFFSymbolReadSectionDefAux(int(idx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *gaux != aux {
+		t.Errorf("section definition is %+v, want %+v", *gaux, aux)
+	}
+}
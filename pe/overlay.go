@@ -0,0 +1,94 @@
+package pe
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// imageEnd returns the file offset just past the last byte of the headers,
+// sections, relocations, symbol table and string table.
+func (f *File) imageEnd() int64 {
+	end := f.OptionalHeaderOffset + int64(f.FileHeader.SizeOfOptionalHeader) +
+		int64(f.FileHeader.NumberOfSections)*int64(binary.Size(SectionHeader32{}))
+	grow := func(e int64) {
+		if e > end {
+			end = e
+		}
+	}
+
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		grow(int64(oh.SizeOfHeaders))
+	case *OptionalHeader64:
+		grow(int64(oh.SizeOfHeaders))
+	}
+	for _, s := range f.Sections {
+		if s.Offset != 0 {
+			grow(int64(s.Offset) + int64(s.Size))
+		}
+		if s.NumberOfRelocations != 0 {
+			grow(int64(s.PointerToRelocations) + int64(s.NumberOfRelocations)*10)
+		}
+	}
+	if f.FileHeader.PointerToSymbolTable != 0 {
+		symEnd := int64(f.FileHeader.PointerToSymbolTable) + int64(f.FileHeader.NumberOfSymbols)*COFFSymbolSize
+		// the string table always has at least its 4 byte length
+		if len(f.StringTable) > 4 {
+			symEnd += int64(len(f.StringTable))
+		} else {
+			symEnd += 4
+		}
+		grow(symEnd)
+	}
+	return end
+}
+
+// readOverlay reads any data that follows the image, leaving out the
+// certificate table, including any part of it that starts inside the image. It also returns how many of the overlay bytes were
+// found after the certificate table.
+func readOverlay(f *File, r io.ReadSeeker) ([]byte, int, error) {
+	end := f.imageEnd()
+	if _, err := r.Seek(end, seekStart); err != nil {
+		return nil, 0, fmt.Errorf("fail to seek to overlay: %v", err)
+	}
+	trailer, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, 0, fmt.Errorf("fail to read overlay: %v", err)
+	}
+	if len(trailer) == 0 {
+		return nil, 0, nil
+	}
+
+	if f.CertificateTable != nil {
+		var certTable DataDirectory
+		switch oh := f.OptionalHeader.(type) {
+		case *OptionalHeader32:
+			certTable = oh.DataDirectory[CERTIFICATE_TABLE]
+		case *OptionalHeader64:
+			certTable = oh.DataDirectory[CERTIFICATE_TABLE]
+		}
+		start := int64(certTable.VirtualAddress) - end
+		stop := start + int64(certTable.Size)
+		if start < 0 {
+			// the table begins inside the image, so only its tail, if
+			// any, is part of the trailer; Bytes refuses to write it
+			// again after the image
+			f.certOverlapsImage = true
+			if stop < 0 {
+				stop = 0
+			}
+			start = 0
+		}
+		if stop <= int64(len(trailer)) {
+			after := trailer[stop:]
+			overlay := append(trailer[:start:start], after...)
+			if len(overlay) == 0 {
+				return nil, 0, nil
+			}
+			return overlay, len(after), nil
+		}
+	}
+	return trailer, 0, nil
+}
@@ -0,0 +1,89 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+)
+
+func TestOverlayRoundTrip(t *testing.T) {
+	for _, name := range []string{"testdata/gcc-386-mingw-exec", "testdata/gcc-amd64-mingw-exec"} {
+		f, err := Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !f.DosExists || len(f.DosStub) != int(f.DosHeader.AddressOfNewExeHeader)-64 {
+			t.Errorf("%s: DOS stub has length %d, want %d", name, len(f.DosStub), f.DosHeader.AddressOfNewExeHeader-64)
+		}
+		if f.Overlay != nil {
+			t.Errorf("%s: unexpected overlay of %d bytes", name, len(f.Overlay))
+		}
+
+		overlay := []byte("installer payload")
+		f.Overlay = overlay
+		b, err := f.Bytes()
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasSuffix(b, overlay) {
+			t.Errorf("%s: written file does not end with the overlay", name)
+		}
+
+		f2, err := NewFile(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(f2.Overlay, overlay) {
+			t.Errorf("%s: overlay after round trip is %q, want %q", name, f2.Overlay, overlay)
+		}
+		if !bytes.Equal(f2.DosStub, f.DosStub) {
+			t.Errorf("%s: DOS stub changed after round trip", name)
+		}
+	}
+}
+
+func TestOverlayCertificateInsideImage(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/gcc-386-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	end := f.imageEnd()
+	if end != int64(len(b)) {
+		t.Fatalf("image ends at %d, file is %d bytes", end, len(b))
+	}
+
+	// the certificate table covers the last 8 bytes of the image and the
+	// first 8 bytes of the trailer
+	tail := []byte("trailing")
+	b = append(b, make([]byte, 8)...)
+	b = append(b, tail...)
+	dir := binary.LittleEndian.Uint32(b[0x3c:]) + 4 + 20 + 96 + CERTIFICATE_TABLE*8
+	binary.LittleEndian.PutUint32(b[dir:], uint32(end-8))
+	binary.LittleEndian.PutUint32(b[dir+4:], 16)
+
+	f, err = NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(f.Overlay, tail) || f.OverlayAfterCertificate != len(tail) {
+		t.Errorf("overlay is %q with %d bytes after the certificate, want %q with %d", f.Overlay, f.OverlayAfterCertificate, tail, len(tail))
+	}
+	if _, err := f.Bytes(); err == nil {
+		t.Error("Bytes wrote a certificate table that overlaps the image")
+	}
+
+	f.CertificateTable = nil
+	out, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(out, tail) {
+		t.Error("written file does not end with the overlay")
+	}
+}
@@ -115,6 +115,8 @@ const (
 	IMAGE_FILE_MACHINE_ARM       = 0x1c0
 	IMAGE_FILE_MACHINE_ARMNT     = 0x1c4
 	IMAGE_FILE_MACHINE_ARM64     = 0xaa64
+	IMAGE_FILE_MACHINE_ARM64EC   = 0xa641
+	IMAGE_FILE_MACHINE_ARM64X    = 0xa64e
 	IMAGE_FILE_MACHINE_EBC       = 0xebc
 	IMAGE_FILE_MACHINE_I386      = 0x14c
 	IMAGE_FILE_MACHINE_IA64      = 0x200
@@ -37,23 +37,59 @@ const (
 	//IMAGE_REL_BASED_ABSOLUTE - The base relocation is skipped. This type can be used to pad a block.
 	IMAGE_REL_BASED_ABSOLUTE = 0
 
-	//IMAGE_REL_BASED_HIGH           = 1
-	//IMAGE_REL_BASED_LOW            = 2
+	//IMAGE_REL_BASED_HIGH - The base relocation adds the high 16 bits of the difference to the 16-bit field at offset.
+	IMAGE_REL_BASED_HIGH = 1
+
+	//IMAGE_REL_BASED_LOW - The base relocation adds the low 16 bits of the difference to the 16-bit field at offset.
+	IMAGE_REL_BASED_LOW = 2
 
 	//IMAGE_REL_BASED_HIGHLOW - The base relocation applies all 32 bits of the difference to the 32-bit field at offset.
 	IMAGE_REL_BASED_HIGHLOW = 3
 
-	//IMAGE_REL_BASED_HIGHADJ        = 4
+	//IMAGE_REL_BASED_HIGHADJ - The base relocation adds the high 16 bits of the difference to the 16-bit field at offset,
+	// the low 16 bits needed for carry propagation occupy the next slot.
+	IMAGE_REL_BASED_HIGHADJ = 4
+
 	//IMAGE_REL_BASED_MIPS_JMPADDR   = 5
-	//IMAGE_REL_BASED_ARM_MOV32      = 5
+
+	//IMAGE_REL_BASED_ARM_MOV32 - The base relocation applies the difference to a MOVW/MOVT instruction pair (ARM mode).
+	IMAGE_REL_BASED_ARM_MOV32 = 5
+
 	//IMAGE_REL_BASED_RISCV_HIGH20   = 5
-	//IMAGE_REL_BASED_THUMB_MOV32    = 7
+
+	//IMAGE_REL_BASED_THUMB_MOV32 - The base relocation applies the difference to a MOVW/MOVT instruction pair (Thumb mode).
+	IMAGE_REL_BASED_THUMB_MOV32 = 7
+
 	//IMAGE_REL_BASED_RISCV_LOW12I   = 7
 	//IMAGE_REL_BASED_RISCV_LOW12S   = 8
 	//IMAGE_REL_BASED_MIPS_JMPADDR16 = 9
+
+	//IMAGE_REL_BASED_DIR64 - The base relocation applies the difference to the 64-bit field at offset, used by AMD64 and ARM64.
 	IMAGE_REL_BASED_DIR64 = 10
 )
 
+// ARM64 COFF relocation types (Type field of Reloc)
+const (
+	IMAGE_REL_ARM64_ABSOLUTE       = 0x0000
+	IMAGE_REL_ARM64_ADDR32         = 0x0001
+	IMAGE_REL_ARM64_ADDR32NB       = 0x0002
+	IMAGE_REL_ARM64_BRANCH26       = 0x0003
+	IMAGE_REL_ARM64_PAGEBASE_REL21 = 0x0004
+	IMAGE_REL_ARM64_REL21          = 0x0005
+	IMAGE_REL_ARM64_PAGEOFFSET_12A = 0x0006
+	IMAGE_REL_ARM64_PAGEOFFSET_12L = 0x0007
+	IMAGE_REL_ARM64_SECREL         = 0x0008
+	IMAGE_REL_ARM64_SECREL_LOW12A  = 0x0009
+	IMAGE_REL_ARM64_SECREL_HIGH12A = 0x000a
+	IMAGE_REL_ARM64_SECREL_LOW12L  = 0x000b
+	IMAGE_REL_ARM64_TOKEN          = 0x000c
+	IMAGE_REL_ARM64_SECTION        = 0x000d
+	IMAGE_REL_ARM64_ADDR64         = 0x000e
+	IMAGE_REL_ARM64_BRANCH19       = 0x000f
+	IMAGE_REL_ARM64_BRANCH14       = 0x0010
+	IMAGE_REL_ARM64_REL32          = 0x0011
+)
+
 // readBaseRelocationTable - reads the base relocation table from the file and stores it
 func (f *File) readBaseRelocationTable() (*[]RelocationTableEntry, error) {
 
@@ -61,11 +97,9 @@ func (f *File) readBaseRelocationTable() (*[]RelocationTableEntry, error) {
 		return nil, nil
 	}
 
-	var dd DataDirectory
-	if f.Machine == IMAGE_FILE_MACHINE_AMD64 {
-		dd = f.OptionalHeader.(*OptionalHeader64).DataDirectory[IMAGE_DIRECTORY_ENTRY_BASERELOC]
-	} else {
-		dd = f.OptionalHeader.(*OptionalHeader32).DataDirectory[IMAGE_DIRECTORY_ENTRY_BASERELOC]
+	dd, ok := f.dataDirectory(IMAGE_DIRECTORY_ENTRY_BASERELOC)
+	if !ok {
+		return nil, nil
 	}
 	var sectionData []byte
 	var err error
@@ -108,36 +142,19 @@ func (f *File) readBaseRelocationTable() (*[]RelocationTableEntry, error) {
 	return &reloBlocks, nil
 }
 
-// Relocate - performs base relocations on this image to the given offset
-func (f *File) Relocate(baseAddr uint64, image *[]byte) {
+// Relocate - performs base relocations on this image to the given offset.
+// If the base relocation table holds an unsupported or out of range entry,
+// it returns an error and leaves image unchanged.
+func (f *File) Relocate(baseAddr uint64, image *[]byte) error {
 	var imageBase uint64
-	pe64 := f.Machine == IMAGE_FILE_MACHINE_AMD64
+	pe64 := f.is64()
 	if pe64 {
 		imageBase = f.OptionalHeader.(*OptionalHeader64).ImageBase
 	} else {
 		imageBase = uint64(f.OptionalHeader.(*OptionalHeader32).ImageBase)
 	}
-	for _, block := range *f.BaseRelocationTable {
-		pageRVA := block.VirtualAddress
-		for _, item := range block.BlockItems {
-			if item.Type == IMAGE_REL_BASED_HIGHLOW { // 32 bit
-				delta := uint32(baseAddr - imageBase)
-				fileOffset := f.RVAToFileOffset(pageRVA)
-				idx := fileOffset + uint32(item.Offset)
-				originalAddress := binary.LittleEndian.Uint32((*image)[idx : idx+4])
-				b := make([]byte, 4)
-				binary.LittleEndian.PutUint32(b, originalAddress+delta)
-				copy((*image)[idx:idx+4], b)
-			} else if item.Type == IMAGE_REL_BASED_DIR64 { // 64 bit
-				delta := baseAddr - imageBase
-				fileOffset := f.RVAToFileOffset(pageRVA)
-				idx := fileOffset + uint32(item.Offset)
-				originalAddress := binary.LittleEndian.Uint64((*image)[idx : idx+8])
-				b := make([]byte, 8)
-				binary.LittleEndian.PutUint64(b, originalAddress+delta)
-				copy((*image)[idx:idx+8], b)
-			}
-		}
+	if err := f.applyBaseRelocations(*image, f.RVAToFileOffset, baseAddr-imageBase); err != nil {
+		return err
 	}
 
 	// update imageBase in the optional header
@@ -152,6 +169,107 @@ func (f *File) Relocate(baseAddr uint64, image *[]byte) {
 		idx := f.OptionalHeaderOffset + 28
 		copy((*image)[idx:idx+4], b)
 	}
+	return nil
+}
+
+// applyBaseRelocations adds delta to every location named by the base relocation
+// table. offset translates an RVA into an index of image. Every entry is checked
+// before any is applied, so image is left untouched when an error is returned.
+func (f *File) applyBaseRelocations(image []byte, offset func(rva uint32) uint32, delta uint64) error {
+	if f.BaseRelocationTable == nil {
+		return nil
+	}
+	for _, apply := range [...]bool{false, true} {
+		for _, block := range *f.BaseRelocationTable {
+			pageRVA := block.VirtualAddress
+			for i := 0; i < len(block.BlockItems); i++ {
+				item := block.BlockItems[i]
+				idx := uint64(offset(pageRVA + uint32(item.Offset)))
+				size := uint64(0)
+				switch item.Type {
+				case IMAGE_REL_BASED_ABSOLUTE:
+					continue
+				case IMAGE_REL_BASED_HIGH, IMAGE_REL_BASED_LOW, IMAGE_REL_BASED_HIGHADJ:
+					size = 2
+				case IMAGE_REL_BASED_HIGHLOW:
+					size = 4
+				case IMAGE_REL_BASED_DIR64, IMAGE_REL_BASED_ARM_MOV32, IMAGE_REL_BASED_THUMB_MOV32:
+					size = 8
+				default:
+					return fmt.Errorf("unsupported base relocation type %d at RVA 0x%x", item.Type, pageRVA+uint32(item.Offset))
+				}
+				if idx+size > uint64(len(image)) {
+					return fmt.Errorf("base relocation at RVA 0x%x is outside of the image", pageRVA+uint32(item.Offset))
+				}
+				if item.Type == IMAGE_REL_BASED_HIGHADJ && i+1 >= len(block.BlockItems) {
+					return fmt.Errorf("HIGHADJ base relocation at RVA 0x%x is missing its low half", pageRVA+uint32(item.Offset))
+				}
+				if !apply {
+					if item.Type == IMAGE_REL_BASED_HIGHADJ {
+						i++
+					}
+					continue
+				}
+				b := image[idx : idx+size]
+
+				switch item.Type {
+				case IMAGE_REL_BASED_HIGH: // high 16 bits
+					v := uint32(binary.LittleEndian.Uint16(b))<<16 + uint32(delta)
+					binary.LittleEndian.PutUint16(b, uint16(v>>16))
+				case IMAGE_REL_BASED_LOW: // low 16 bits
+					binary.LittleEndian.PutUint16(b, binary.LittleEndian.Uint16(b)+uint16(delta))
+				case IMAGE_REL_BASED_HIGHADJ: // high 16 bits, the low 16 bits are held by the next slot
+					i++
+					next := block.BlockItems[i]
+					// the loader reads the low half as a signed SHORT
+					low := uint32(int32(int16(uint16(next.Type)<<12 | next.Offset)))
+					v := uint32(binary.LittleEndian.Uint16(b))<<16 + low + uint32(delta) + 0x8000
+					binary.LittleEndian.PutUint16(b, uint16(v>>16))
+				case IMAGE_REL_BASED_HIGHLOW: // 32 bit
+					binary.LittleEndian.PutUint32(b, binary.LittleEndian.Uint32(b)+uint32(delta))
+				case IMAGE_REL_BASED_DIR64: // 64 bit
+					binary.LittleEndian.PutUint64(b, binary.LittleEndian.Uint64(b)+delta)
+				case IMAGE_REL_BASED_ARM_MOV32: // ARM MOVW/MOVT pair
+					movw, movt := binary.LittleEndian.Uint32(b[0:4]), binary.LittleEndian.Uint32(b[4:8])
+					v := armMovImm(movw) | armMovImm(movt)<<16 + uint32(delta)
+					binary.LittleEndian.PutUint32(b[0:4], armSetMovImm(movw, uint16(v)))
+					binary.LittleEndian.PutUint32(b[4:8], armSetMovImm(movt, uint16(v>>16)))
+				case IMAGE_REL_BASED_THUMB_MOV32: // Thumb-2 MOVW/MOVT pair, each made of two halfwords
+					movw := uint32(binary.LittleEndian.Uint16(b[0:2]))<<16 | uint32(binary.LittleEndian.Uint16(b[2:4]))
+					movt := uint32(binary.LittleEndian.Uint16(b[4:6]))<<16 | uint32(binary.LittleEndian.Uint16(b[6:8]))
+					v := thumbMovImm(movw) | thumbMovImm(movt)<<16 + uint32(delta)
+					movw, movt = thumbSetMovImm(movw, uint16(v)), thumbSetMovImm(movt, uint16(v>>16))
+					binary.LittleEndian.PutUint16(b[0:2], uint16(movw>>16))
+					binary.LittleEndian.PutUint16(b[2:4], uint16(movw))
+					binary.LittleEndian.PutUint16(b[4:6], uint16(movt>>16))
+					binary.LittleEndian.PutUint16(b[6:8], uint16(movt))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// armMovImm extracts imm4:imm12 from an ARM MOVW/MOVT instruction
+func armMovImm(ins uint32) uint32 {
+	return (ins>>16&0xf)<<12 | ins&0xfff
+}
+
+func armSetMovImm(ins uint32, imm uint16) uint32 {
+	ins &^= 0xf<<16 | 0xfff
+	return ins | uint32(imm>>12)<<16 | uint32(imm&0xfff)
+}
+
+// thumbMovImm extracts imm4:i:imm3:imm8 from a Thumb-2 MOVW/MOVT instruction,
+// given with its first halfword in the upper 16 bits
+func thumbMovImm(ins uint32) uint32 {
+	return (ins>>16&0xf)<<12 | (ins>>26&1)<<11 | (ins>>12&7)<<8 | ins&0xff
+}
+
+func thumbSetMovImm(ins uint32, imm uint16) uint32 {
+	ins &^= 0xf<<16 | 1<<26 | 7<<12 | 0xff
+	v := uint32(imm)
+	return ins | (v>>12&0xf)<<16 | (v>>11&1)<<26 | (v>>8&7)<<12 | v&0xff
 }
 
 func readRelocs(sh *SectionHeader, r io.ReadSeeker) ([]Reloc, error) {
@@ -162,7 +280,19 @@ func readRelocs(sh *SectionHeader, r io.ReadSeeker) ([]Reloc, error) {
 	if err != nil {
 		return nil, fmt.Errorf("fail to seek to %q section relocations: %v", sh.Name, err)
 	}
-	relocs := make([]Reloc, sh.NumberOfRelocations)
+	count := uint32(sh.NumberOfRelocations)
+	if sh.Characteristics&IMAGE_SCN_LNK_NRELOC_OVFL != 0 && sh.NumberOfRelocations == 0xffff {
+		// the real count is held by the first relocation, which counts itself
+		var first Reloc
+		if err := binary.Read(r, binary.LittleEndian, &first); err != nil {
+			return nil, fmt.Errorf("fail to read extended relocation count: %v", err)
+		}
+		if first.VirtualAddress == 0 {
+			return nil, fmt.Errorf("%q section has an invalid extended relocation count", sh.Name)
+		}
+		count = first.VirtualAddress - 1
+	}
+	relocs := make([]Reloc, count)
 	err = binary.Read(r, binary.LittleEndian, relocs)
 	if err != nil {
 		return nil, fmt.Errorf("fail to read section relocations: %v", err)
@@ -0,0 +1,115 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+const (
+	richSignature = 0x68636952 // "Rich"
+	dansSignature = 0x536e6144 // "DanS"
+)
+
+// RichHeader is the decoded Rich header the MSVC linker places between the
+// DOS stub and the PE header, recording which tools built the image.
+type RichHeader struct {
+	XorKey  uint32 // checksum key the header was masked with
+	Entries []RichHeaderEntry
+
+	start int // offset of the DanS marker within File.RichHeader
+}
+
+// RichHeaderEntry - a comp.id and the number of objects built with it
+type RichHeaderEntry struct {
+	ProductID uint16
+	BuildID   uint16
+	Count     uint32
+}
+
+// CompID returns the packed comp.id value of the entry
+func (e RichHeaderEntry) CompID() uint32 {
+	return uint32(e.ProductID)<<16 | uint32(e.BuildID)
+}
+
+// decodeRichHeader decodes raw, the bytes following the DOS header up to and
+// including the "Rich" marker and its key.
+func decodeRichHeader(raw []byte) (*RichHeader, error) {
+	if len(raw) < 8 || len(raw)%4 != 0 {
+		return nil, errors.New("rich header has invalid length")
+	}
+	end := len(raw) - 8
+	if binary.LittleEndian.Uint32(raw[end:]) != richSignature {
+		return nil, errors.New("rich header is missing its Rich marker")
+	}
+	rh := &RichHeader{XorKey: binary.LittleEndian.Uint32(raw[end+4:])}
+
+	rh.start = -1
+	for i := 0; i < end; i += 4 {
+		if binary.LittleEndian.Uint32(raw[i:])^rh.XorKey == dansSignature {
+			rh.start = i
+			break
+		}
+	}
+	if rh.start == -1 {
+		return nil, errors.New("rich header is missing its DanS marker")
+	}
+
+	// DanS is followed by three padding dwords which are zero once unmasked
+	for i := rh.start + 16; i+8 <= end; i += 8 {
+		compID := binary.LittleEndian.Uint32(raw[i:]) ^ rh.XorKey
+		rh.Entries = append(rh.Entries, RichHeaderEntry{
+			ProductID: uint16(compID >> 16),
+			BuildID:   uint16(compID),
+			Count:     binary.LittleEndian.Uint32(raw[i+4:]) ^ rh.XorKey,
+		})
+	}
+	return rh, nil
+}
+
+// Checksum computes the key of the Rich header, given dos, the bytes of the
+// file that precede the DanS marker.
+func (rh *RichHeader) Checksum(dos []byte) uint32 {
+	csum := uint32(len(dos))
+	for i, b := range dos {
+		// e_lfanew is excluded, it is not known when the linker computes the key
+		if i >= 0x3c && i < 0x40 {
+			continue
+		}
+		csum += bits.RotateLeft32(uint32(b), i)
+	}
+	for _, e := range rh.Entries {
+		csum += bits.RotateLeft32(e.CompID(), int(e.Count&0x1f))
+	}
+	return csum
+}
+
+// encode masks the header with the key computed over dos, and records the key in XorKey
+func (rh *RichHeader) encode(dos []byte) []byte {
+	rh.XorKey = rh.Checksum(dos)
+
+	var buf bytes.Buffer
+	w := func(v uint32) { binary.Write(&buf, binary.LittleEndian, v) }
+	w(dansSignature ^ rh.XorKey)
+	w(rh.XorKey)
+	w(rh.XorKey)
+	w(rh.XorKey)
+	for _, e := range rh.Entries {
+		w(e.CompID() ^ rh.XorKey)
+		w(e.Count ^ rh.XorKey)
+	}
+	w(richSignature)
+	w(rh.XorKey)
+	return buf.Bytes()
+}
+
+// StripRichHeader removes the Rich header, so that it is not written by Bytes.
+func (f *File) StripRichHeader() {
+	if f.Rich != nil {
+		f.RichHeader = f.RichHeader[:f.Rich.start]
+		f.Rich = nil
+		return
+	}
+	f.RichHeader = nil
+}
@@ -0,0 +1,45 @@
+package pe
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestRichHeaderRoundTrip(t *testing.T) {
+	dos := make([]byte, 0x80)
+	copy(dos, "MZ")
+	dos[0x3c] = 0xe0
+	copy(dos[0x40:], "\x0e\x1f\xba\x0e\x00\xb4\x09\xcd\x21\xb8\x01\x4c\xcd\x21This program cannot be run in DOS mode.\r\r\n$")
+
+	rh := &RichHeader{Entries: []RichHeaderEntry{
+		{ProductID: 0x0104, BuildID: 30795, Count: 12},
+		{ProductID: 0x0105, BuildID: 30795, Count: 33},
+		{ProductID: 0x0102, BuildID: 30795, Count: 1},
+	}}
+	raw := rh.encode(dos)
+	if want := rh.Checksum(dos); rh.XorKey != want {
+		t.Fatalf("XorKey = %#x, want %#x", rh.XorKey, want)
+	}
+	if !bytes.HasSuffix(raw[:len(raw)-4], []byte("Rich")) {
+		t.Fatalf("encoded header does not end with the Rich marker: %x", raw)
+	}
+
+	decoded, err := decodeRichHeader(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.XorKey != rh.XorKey {
+		t.Errorf("decoded XorKey = %#x, want %#x", decoded.XorKey, rh.XorKey)
+	}
+	if !reflect.DeepEqual(decoded.Entries, rh.Entries) {
+		t.Errorf("decoded entries = %v, want %v", decoded.Entries, rh.Entries)
+	}
+
+	// the key depends on the entries, so editing one must change it
+	rh.Entries[1].Count++
+	rh.encode(dos)
+	if rh.XorKey == decoded.XorKey {
+		t.Errorf("XorKey was not recomputed after editing an entry")
+	}
+}
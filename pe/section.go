@@ -97,9 +97,17 @@ func (s *Section) Replace(reader io.ReaderAt, length int64) {
 
 // Section Flags (Characteristics field)
 const (
-	IMAGE_SCN_CNT_CODE    = 0x00000020 // Section contains code
-	IMAGE_SCN_MEM_EXECUTE = 0x20000000 // Section is executable
-	IMAGE_SCN_MEM_READ    = 0x40000000 // Section is readable
+	IMAGE_SCN_CNT_CODE               = 0x00000020 // Section contains code
+	IMAGE_SCN_CNT_INITIALIZED_DATA   = 0x00000040 // Section contains initialized data
+	IMAGE_SCN_CNT_UNINITIALIZED_DATA = 0x00000080 // Section contains uninitialized data
+	IMAGE_SCN_LNK_INFO               = 0x00000200 // Section contains comments or other information (objects only)
+	IMAGE_SCN_LNK_REMOVE             = 0x00000800 // Section will not become part of the image (objects only)
+	IMAGE_SCN_LNK_COMDAT             = 0x00001000 // Section contains COMDAT data (objects only)
+	IMAGE_SCN_LNK_NRELOC_OVFL        = 0x01000000 // Section contains extended relocations
+	IMAGE_SCN_MEM_DISCARDABLE        = 0x02000000 // Section can be discarded as needed
+	IMAGE_SCN_MEM_EXECUTE            = 0x20000000 // Section is executable
+	IMAGE_SCN_MEM_READ               = 0x40000000 // Section is readable
+	IMAGE_SCN_MEM_WRITE              = 0x80000000 // Section is writeable
 
 	IMAGE_FILE_RELOCS_STRIPPED = 0x0001 // Relocation info stripped from file
 
@@ -43,8 +43,7 @@ func readStringTable(fh *FileHeader, r io.ReadSeeker) (StringTable, error) {
 	if l <= 4 {
 		return nil, nil
 	}
-	l -= 4
-	buf := make([]byte, l)
+	buf := make([]byte, l-4)
 	_, err = io.ReadFull(r, buf)
 	if err != nil {
 		return nil, fmt.Errorf("fail to read string table: %v", err)
@@ -68,3 +67,19 @@ func (st StringTable) String(start uint32) (string, error) {
 	}
 	return cstring(st[start:]), nil
 }
+
+// add appends s to the string table, creating the table if needed, and
+// returns its offset. Strings already in the table are reused.
+func (st *StringTable) add(s string) uint32 {
+	if len(*st) < 4 {
+		*st = make(StringTable, 4)
+	}
+	if i := bytes.Index((*st)[4:], append([]byte(s), 0)); i != -1 && (i == 0 || (*st)[4+i-1] == 0) {
+		return uint32(4 + i)
+	}
+	offset := uint32(len(*st))
+	*st = append(*st, s...)
+	*st = append(*st, 0)
+	binary.LittleEndian.PutUint32(*st, uint32(len(*st)))
+	return offset
+}
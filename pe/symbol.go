@@ -5,6 +5,7 @@
 package pe
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -96,3 +97,137 @@ type Symbol struct {
 	Type          uint16
 	StorageClass  uint8
 }
+
+// Storage classes of COFF symbols (StorageClass field)
+const (
+	IMAGE_SYM_CLASS_NULL             = 0
+	IMAGE_SYM_CLASS_AUTOMATIC        = 1
+	IMAGE_SYM_CLASS_EXTERNAL         = 2
+	IMAGE_SYM_CLASS_STATIC           = 3
+	IMAGE_SYM_CLASS_REGISTER         = 4
+	IMAGE_SYM_CLASS_EXTERNAL_DEF     = 5
+	IMAGE_SYM_CLASS_LABEL            = 6
+	IMAGE_SYM_CLASS_UNDEFINED_LABEL  = 7
+	IMAGE_SYM_CLASS_MEMBER_OF_STRUCT = 8
+	IMAGE_SYM_CLASS_ARGUMENT         = 9
+	IMAGE_SYM_CLASS_STRUCT_TAG       = 10
+	IMAGE_SYM_CLASS_MEMBER_OF_UNION  = 11
+	IMAGE_SYM_CLASS_UNION_TAG        = 12
+	IMAGE_SYM_CLASS_TYPE_DEFINITION  = 13
+	IMAGE_SYM_CLASS_UNDEFINED_STATIC = 14
+	IMAGE_SYM_CLASS_ENUM_TAG         = 15
+	IMAGE_SYM_CLASS_MEMBER_OF_ENUM   = 16
+	IMAGE_SYM_CLASS_REGISTER_PARAM   = 17
+	IMAGE_SYM_CLASS_BIT_FIELD        = 18
+	IMAGE_SYM_CLASS_BLOCK            = 100
+	IMAGE_SYM_CLASS_FUNCTION         = 101
+	IMAGE_SYM_CLASS_END_OF_STRUCT    = 102
+	IMAGE_SYM_CLASS_FILE             = 103
+	IMAGE_SYM_CLASS_SECTION          = 104
+	IMAGE_SYM_CLASS_WEAK_EXTERNAL    = 105
+	IMAGE_SYM_CLASS_CLR_TOKEN        = 107
+)
+
+// Special section numbers of COFF symbols (SectionNumber field)
+const (
+	IMAGE_SYM_UNDEFINED = 0
+	IMAGE_SYM_ABSOLUTE  = -1
+	IMAGE_SYM_DEBUG     = -2
+)
+
+// COMDAT selection values (Selection field of COFFSymbolAuxFormat5)
+const (
+	IMAGE_COMDAT_SELECT_NODUPLICATES = 1
+	IMAGE_COMDAT_SELECT_ANY          = 2
+	IMAGE_COMDAT_SELECT_SAME_SIZE    = 3
+	IMAGE_COMDAT_SELECT_EXACT_MATCH  = 4
+	IMAGE_COMDAT_SELECT_ASSOCIATIVE  = 5
+	IMAGE_COMDAT_SELECT_LARGEST      = 6
+)
+
+// COFFSymbolAuxFormat5 describes the auxiliary record that follows the
+// symbol of a section definition.
+type COFFSymbolAuxFormat5 struct {
+	Size           uint32
+	NumRelocs      uint16
+	NumLineNumbers uint16
+	Checksum       uint32
+	SecNum         uint16
+	Selection      uint8
+	_              [3]uint8 // padding
+}
+
+// Record returns the auxiliary record as it is stored in the symbol table.
+func (aux *COFFSymbolAuxFormat5) Record() COFFSymbol {
+	return auxRecords(aux)[0]
+}
+
+// FileAuxRecords returns the auxiliary records that hold the source file
+// name of an IMAGE_SYM_CLASS_FILE symbol.
+func FileAuxRecords(name string) []COFFSymbol {
+	b := []byte(name)
+	if pad := len(b) % COFFSymbolSize; pad != 0 || len(b) == 0 {
+		b = append(b, make([]byte, COFFSymbolSize-pad)...)
+	}
+	return auxRecords(b)
+}
+
+// auxRecords reinterprets v as a run of symbol table records.
+func auxRecords(v interface{}) []COFFSymbol {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, v)
+	recs := make([]COFFSymbol, buf.Len()/COFFSymbolSize)
+	binary.Read(&buf, binary.LittleEndian, recs)
+	return recs
+}
+
+// COFFSymbolReadSectionDefAux returns the section definition auxiliary record
+// following the symbol at index idx of COFFSymbols.
+func (f *File) COFFSymbolReadSectionDefAux(idx int) (*COFFSymbolAuxFormat5, error) {
+	if idx < 0 || idx+1 >= len(f.COFFSymbols) {
+		return nil, fmt.Errorf("invalid symbol index %d", idx)
+	}
+	if f.COFFSymbols[idx].NumberOfAuxSymbols == 0 {
+		return nil, fmt.Errorf("symbol %d has no auxiliary records", idx)
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, f.COFFSymbols[idx+1])
+	aux := new(COFFSymbolAuxFormat5)
+	if err := binary.Read(&buf, binary.LittleEndian, aux); err != nil {
+		return nil, err
+	}
+	return aux, nil
+}
+
+// AddCOFFSymbol appends a symbol and its auxiliary records to COFFSymbols and
+// Symbols, storing names longer than 8 bytes in the string table. It returns
+// the symbol table index of the new symbol, which relocations refer to.
+func (f *File) AddCOFFSymbol(name string, value uint32, sectionNumber int16, typ uint16, storageClass uint8, aux ...COFFSymbol) (uint32, error) {
+	if len(aux) > 0xff {
+		return 0, fmt.Errorf("symbol %s has too many auxiliary records", name)
+	}
+	sym := COFFSymbol{
+		Value:              value,
+		SectionNumber:      sectionNumber,
+		Type:               typ,
+		StorageClass:       storageClass,
+		NumberOfAuxSymbols: uint8(len(aux)),
+	}
+	if len(name) <= len(sym.Name) {
+		copy(sym.Name[:], name)
+	} else {
+		binary.LittleEndian.PutUint32(sym.Name[4:], f.StringTable.add(name))
+	}
+
+	idx := uint32(len(f.COFFSymbols))
+	f.COFFSymbols = append(f.COFFSymbols, sym)
+	f.COFFSymbols = append(f.COFFSymbols, aux...)
+	f.Symbols = append(f.Symbols, &Symbol{
+		Name:          name,
+		Value:         value,
+		SectionNumber: sectionNumber,
+		Type:          typ,
+		StorageClass:  storageClass,
+	})
+	return idx, nil
+}
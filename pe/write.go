@@ -4,10 +4,16 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"os"
 )
 
 func (peFile *File) Bytes() ([]byte, error) {
+	// COFF objects have no optional header and a layout of their own
+	if peFile.OptionalHeader == nil {
+		return peFile.objectBytes()
+	}
+
 	var bytesWritten uint64
 	peBuf := bytes.NewBuffer(nil)
 
@@ -16,16 +22,24 @@ func (peFile *File) Bytes() ([]byte, error) {
 	bytesWritten += uint64(binary.Size(peFile.DosHeader))
 	if peFile.DosExists {
 		binary.Write(peBuf, binary.LittleEndian, peFile.DosStub)
-		bytesWritten += uint64(binary.Size(peFile.DosStub))
+		bytesWritten += uint64(len(peFile.DosStub))
 	}
 
-	// write Rich header
-	if peFile.RichHeader != nil {
+	// write Rich header, recomputing its key if it was decoded
+	if peFile.Rich != nil {
+		binary.Write(peBuf, binary.LittleEndian, peFile.RichHeader[:peFile.Rich.start])
+		richHeader := peFile.Rich.encode(peBuf.Bytes())
+		binary.Write(peBuf, binary.LittleEndian, richHeader)
+		bytesWritten += uint64(peFile.Rich.start + len(richHeader))
+	} else if peFile.RichHeader != nil {
 		binary.Write(peBuf, binary.LittleEndian, peFile.RichHeader)
 		bytesWritten += uint64(len(peFile.RichHeader))
 	}
 
 	// apply padding before PE header if necessary
+	if bytesWritten > uint64(peFile.DosHeader.AddressOfNewExeHeader) {
+		return nil, errors.New("DOS stub and Rich header overlap the PE header")
+	}
 	if uint32(bytesWritten) != peFile.DosHeader.AddressOfNewExeHeader {
 		padding := make([]byte, peFile.DosHeader.AddressOfNewExeHeader-uint32(bytesWritten))
 		binary.Write(peBuf, binary.LittleEndian, padding)
@@ -43,25 +57,39 @@ func (peFile *File) Bytes() ([]byte, error) {
 		oldCertTableOffset, oldCertTableSize uint32
 	)
 
-	switch peFile.FileHeader.Machine {
-	case IMAGE_FILE_MACHINE_I386:
-		is32bit = true
-		optionalHeader := peFile.OptionalHeader.(*OptionalHeader32)
-		binary.Write(peBuf, binary.LittleEndian, peFile.OptionalHeader.(*OptionalHeader32))
-		bytesWritten += uint64(binary.Size(optionalHeader))
+	// encode the bound import directory, which is kept in the header padding
+	var boundImports []byte
+	if peFile.BoundImports != nil {
+		var err error
+		if boundImports, err = encodeBoundImports(peFile.BoundImports); err != nil {
+			return nil, err
+		}
+		switch oh := peFile.OptionalHeader.(type) {
+		case *OptionalHeader32:
+			oh.DataDirectory[IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT].Size = uint32(len(boundImports))
+		case *OptionalHeader64:
+			oh.DataDirectory[IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT].Size = uint32(len(boundImports))
+		}
+	}
 
+	optionalHeader, err := peFile.optionalHeaderBytes()
+	if err != nil {
+		return nil, err
+	}
+	binary.Write(peBuf, binary.LittleEndian, optionalHeader)
+	bytesWritten += uint64(len(optionalHeader))
+
+	switch optionalHeader := peFile.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		is32bit = true
 		oldCertTableOffset = optionalHeader.DataDirectory[CERTIFICATE_TABLE].VirtualAddress
 		oldCertTableSize = optionalHeader.DataDirectory[CERTIFICATE_TABLE].Size
-	case IMAGE_FILE_MACHINE_AMD64:
+	case *OptionalHeader64:
 		is32bit = false
-		optionalHeader := peFile.OptionalHeader.(*OptionalHeader64)
-		binary.Write(peBuf, binary.LittleEndian, optionalHeader)
-		bytesWritten += uint64(binary.Size(optionalHeader))
-
 		oldCertTableOffset = optionalHeader.DataDirectory[CERTIFICATE_TABLE].VirtualAddress
 		oldCertTableSize = optionalHeader.DataDirectory[CERTIFICATE_TABLE].Size
 	default:
-		return nil, errors.New("architecture not supported")
+		return nil, errors.New("optional header not supported")
 	}
 
 	// write section headers
@@ -95,6 +123,23 @@ func (peFile *File) Bytes() ([]byte, error) {
 		bytesWritten += uint64(binary.Size(sectionHeader))
 	}
 
+	// write bound import directory
+	if boundImports != nil {
+		dd, _ := peFile.dataDirectory(IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT)
+		end := uint64(dd.VirtualAddress) + uint64(len(boundImports))
+		for _, section := range peFile.Sections {
+			if section.Offset != 0 && end > uint64(section.Offset) {
+				return nil, errors.New("bound import directory overlaps section data")
+			}
+		}
+		if uint64(dd.VirtualAddress) < bytesWritten {
+			return nil, errors.New("bound import directory overlaps the section headers")
+		}
+		peBuf.Write(make([]byte, uint64(dd.VirtualAddress)-bytesWritten))
+		peBuf.Write(boundImports)
+		bytesWritten = end
+	}
+
 	// write sections' data
 	for idx, sectionHeader := range sectionHeaders {
 		section := peFile.Sections[idx]
@@ -135,10 +180,30 @@ func (peFile *File) Bytes() ([]byte, error) {
 	binary.Write(peBuf, binary.LittleEndian, peFile.StringTable)
 	bytesWritten += uint64(binary.Size(peFile.StringTable))
 
+	// write the part of the overlay that precedes the certificate table
+	overlaySplit := len(peFile.Overlay) - peFile.OverlayAfterCertificate
+	if overlaySplit < 0 {
+		overlaySplit = 0
+	} else if overlaySplit > len(peFile.Overlay) {
+		overlaySplit = len(peFile.Overlay)
+	}
+	peBuf.Write(peFile.Overlay[:overlaySplit])
+	bytesWritten += uint64(overlaySplit)
+
 	var newCertTableOffset, newCertTableSize uint32
 
 	// write the certificate table
 	if peFile.CertificateTable != nil {
+		if peFile.certOverlapsImage {
+			return nil, errors.New("certificate table overlaps the image; clear CertificateTable to rewrite the file")
+		}
+		// the certificate table must be quadword aligned. A table that was
+		// not aligned in the input therefore moves by up to 7 bytes, and the
+		// data directory entry below is updated to match.
+		if pad := (8 - bytesWritten%8) % 8; pad != 0 {
+			peBuf.Write(make([]byte, pad))
+			bytesWritten += pad
+		}
 		newCertTableOffset = uint32(bytesWritten)
 		newCertTableSize = uint32(len(peFile.CertificateTable))
 	} else {
@@ -149,6 +214,10 @@ func (peFile *File) Bytes() ([]byte, error) {
 	binary.Write(peBuf, binary.LittleEndian, peFile.CertificateTable)
 	bytesWritten += uint64(len(peFile.CertificateTable))
 
+	// write the rest of the overlay
+	peBuf.Write(peFile.Overlay[overlaySplit:])
+	bytesWritten += uint64(len(peFile.Overlay) - overlaySplit)
+
 	peData := peBuf.Bytes()
 
 	// write the offset and size of the new Certificate Table if it changed
@@ -167,6 +236,9 @@ func (peFile *File) Bytes() ([]byte, error) {
 		} else {
 			certTableLoc = int64(peFile.DosHeader.AddressOfNewExeHeader) + 24 + 144
 		}
+		if certTableLoc+8 > int64(peFile.DosHeader.AddressOfNewExeHeader)+24+int64(peFile.FileHeader.SizeOfOptionalHeader) {
+			return nil, errors.New("optional header is too short to hold the certificate table directory")
+		}
 
 		peData = append(peData[:certTableLoc], append(certTableInfoBuf.Bytes(), peData[int(certTableLoc)+binary.Size(certTableInfo):]...)...)
 	}
@@ -174,6 +246,28 @@ func (peFile *File) Bytes() ([]byte, error) {
 	return peData, nil
 }
 
+// optionalHeaderBytes encodes the optional header in the
+// FileHeader.SizeOfOptionalHeader bytes the section headers follow. Bytes
+// past the end of OptionalHeader are written as they were read; a header
+// cut short may only lose data directories that are all zero.
+func (peFile *File) optionalHeaderBytes() ([]byte, error) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, peFile.OptionalHeader)
+	b := buf.Bytes()
+	n := int(peFile.FileHeader.SizeOfOptionalHeader)
+	if n <= len(b) {
+		for _, c := range b[n:] {
+			if c != 0 {
+				return nil, fmt.Errorf("optional header does not fit in SizeOfOptionalHeader of %d bytes", n)
+			}
+		}
+		return b[:n], nil
+	}
+	end := make([]byte, n-len(b))
+	copy(end, peFile.optionalHeaderEnd)
+	return append(b, end...), nil
+}
+
 func (peFile *File) WriteFile(destFile string) error {
 	f, err := os.Create(destFile)
 	if err != nil {
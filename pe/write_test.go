@@ -0,0 +1,63 @@
+package pe
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBytesOptionalHeaderSize(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	size := f.FileHeader.SizeOfOptionalHeader
+
+	// bytes past the data directories are kept
+	f.FileHeader.SizeOfOptionalHeader = size + 8
+	f.optionalHeaderEnd = []byte("ABCDEFGH")
+	data, err := f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(g.optionalHeaderEnd) != "ABCDEFGH" {
+		t.Errorf("optional header ends with %q, want %q", g.optionalHeaderEnd, "ABCDEFGH")
+	}
+	if again, err := g.Bytes(); err != nil || !bytes.Equal(again, data) {
+		t.Errorf("file with a long optional header was not written back as it was read: %v", err)
+	}
+	for i, s := range g.Sections {
+		if s.Name != f.Sections[i].Name || s.Offset != f.Sections[i].Offset {
+			t.Errorf("section %d is %s at 0x%x, want %s at 0x%x", i, s.Name, s.Offset, f.Sections[i].Name, f.Sections[i].Offset)
+		}
+	}
+
+	// trailing data directories that are all zero can be dropped
+	oh := f.OptionalHeader.(*OptionalHeader64)
+	oh.DataDirectory[14] = DataDirectory{}
+	oh.DataDirectory[15] = DataDirectory{}
+	oh.NumberOfRvaAndSizes = 14
+	f.FileHeader.SizeOfOptionalHeader = size - 16
+	data, err = f.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err = NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.FileHeader.SizeOfOptionalHeader != size-16 || g.Sections[0].Name != f.Sections[0].Name {
+		t.Errorf("optional header is %d bytes and the first section is %s, want %d bytes and %s",
+			g.FileHeader.SizeOfOptionalHeader, g.Sections[0].Name, size-16, f.Sections[0].Name)
+	}
+
+	// but not those in use
+	f.FileHeader.SizeOfOptionalHeader = 112 + 8
+	if _, err := f.Bytes(); err == nil {
+		t.Error("optional header was written without its import directory")
+	}
+}